@@ -17,12 +17,15 @@ limitations under the License.
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"runtime"
 	"strconv"
 	"strings"
+	"text/tabwriter"
 
 	"rooster/pkg/config"
 	"rooster/pkg/utils"
@@ -39,28 +42,195 @@ func printVersion(logger *zap.Logger) {
 
 }
 
-func gatherOptions() (manifestPath string, dryRun bool, targetLabel string, canaryLabel string, canary int, namespace string, testPackage string, testBinary string) {
-	flag.BoolVar(&dryRun, "dry-run", false, "dry-run usage")
-	flag.StringVar(&manifestPath, "manifest-path", "", "Path to the manifests to perform a canary release for")
-	flag.StringVar(&targetLabel, "target-label", "", "Existing label on nodes to target")
-	flag.StringVar(&canaryLabel, "canary-label", "", "Label to put on nodes to control the canary process")
-	flag.IntVar(&canary, "canary", 0, "Canary batch size. In percentage")
-	flag.StringVar(&namespace, "namespace", "", "Targeted namespace")
-	flag.StringVar(&testPackage, "test-package", "", "Test package name")
-	flag.StringVar(&testBinary, "test-binary", "", "Test binary name")
-	flag.Parse()
+// bindOptions declares the options of the deployment on the flag set
+func bindOptions(flags *flag.FlagSet) (options *config.RoosterOptions) {
+	options = &config.RoosterOptions{}
+	flags.StringVar(&options.Project, "project", "", "Project whose defaults are read from the rooster-project-<project> ConfigMap")
+	flags.BoolVar(&options.Initialize, "initialize", false, "Create the project ConfigMap from the indicated options when it does not exist yet")
+	flags.StringVar(&options.ConfigFile, "config", "", "YAML file declaring the options of the rollout. The options indicated on the command line take precedence")
+	flags.StringVar(&options.ConfigProfile, "config-profile", "", "Profile of the user config file to use")
+	flags.BoolVar(&options.DryRun, "dry-run", false, "dry-run usage")
+	flags.BoolVar(&options.AssumeYes, "yes", false, "Answer yes to the confirmations the confirmation policy leaves to the user")
+	flags.BoolVar(&options.AssumeYes, "assume-yes", false, "Alias of --yes")
+	flags.BoolVar(&options.NonInteractive, "non-interactive", false, "Never wait for an answer on the standard input. The confirmations the confirmation policy leaves to the user are answered no, unless --yes is set")
+	flags.StringVar(&options.OnExistingCanary, "on-existing-canary", "", "What to do when nodes carry the canary label already: abort or continue. Left empty, the confirmation policy applies")
+	flags.StringVar(&options.ManifestPath, "manifest-path", "", "Path to the manifests to perform a canary release for")
+	flags.StringVar(&options.TargetLabel, "target-label", "", "Existing label on nodes to target")
+	flags.StringVar(&options.CanaryLabel, "canary-label", "", "Label to put on nodes to control the canary process")
+	flags.IntVar(&options.Canary, "canary", 0, "Canary batch size. In percentage")
+	flags.StringVar(&options.Namespace, "namespace", "", "Targeted namespace")
+	flags.StringVar(&options.TestPackage, "test-package", "", "Test package name")
+	flags.StringVar(&options.TestBinary, "test-binary", "", "Test binary name, or location to download it from: http(s)://, s3:// or oci://")
+	flags.StringVar(&options.TestBinarySha256, "test-binary-sha256", "", "sha256 checksum the test binary is verified against. Verified downloaded binaries are cached")
+	flags.StringVar(&options.TestBinarySignature, "test-binary-signature", "", "cosign signature the test binary is verified against, with the TEST_BINARY_PUBLIC_KEY key. File or URL")
+	flags.StringVar(&options.CanaryPoolLabel, "canary-pool-label", "", "Label of the nodes to always use first, in the canary batch")
+	flags.DurationVar(&options.CanaryLabelTTL, "canary-label-ttl", 0, "Time after which the canary label of an uncompleted rollout is removed by the next run. E.g: 24h")
+	flags.StringVar(&options.VersionFrom, "version-from", "", "Derive the version, i.e. the value of the canary label, from: image, the tag or digest of the first DaemonSet of the manifests. --canary-label then only needs the key")
+	flags.BoolVar(&options.AnnotateNodes, "annotate-nodes", false, "Annotate the patched nodes with the project, the version & the batch, for the node-local agents")
+	flags.IntVar(&options.MaxVersions, "max-versions", 0, "Versions the target nodes may run at once, the nodes without the canary label counting as one. 0: no limit")
+	flags.IntVar(&options.MaxPartialCoverage, "max-partial-coverage", 0, "Share of the target nodes a partial rollout may cover for longer than --max-partial-duration. In percentage")
+	flags.DurationVar(&options.MaxPartialDuration, "max-partial-duration", 0, "How long a partial rollout may cover more than --max-partial-coverage of the target nodes. E.g: 6h")
+	flags.IntVar(&options.MaxNodeFailures, "max-node-failures", 0, "Nodes of the rollout tolerated not to get ready, before it is aborted")
+	flags.BoolVar(&options.CanaryOnly, "canary-only", false, "Stop after the canary batch. The remaining nodes are patched by rooster promote")
+	flags.DurationVar(&options.MaxPause, "max-pause", 0, "With --canary-only or --canary-hold, longest pause before the rollout is rolled back or completed by rooster check-pause. 0: no limit")
+	flags.StringVar(&options.OnMaxPause, "on-max-pause", "rollback", "What rooster check-pause does to a rollout paused for longer than --max-pause: rollback or complete")
+	flags.DurationVar(&options.CanaryHold, "canary-hold", 0, "Time the canary batch is held and analysed before the remaining nodes are patched. E.g: 2h")
+	flags.StringVar(&options.Profile, "profile", "", "Ramp profile: conservative, standard, aggressive, or a registered strategy")
+	flags.IntVar(&options.Increment, "increment", 0, "Linear increments, in percentage. Replace the increments of the profile")
+	flags.StringVar(&options.ExternalStrategy, "external-strategy", "", "Command, or HTTP(S) URL, deciding the increments after the canary batch, one at a time. Replaces the increments of the profile")
+	flags.StringVar(&options.CanarySelectionQuery, "canary-selection-query", "", "Prometheus query returning a value per node, e.g. the traffic served by the primary workload. Decides which nodes are patched first")
+	flags.StringVar(&options.CanarySelectionPolicy, "canary-selection-policy", "least", "Nodes patched first: the ones with the least, or the most, as returned by the canary selection query")
+	flags.BoolVar(&options.OrderByRisk, "order-by-risk", false, "Patch the least risky nodes first, as scored from their tenant pods, stateful workloads and criticality label")
+	flags.BoolVar(&options.CreateNamespace, "create-namespace", false, "Create the targeted namespaces when missing")
+	flags.StringVar(&options.NamespaceLabels, "namespace-labels", "", "Labels of the created namespaces. Format: key1=value1,key2=value2")
+	flags.StringVar(&options.NamespaceAnnotations, "namespace-annotations", "", "Annotations of the created namespaces. Format: key1=value1,key2=value2")
+	flags.StringVar(&options.NamespaceIdentities, "namespace-identities", "", "Identity the resources of a namespace are applied with. Format: ns1=context:<name>,ns2=serviceaccount:<namespace>/<name>")
+	flags.StringVar(&options.Overlay, "overlay", "", "Overlay to merge onto the manifests. Patches are read from <manifest-path>/overlays/<overlay>")
+	flags.StringVar(&options.FindingsFormat, "findings-format", "", "Output format of the preflight findings: github or sarif")
+	flags.StringVar(&options.FindingsFile, "findings-file", "", "File the SARIF findings are written to. Default: rooster.sarif")
+	flags.StringVar(&options.EventsFile, "events-file", "", "NDJSON file the rollout state transitions are appended to")
+	flags.Var((*config.StringList)(&options.TestSecrets), "test-secret", "Secret passed to the tests as an environment variable. Format: NAME=provider:reference. Repeatable")
+	flags.Var((*config.StringList)(&options.TestSuites), "test-suite", "Test suite of the test binary, run in order. Format: name=package[,blocking|informational[,canary|batch|final]]. Repeatable")
+	flags.Var((*config.StringList)(&options.HealthGates), "health-gate", "Endpoint polled after each batch until it answers with a 2xx status: API server path or HTTP(S) URL. {node} is replaced with each node of the batch. Repeatable")
+	flags.Var((*config.StringList)(&options.TestEnv), "test-env", "Environment variable passed to the tests. Format: KEY=VALUE. Repeatable")
+	flags.BoolVar(&options.TestInheritEnv, "test-inherit-env", true, "Pass the environment of Rooster to the tests. Otherwise, they only get PATH, HOME & the explicit variables")
+	flags.StringVar(&options.TestWorkdir, "test-workdir", "", "Working directory of the tests. Default: the working directory of Rooster")
+	flags.StringVar(&options.TestTargetConfigMap, "test-target-configmap", "", "ConfigMap the nodes & the rollout under test are written to, for the tests running in the cluster")
+	flags.BoolVar(&options.NetworkProbe, "network-probe", false, "Run a short-lived pod on each patched node, checking the pod network & the DNS work there")
+	flags.StringVar(&options.SuccessCriteria, "success-criteria", "", "CEL expression a batch must meet before the next one is patched. E.g: tests.passed && restarts == 0 && ready_ratio >= 0.98")
+	flags.BoolVar(&options.IgnoreNotFound, "ignore-not-found", true, "Skip the resources that are not found when reverting. Otherwise they fail the revert")
+	flags.BoolVar(&options.NotifyTenants, "notify-tenants", false, "Notify the owners of the namespaces running on a batch before it is patched. Requires TENANT_WEBHOOK_URL")
+	flags.BoolVar(&options.RedactSecrets, "redact-secrets", false, "Strip the data of Secrets from the backups")
+	flags.BoolVar(&options.NoBackup, "no-backup", false, "Skip the snapshot of the live resources taken before a revert deletes them")
+	flags.BoolVar(&options.Chaos, "chaos", false, "Inject API errors, delays & readiness flaps, as set by the CHAOS_* environment variables. For test clusters only")
 	return
 }
 
-func printOptions(manifestPath string, dryRun bool, targetLabel string, canaryLabel string, canary int, namespace string, testPackage string, testBinary string, logger *zap.Logger) {
-	logger.Info("Canay batch size: " + strconv.Itoa(canary))
-	logger.Info("Canary-label:" + canaryLabel)
-	logger.Info("dry-run: " + strconv.FormatBool(dryRun))
-	logger.Info("Manifest path: " + manifestPath)
-	logger.Info("Namespace: " + namespace)
-	logger.Info("Target label: " + targetLabel)
-	logger.Info("Test package name: " + testPackage)
-	logger.Info("Test binary name: " + testBinary)
+func printOptions(options config.RoosterOptions, logger *zap.Logger) {
+	logger.Info("Config profile: " + options.ConfigProfile)
+	logger.Info("Project: " + options.Project)
+	logger.Info("Canay batch size: " + strconv.Itoa(options.Canary))
+	logger.Info("Canary-label:" + options.CanaryLabel)
+	logger.Info("Version from: " + options.VersionFrom)
+	logger.Info("Canary pool label: " + options.CanaryPoolLabel)
+	logger.Info("Canary hold: " + options.CanaryHold.String())
+	logger.Info("Canary only: " + strconv.FormatBool(options.CanaryOnly))
+	logger.Info("Max pause: " + options.MaxPause.String() + " (" + options.OnMaxPause + ")")
+	logger.Info("dry-run: " + strconv.FormatBool(options.DryRun))
+	logger.Info("Manifest path: " + options.ManifestPath)
+	logger.Info("Overlay: " + options.Overlay)
+	logger.Info("Namespace: " + options.Namespace)
+	logger.Info("Create namespace: " + strconv.FormatBool(options.CreateNamespace))
+	logger.Info("Profile: " + options.Profile)
+	logger.Info("Increment: " + strconv.Itoa(options.Increment))
+	logger.Info("Order by risk: " + strconv.FormatBool(options.OrderByRisk))
+	logger.Info("Canary selection query: " + options.CanarySelectionQuery + " (" + options.CanarySelectionPolicy + ")")
+	logger.Info("Target label: " + options.TargetLabel)
+	logger.Info("Success criteria: " + options.SuccessCriteria)
+	logger.Info("Network probe: " + strconv.FormatBool(options.NetworkProbe))
+	logger.Info("Health gates: " + strings.Join(options.HealthGates, ", "))
+	logger.Info("Test package name: " + options.TestPackage)
+	logger.Info("Test binary name: " + options.TestBinary)
+}
+
+func gatherRestoreOptions(args []string) (backupDirectory string, resource string, err error) {
+	restoreFlags := flag.NewFlagSet("restore", flag.ExitOnError)
+	restoreFlags.StringVar(&backupDirectory, "backup", config.Env.BackupDirectory, "Backup directory to restore the resource from, or version whose backup to restore it from: key=version, or the version alone")
+	restoreFlags.StringVar(&resource, "resource", "", "Resource to restore. Format: Kind/name")
+	err = restoreFlags.Parse(args)
+	return
+}
+
+func gatherNodesOptions(args []string) (options config.RoosterOptions, err error) {
+	nodesFlags := flag.NewFlagSet("nodes", flag.ExitOnError)
+	nodesFlags.StringVar(&options.TargetLabel, "target-label", "", "Existing label on nodes to target")
+	nodesFlags.StringVar(&options.CanaryLabel, "canary-label", "", "Label to put on nodes to control the canary process")
+	nodesFlags.IntVar(&options.Canary, "canary", 0, "Canary batch size. In percentage")
+	nodesFlags.StringVar(&options.CanaryPoolLabel, "canary-pool-label", "", "Label of the nodes to always use first, in the canary batch")
+	nodesFlags.StringVar(&options.Profile, "profile", "", "Ramp profile: conservative, standard, aggressive, or a registered strategy")
+	nodesFlags.IntVar(&options.Increment, "increment", 0, "Linear increments, in percentage. Replace the increments of the profile")
+	nodesFlags.StringVar(&options.CanarySelectionQuery, "canary-selection-query", "", "Prometheus query returning a value per node, e.g. the traffic served by the primary workload. Decides which nodes are patched first")
+	nodesFlags.StringVar(&options.CanarySelectionPolicy, "canary-selection-policy", "least", "Nodes patched first: the ones with the least, or the most, as returned by the canary selection query")
+	nodesFlags.BoolVar(&options.OrderByRisk, "order-by-risk", false, "Patch the least risky nodes first, as scored from their tenant pods, stateful workloads and criticality label")
+	err = nodesFlags.Parse(args)
+	return
+}
+
+func gatherSimulationOptions(args []string) (nodeCount int, zones int, options config.RoosterOptions, err error) {
+	simulationFlags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	simulationFlags.IntVar(&nodeCount, "nodes", 10, "Number of synthetic nodes")
+	simulationFlags.IntVar(&zones, "zones", 1, "Number of zones the synthetic nodes are spread across")
+	simulationFlags.IntVar(&options.Canary, "canary", 0, "Canary batch size. In percentage")
+	simulationFlags.StringVar(&options.Profile, "profile", "", "Ramp profile: conservative, standard, aggressive, or a registered strategy")
+	simulationFlags.IntVar(&options.Increment, "increment", 0, "Linear increments, in percentage. Replace the increments of the profile")
+	err = simulationFlags.Parse(args)
+	return
+}
+
+// resolveOptions completes the options indicated on the command line with the environment and the user profile
+func resolveOptions(logger *zap.Logger, flags *flag.FlagSet, options *config.RoosterOptions) (resolver *config.Resolver, kubeconfigPath string, err error) {
+	resolver = config.NewResolver(flags)
+	if err = resolver.ApplyEnv(); err != nil {
+		return
+	}
+	if options.ConfigFile != "" {
+		if err = resolver.ApplyRolloutFile(options.ConfigFile); err != nil {
+			return
+		}
+	}
+	if options.ConfigProfile == "" {
+		return
+	}
+	profile, err := config.LoadUserProfile(options.ConfigProfile)
+	if err != nil {
+		return
+	}
+	if profile.Kubeconfig != "" {
+		// kubectl commands target the same cluster
+		if err = os.Setenv("KUBECONFIG", profile.Kubeconfig); err != nil {
+			return
+		}
+	}
+	utils.SetKubeContext(profile.Context)
+	if err = config.ApplyProfileSettings(profile); err != nil {
+		return
+	}
+	unknown, err := resolver.Apply(config.SourceConfigFile, profile.Options)
+	for _, name := range unknown {
+		logger.Warn("Ignoring unknown option " + name + " in the user profile")
+	}
+	return resolver, profile.Kubeconfig, err
+}
+
+// applyProjectDefaults sets the options that are not resolved yet, from the project ConfigMap.
+// With --initialize, a missing ConfigMap is created from the options indicated on the command line
+func applyProjectDefaults(logger *zap.Logger, kubernetesClient *utils.K8sClient, resolver *config.Resolver, options *config.RoosterOptions) error {
+	defaults, err := worker.GetProjectDefaults(kubernetesClient, options.Project)
+	notInitialized := &worker.ProjectNotInitializedError{}
+	if errors.As(err, &notInitialized) && options.Initialize {
+		logger.Info("Initializing project " + options.Project)
+		// Options describing the invocation are not project defaults. Repeatable options hold a single value in the ConfigMap
+		defaults = resolver.Values(config.SourceFlag, "project", "initialize", "config", "config-profile", "dry-run", "yes", "assume-yes", "non-interactive", "test-secret", "test-env", "test-suite", "health-gate", "chaos")
+		return worker.InitializeProject(kubernetesClient, options.Project, defaults, options.DryRun)
+	}
+	if err != nil {
+		return err
+	}
+	unknown, err := resolver.Apply(config.SourceProject, defaults)
+	for _, name := range unknown {
+		logger.Warn("Ignoring unknown option " + name + " in the defaults of project " + options.Project)
+	}
+	return err
+}
+
+// enableChaos turns the failure injection on, before the clients are created
+func enableChaos(logger *zap.Logger) error {
+	if config.Env.ChaosErrorRate == 0 && config.Env.ChaosFlapRate == 0 && config.Env.ChaosMaxDelay == 0 {
+		return errors.New("--chaos requires CHAOS_ERROR_RATE, CHAOS_FLAP_RATE or CHAOS_MAX_DELAY to be set")
+	}
+	utils.SetChaos(config.Env.ChaosErrorRate, config.Env.ChaosFlapRate, config.Env.ChaosMaxDelay)
+	logger.Warn("Chaos mode: API errors, delays & readiness flaps are injected. Do not use it on production clusters")
+	return nil
 }
 
 func createNewk8sClient(logger *zap.Logger, kubeconfigPath string) (client *utils.K8sClient, err error) {
@@ -71,29 +241,845 @@ func main() {
 	logger, _ := zap.NewProduction()
 	defer logger.Sync()
 	printVersion(logger)
-	manifestPath, dryRun, targetLabel, canaryLabel, canary, namespace, testPackage, testBinary := gatherOptions()
-	printOptions(manifestPath, dryRun, targetLabel, canaryLabel, canary, namespace, testPackage, testBinary, logger)
-	kubernetesClient, err := createNewk8sClient(logger, "")
+	if err := config.Env.Validate(); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	utils.SetClientSettings("rooster/"+config.Env.DeployerVersion, config.Env.ClientQps, config.Env.ClientBurst)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "restore":
+			restore(logger, os.Args[2:])
+			return
+		case "nodes":
+			previewNodes(logger, os.Args[2:])
+			return
+		case "simulate":
+			simulate(logger, os.Args[2:])
+			return
+		case "config":
+			viewConfig(logger, os.Args[2:])
+			return
+		case "export":
+			export(logger, os.Args[2:])
+			return
+		case "import":
+			importInventory(logger, os.Args[2:])
+			return
+		case "reconcile":
+			reconcile(logger, os.Args[2:])
+			return
+		case "promote":
+			promote(logger, os.Args[2:])
+			return
+		case "undo":
+			undo(logger, os.Args[2:])
+			return
+		case "label-manifests":
+			labelManifests(logger, os.Args[2:])
+			return
+		case "report":
+			fleetReport(logger, os.Args[2:])
+			return
+		case "converge":
+			converge(logger, os.Args[2:])
+			return
+		case "promote-cluster":
+			promoteCluster(logger, os.Args[2:])
+			return
+		case "rollback":
+			rollback(logger, os.Args[2:])
+			return
+		case "skew":
+			checkSkew(logger, os.Args[2:])
+			return
+		case "project":
+			project(logger, os.Args[2:])
+			return
+		case "validate":
+			validate(logger, os.Args[2:])
+			return
+		case "check-pause":
+			checkPause(logger, os.Args[2:])
+			return
+		case "history":
+			history(logger, os.Args[2:])
+			return
+		}
+	}
+	options := bindOptions(flag.CommandLine)
+	flag.Parse()
+	resolver, kubeconfigPath, err := resolveOptions(logger, flag.CommandLine, options)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	worker.SetNonInteractive(options.NonInteractive)
+	if options.Chaos {
+		if err = enableChaos(logger); err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+	kubernetesClient, err := createNewk8sClient(logger, kubeconfigPath)
 	if err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
 	}
-	status := worker.ProceedToDeployment(kubernetesClient, logger, manifestPath, dryRun, targetLabel, canaryLabel, canary, namespace, testPackage, testBinary)
+	if options.Project != "" {
+		if err = applyProjectDefaults(logger, kubernetesClient, resolver, options); err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+	if err = worker.ApplyVersionFrom(logger, options); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	printOptions(*options, logger)
+	// Mixed-OS clusters: one rollout per OS pool, with the manifests of the pool
+	if pools := worker.OSPools(options.ManifestPath); len(pools) > 0 {
+		for _, nodeOS := range pools {
+			if ok := rolloutOSPool(logger, kubernetesClient, *options, nodeOS); !ok {
+				os.Exit(1)
+			}
+		}
+		return
+	}
+	status := worker.ProceedToDeployment(kubernetesClient, logger, *options)
 	if status {
 		return
 	}
-	revertResources := defineRevertNeed()
+	handleFailure(logger, kubernetesClient, *options)
+}
+
+// rolloutOSPool rolls the manifests of the operating system out to its nodes
+func rolloutOSPool(logger *zap.Logger, kubernetesClient *utils.K8sClient, options config.RoosterOptions, nodeOS string) bool {
+	poolOptions, cleanup, err := worker.OSPoolOptions(logger, options, nodeOS)
+	defer cleanup()
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	if status := worker.ProceedToDeployment(kubernetesClient, logger, poolOptions); status {
+		return true
+	}
+	handleFailure(logger, kubernetesClient, poolOptions)
+	return false
+}
+
+// handleFailure offers to revert a failed rollout, and reports the failure
+func handleFailure(logger *zap.Logger, kubernetesClient *utils.K8sClient, options config.RoosterOptions) {
+	revertResources := worker.Confirm(logger, config.RevertAction, "Should Rooster revert the recent changes?", options.AssumeYes)
 	if !revertResources {
 		logger.Info("Newly deployed resources are left untouched")
+		worker.ReportFailure(logger, options, false, false)
 		return
 	}
-	status = worker.RevertDeployment(kubernetesClient, logger, manifestPath, targetLabel, canaryLabel, namespace)
+	status := worker.RevertDeployment(kubernetesClient, logger, options)
 	logger.Info("Revert operation completion status: " + strconv.FormatBool(status))
+	worker.ReportFailure(logger, options, true, status)
+}
+
+func restore(logger *zap.Logger, args []string) {
+	backupDirectory, resource, err := gatherRestoreOptions(args)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if backupDirectory, err = worker.ResolveBackupDirectory(config.Env.BackupDirectory, backupDirectory); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	logger.Info("Backup directory: " + backupDirectory)
+	logger.Info("Resource: " + resource)
+	kubernetesClient, err := createNewk8sClient(logger, "")
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	status := worker.RestoreResource(kubernetesClient, logger, backupDirectory, resource)
+	logger.Info("Restore operation completion status: " + strconv.FormatBool(status))
+	if !status {
+		os.Exit(1)
+	}
+}
+
+func previewNodes(logger *zap.Logger, args []string) {
+	options, err := gatherNodesOptions(args)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	kubernetesClient, err := createNewk8sClient(logger, "")
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if status := worker.PreviewNodes(kubernetesClient, logger, options); !status {
+		os.Exit(1)
+	}
+}
+
+// validate runs the preflight validators of a rollout, and prints their results as JSON. Nothing is changed in the cluster
+func validate(logger *zap.Logger, args []string) {
+	validateFlags := flag.NewFlagSet("validate", flag.ExitOnError)
+	options := bindOptions(validateFlags)
+	if err := validateFlags.Parse(args); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	resolver, kubeconfigPath, err := resolveOptions(logger, validateFlags, options)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	kubernetesClient, err := createNewk8sClient(logger, kubeconfigPath)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if options.Project != "" {
+		if err = applyProjectDefaults(logger, kubernetesClient, resolver, options); err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+	if err = worker.ApplyVersionFrom(logger, options); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	results := worker.Preflight(kubernetesClient, logger, *options)
+	content, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	fmt.Println(string(content))
+	for _, result := range results {
+		if result.Status == worker.PreflightFail {
+			os.Exit(1)
+		}
+	}
+}
+
+// labelManifests writes the canary label state of the nodes as Node manifests, for GitOps: rooster label-manifests [--batch N] [--file F] [options]
+func labelManifests(logger *zap.Logger, args []string) {
+	manifestFlags := flag.NewFlagSet("label-manifests", flag.ExitOnError)
+	lastBatch := manifestFlags.Int("batch", -1, "Last batch to label, the canary batch being 0. Default: all the batches")
+	file := manifestFlags.String("file", "", "File the manifests are written to. Default: the standard output")
+	options := bindOptions(manifestFlags)
+	if err := manifestFlags.Parse(args); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	resolver, kubeconfigPath, err := resolveOptions(logger, manifestFlags, options)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	kubernetesClient, err := createNewk8sClient(logger, kubeconfigPath)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if options.Project != "" {
+		if err = applyProjectDefaults(logger, kubernetesClient, resolver, options); err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+	manifests, err := worker.NodeLabelManifests(kubernetesClient, logger, *options, *lastBatch)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if *file == "" {
+		fmt.Print(string(manifests))
+		return
+	}
+	if err = os.WriteFile(*file, manifests, 0644); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	logger.Info("Node manifests written to " + *file)
+}
+
+func simulate(logger *zap.Logger, args []string) {
+	nodeCount, zones, options, err := gatherSimulationOptions(args)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if status := worker.SimulateRollout(logger, nodeCount, zones, options); !status {
+		os.Exit(1)
+	}
+}
+
+// deploymentSettings lists the options & the environment settings, leaving out the flags specific to the subcommand
+func deploymentSettings(resolver *config.Resolver, subcommandFlags ...string) (settings []config.Setting) {
+	excluded := make(map[string]bool)
+	for _, name := range subcommandFlags {
+		excluded[name] = true
+	}
+	for _, setting := range append(resolver.Settings(), config.EnvSettings()...) {
+		if !excluded[setting.Name] {
+			settings = append(settings, setting)
+		}
+	}
+	return
+}
+
+// viewConfig prints the effective configuration: rooster config view [--resolved] [options]
+func viewConfig(logger *zap.Logger, args []string) {
+	if len(args) == 0 || args[0] != "view" {
+		logger.Error("Usage: rooster config view [--resolved] [options]")
+		os.Exit(1)
+	}
+	viewFlags := flag.NewFlagSet("config view", flag.ExitOnError)
+	showSources := viewFlags.Bool("resolved", false, "Print the source of each value")
+	options := bindOptions(viewFlags)
+	if err := viewFlags.Parse(args[1:]); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	resolver, kubeconfigPath, err := resolveOptions(logger, viewFlags, options)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if options.Project != "" {
+		kubernetesClient, err := createNewk8sClient(logger, kubeconfigPath)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		if err = applyProjectDefaults(logger, kubernetesClient, resolver, options); err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	// The resolved flag describes the view, not the deployment
+	for _, setting := range deploymentSettings(resolver, "resolved") {
+		if *showSources {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", setting.Name, setting.Value, setting.Source)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\n", setting.Name, setting.Value)
+	}
+	w.Flush()
+}
+
+// export prints everything Rooster knows about the project: rooster export --project X [--output yaml|json] [--file F] [options]
+func export(logger *zap.Logger, args []string) {
+	exportFlags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := exportFlags.String("output", "yaml", "Output format: yaml or json")
+	file := exportFlags.String("file", "", "File the inventory is written to. Default: the standard output")
+	options := bindOptions(exportFlags)
+	if err := exportFlags.Parse(args); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	resolver, kubeconfigPath, err := resolveOptions(logger, exportFlags, options)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	kubernetesClient, err := createNewk8sClient(logger, kubeconfigPath)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if options.Project != "" {
+		if err = applyProjectDefaults(logger, kubernetesClient, resolver, options); err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+	inventory, err := worker.ExportInventory(kubernetesClient, logger, *options, deploymentSettings(resolver, "output", "file"))
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	content, err := inventory.Marshal(*format)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if *file == "" {
+		fmt.Println(string(content))
+		return
+	}
+	if err = os.WriteFile(*file, content, 0600); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	logger.Info("Inventory written to " + *file)
+}
+
+// importInventory rebuilds the state of a project from an export: rooster import --file F [--label-nodes] [--dry-run]
+func importInventory(logger *zap.Logger, args []string) {
+	importFlags := flag.NewFlagSet("import", flag.ExitOnError)
+	file := importFlags.String("file", "", "Inventory to import, as written by rooster export")
+	labelNodes := importFlags.Bool("label-nodes", false, "Put the canary label back on the nodes that carried it")
+	dryRun := importFlags.Bool("dry-run", false, "dry-run usage")
+	configProfile := importFlags.String("config-profile", "", "Profile of the user config file to use")
+	if err := importFlags.Parse(args); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	inventory, err := worker.ReadInventory(*file)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	_, kubeconfigPath, err := resolveOptions(logger, importFlags, &config.RoosterOptions{ConfigProfile: *configProfile})
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	kubernetesClient, err := createNewk8sClient(logger, kubeconfigPath)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	status := worker.ImportInventory(kubernetesClient, logger, inventory, *labelNodes, *dryRun)
+	logger.Info("Import operation completion status: " + strconv.FormatBool(status))
+	if !status {
+		os.Exit(1)
+	}
+}
+
+// reconcile extends the deployed version to the new target nodes: rooster reconcile [--interval 5m] [options]
+func reconcile(logger *zap.Logger, args []string) {
+	reconcileFlags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	interval := reconcileFlags.Duration("interval", 0, "Time between two reconciliations. 0: reconcile once")
+	options := bindOptions(reconcileFlags)
+	if err := reconcileFlags.Parse(args); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	resolver, kubeconfigPath, err := resolveOptions(logger, reconcileFlags, options)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	kubernetesClient, err := createNewk8sClient(logger, kubeconfigPath)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if options.Project != "" {
+		if err = applyProjectDefaults(logger, kubernetesClient, resolver, options); err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+	if status := worker.ReconcileNodes(kubernetesClient, logger, *options, *interval); !status {
+		os.Exit(1)
+	}
+}
+
+// promote patches the remaining nodes of a rollout stopped after its canary batch: rooster promote [options]
+func promote(logger *zap.Logger, args []string) {
+	promoteFlags := flag.NewFlagSet("promote", flag.ExitOnError)
+	options := bindOptions(promoteFlags)
+	if err := promoteFlags.Parse(args); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	resolver, kubeconfigPath, err := resolveOptions(logger, promoteFlags, options)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	kubernetesClient, err := createNewk8sClient(logger, kubeconfigPath)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if options.Project != "" {
+		if err = applyProjectDefaults(logger, kubernetesClient, resolver, options); err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+	if err = worker.ApplyVersionFrom(logger, options); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	printOptions(*options, logger)
+	if status := worker.PromoteRollout(kubernetesClient, logger, *options); status {
+		return
+	}
+	handleFailure(logger, kubernetesClient, *options)
+	os.Exit(1)
+}
+
+// checkPause rolls back, or completes, the rollout paused after its canary batch for longer than --max-pause. Meant to be run on a schedule
+func checkPause(logger *zap.Logger, args []string) {
+	pauseFlags := flag.NewFlagSet("check-pause", flag.ExitOnError)
+	options := bindOptions(pauseFlags)
+	if err := pauseFlags.Parse(args); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	resolver, kubeconfigPath, err := resolveOptions(logger, pauseFlags, options)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	kubernetesClient, err := createNewk8sClient(logger, kubeconfigPath)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if options.Project != "" {
+		if err = applyProjectDefaults(logger, kubernetesClient, resolver, options); err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+	if status := worker.EnforcePauseDeadline(kubernetesClient, logger, *options); !status {
+		os.Exit(1)
+	}
+}
+
+// undo restores the state saved before the last destructive operation: rooster undo [--dry-run]
+func undo(logger *zap.Logger, args []string) {
+	undoFlags := flag.NewFlagSet("undo", flag.ExitOnError)
+	dryRun := undoFlags.Bool("dry-run", false, "dry-run usage")
+	assumeYes := undoFlags.Bool("yes", false, "Answer yes to the confirmation, when the confirmation policy asks for one")
+	configProfile := undoFlags.String("config-profile", "", "Profile of the user config file to use")
+	if err := undoFlags.Parse(args); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	_, kubeconfigPath, err := resolveOptions(logger, undoFlags, &config.RoosterOptions{ConfigProfile: *configProfile})
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	kubernetesClient, err := createNewk8sClient(logger, kubeconfigPath)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if !*dryRun && !worker.Confirm(logger, config.UndoAction, "Undo the last destructive operation?", *assumeYes) {
+		logger.Info("Nothing was undone")
+		return
+	}
+	status := worker.UndoLastOperation(kubernetesClient, logger, *dryRun)
+	logger.Info("Undo operation completion status: " + strconv.FormatBool(status))
+	if !status {
+		os.Exit(1)
+	}
+}
+
+func fleetReport(logger *zap.Logger, args []string) {
+	reportFlags := flag.NewFlagSet("report", flag.ExitOnError)
+	fleetFile := reportFlags.String("fleet", "", "Fleet file listing the clusters, and the desired version of each project")
+	format := reportFlags.String("output", "table", "Output format: table, yaml or json")
+	if err := reportFlags.Parse(args); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if *fleetFile == "" {
+		logger.Error("Usage: rooster report --fleet fleet.yaml")
+		os.Exit(1)
+	}
+	fleet, err := worker.LoadFleet(*fleetFile)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	report := worker.FleetComplianceReport(logger, fleet)
+	content, err := report.Marshal(*format)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	fmt.Println(string(content))
+	if lagging := report.Lagging(); len(lagging) > 0 {
+		logger.Warn(strconv.Itoa(len(lagging)) + " project deployments lag behind the desired version")
+	}
+}
+
+// converge rolls out the desired version of the projects to the clusters lagging behind, one rollout after the other.
+// The first failed rollout stops the convergence
+// history sums up the rollouts recorded in the events file, per version: rooster history --events-file F [--canary-label key[=value]]
+func history(logger *zap.Logger, args []string) {
+	historyFlags := flag.NewFlagSet("history", flag.ExitOnError)
+	eventsFile := historyFlags.String("events-file", "", "NDJSON file the rollout events were appended to")
+	canaryLabel := historyFlags.String("canary-label", "", "Canary label, or canary label key, of the versions to show. Default: all")
+	format := historyFlags.String("output", "table", "Output format: table, yaml or json")
+	if err := historyFlags.Parse(args); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if *eventsFile == "" {
+		logger.Error("Usage: rooster history --events-file events.ndjson")
+		os.Exit(1)
+	}
+	rolloutHistory, err := worker.ReadRolloutHistory(*eventsFile, *canaryLabel)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if rolloutHistory.Skipped > 0 {
+		logger.Warn(strconv.Itoa(rolloutHistory.Skipped) + " events carry no canary label, and were left out: they were recorded by an older version of Rooster")
+	}
+	content, err := rolloutHistory.Marshal(*format)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	fmt.Println(string(content))
+}
+
+func converge(logger *zap.Logger, args []string) {
+	convergeFlags := flag.NewFlagSet("converge", flag.ExitOnError)
+	fleetFile := convergeFlags.String("fleet", "", "Fleet file listing the clusters, and the desired version of each project per environment")
+	clusterName := convergeFlags.String("cluster", "", "Only converge this cluster of the fleet")
+	dryRun := convergeFlags.Bool("dry-run", false, "dry-run usage")
+	if err := convergeFlags.Parse(args); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if *fleetFile == "" {
+		logger.Error("Usage: rooster converge --fleet fleet.yaml")
+		os.Exit(1)
+	}
+	fleet, err := worker.LoadFleet(*fleetFile)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	updates := worker.PlanConvergence(logger, fleet, *clusterName)
+	if len(updates) == 0 {
+		logger.Info("The fleet runs the desired versions")
+		return
+	}
+	for _, update := range updates {
+		if status := rolloutFleetUpdate(logger, update, *dryRun); !status {
+			os.Exit(1)
+		}
+	}
+	logger.Info("The fleet converged to the desired versions")
+}
+
+// rolloutFleetUpdate rolls the version of the update out to its cluster, or promotes the rollout in progress
+func rolloutFleetUpdate(logger *zap.Logger, update worker.FleetUpdate, dryRun bool) bool {
+	logger.Info("Rolling out " + update.CanaryLabel + " of project " + update.Project + " to cluster " + update.Cluster.Name)
+	kubernetesClient, err := worker.UseFleetCluster(update.Cluster)
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	// The rollout is set up like on the command line, the project defaults filling in the other options
+	rolloutFlags := flag.NewFlagSet("rollout "+update.Project, flag.ExitOnError)
+	options := bindOptions(rolloutFlags)
+	rolloutArgs := []string{"--project", update.Project, "--canary-label", update.CanaryLabel, "--manifest-path", update.ManifestPath, "--dry-run=" + strconv.FormatBool(dryRun)}
+	if err = rolloutFlags.Parse(rolloutArgs); err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	resolver, _, err := resolveOptions(logger, rolloutFlags, options)
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	if err = applyProjectDefaults(logger, kubernetesClient, resolver, options); err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	printOptions(*options, logger)
+	var status bool
+	if update.Promote {
+		status = worker.PromoteRollout(kubernetesClient, logger, *options)
+	} else {
+		status = worker.ProceedToDeployment(kubernetesClient, logger, *options)
+	}
+	if !status {
+		handleFailure(logger, kubernetesClient, *options)
+	}
+	return status
+}
+
+// promoteCluster rolls the version a project runs in a cluster out to another one: rooster promote-cluster --from <context> --to <context> --project <project>
+func promoteCluster(logger *zap.Logger, args []string) {
+	promotionFlags := flag.NewFlagSet("promote-cluster", flag.ExitOnError)
+	from := promotionFlags.String("from", "", "Context of the source cluster, whose version is promoted")
+	to := promotionFlags.String("to", "", "Context of the destination cluster")
+	kubeconfig := promotionFlags.String("kubeconfig", "", "Kubeconfig holding both contexts. Default: the kubeconfig of the environment")
+	projectName := promotionFlags.String("project", "", "Project to promote")
+	manifestPath := promotionFlags.String("manifest-path", "", "Manifests of the version. Default: the manifests of the version, as backed up when it was rolled out")
+	dryRun := promotionFlags.Bool("dry-run", false, "dry-run usage")
+	if err := promotionFlags.Parse(args); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if *from == "" || *to == "" || *projectName == "" {
+		logger.Error("Usage: rooster promote-cluster --from <context> --to <context> --project <project> [--manifest-path <path>] [--dry-run]")
+		os.Exit(1)
+	}
+	source := worker.FleetCluster{Name: *from, Context: *from, Kubeconfig: *kubeconfig}
+	destination := worker.FleetCluster{Name: *to, Context: *to, Kubeconfig: *kubeconfig}
+	update, err := worker.PlanClusterPromotion(logger, source, destination, *projectName, *manifestPath)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if update == nil {
+		return
+	}
+	if status := rolloutFleetUpdate(logger, *update, *dryRun); !status {
+		os.Exit(1)
+	}
+	logger.Info("Version " + update.CanaryLabel + " of project " + *projectName + " promoted from cluster " + *from + " to cluster " + *to)
+}
+
+// rollback reverts the rollouts of the projects, as set up in their project defaults
+func rollback(logger *zap.Logger, args []string) {
+	rollbackFlags := flag.NewFlagSet("rollback", flag.ExitOnError)
+	projectList := rollbackFlags.String("projects", "", "Projects to revert, in order. Comma-separated")
+	coordinated := rollbackFlags.Bool("coordinated", false, "Remove the canary labels of all the projects before reverting their resources")
+	assumeYes := rollbackFlags.Bool("yes", false, "Answer yes to the confirmation, when the confirmation policy asks for one")
+	configProfile := rollbackFlags.String("config-profile", "", "Profile of the user config file to use")
+	if err := rollbackFlags.Parse(args); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if *projectList == "" {
+		logger.Error("Usage: rooster rollback --projects a,b [--coordinated]")
+		os.Exit(1)
+	}
+	_, kubeconfigPath, err := resolveOptions(logger, rollbackFlags, &config.RoosterOptions{ConfigProfile: *configProfile})
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	kubernetesClient, err := createNewk8sClient(logger, kubeconfigPath)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	projects := []config.RoosterOptions{}
+	for _, project := range strings.Split(*projectList, ",") {
+		projectFlags := flag.NewFlagSet("rollback "+project, flag.ExitOnError)
+		options := bindOptions(projectFlags)
+		if err = projectFlags.Parse([]string{"--project", strings.TrimSpace(project), "--config-profile", *configProfile}); err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		resolver, _, err := resolveOptions(logger, projectFlags, options)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		if err = applyProjectDefaults(logger, kubernetesClient, resolver, options); err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		if options.CanaryLabel == "" || options.TargetLabel == "" || options.ManifestPath == "" {
+			logger.Error("The defaults of project " + options.Project + " miss the canary label, the target label or the manifest path")
+			os.Exit(1)
+		}
+		projects = append(projects, *options)
+	}
+	if !worker.Confirm(logger, config.RevertAction, "Revert projects "+*projectList+"?", *assumeYes) {
+		logger.Info("The projects are left untouched")
+		return
+	}
+	if status := worker.RevertProjects(kubernetesClient, logger, projects, *coordinated); !status {
+		os.Exit(1)
+	}
+}
+
+func checkSkew(logger *zap.Logger, args []string) {
+	skewFlags := flag.NewFlagSet("skew", flag.ExitOnError)
+	interval := skewFlags.Duration("interval", 0, "Time between two checks. 0: check once")
+	options := bindOptions(skewFlags)
+	if err := skewFlags.Parse(args); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	resolver, kubeconfigPath, err := resolveOptions(logger, skewFlags, options)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	kubernetesClient, err := createNewk8sClient(logger, kubeconfigPath)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if options.Project != "" {
+		if err = applyProjectDefaults(logger, kubernetesClient, resolver, options); err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+	if status := worker.CheckVersionSkew(kubernetesClient, logger, *options, *interval); !status {
+		os.Exit(1)
+	}
 }
 
-func defineRevertNeed() bool {
-	var response string
-	fmt.Println("Should Rooster revert the recent changes? (y/n)")
-	fmt.Scanln(&response)
-	return strings.EqualFold(response, "Y")
+// project manages the projects whose defaults are stored in-cluster. Subcommands: rename, delete
+func project(logger *zap.Logger, args []string) {
+	if len(args) == 0 {
+		logger.Error("Missing project subcommand. Usage: rooster project rename [--dry-run] <old> <new>, or rooster project delete [--dry-run] --project <project>")
+		os.Exit(1)
+	}
+	projectFlags := flag.NewFlagSet("project "+args[0], flag.ExitOnError)
+	dryRun := projectFlags.Bool("dry-run", false, "dry-run usage")
+	assumeYes := projectFlags.Bool("yes", false, "Answer yes to the confirmation, when the confirmation policy asks for one")
+	configProfile := projectFlags.String("config-profile", "", "Profile of the user config file to use")
+	deletion := worker.ProjectDeletion{}
+	projectName := projectFlags.String("project", "", "Project to delete")
+	projectFlags.StringVar(&deletion.ManifestPath, "manifest-path", "", "Manifests of the resources of the project. Default: the manifest path of the project")
+	projectFlags.BoolVar(&deletion.DeleteResources, "delete-resources", false, "Delete the resources of the project. They can be restored with rooster undo")
+	projectFlags.BoolVar(&deletion.PruneBackups, "prune-backups", false, "Delete the backups of the resources of the project")
+	if err := projectFlags.Parse(args[1:]); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	_, kubeconfigPath, err := resolveOptions(logger, projectFlags, &config.RoosterOptions{ConfigProfile: *configProfile})
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	kubernetesClient, err := createNewk8sClient(logger, kubeconfigPath)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	var status bool
+	switch args[0] {
+	case "rename":
+		if projectFlags.NArg() != 2 {
+			logger.Error("Usage: rooster project rename [--dry-run] <old> <new>")
+			os.Exit(1)
+		}
+		status = worker.RenameProject(kubernetesClient, logger, projectFlags.Arg(0), projectFlags.Arg(1), *dryRun)
+	case "delete":
+		if *projectName == "" {
+			logger.Error("Usage: rooster project delete [--dry-run] [--delete-resources] [--prune-backups] --project <project>")
+			os.Exit(1)
+		}
+		deletion.DryRun = *dryRun
+		if !*dryRun && !worker.Confirm(logger, config.ProjectDeletionAction, "Delete project "+*projectName+"?", *assumeYes) {
+			logger.Info("Project " + *projectName + " is left untouched")
+			return
+		}
+		status = worker.DeleteProject(kubernetesClient, logger, *projectName, deletion)
+	default:
+		logger.Error("Unknown project subcommand " + args[0] + ". Expected: rename or delete")
+		os.Exit(1)
+	}
+	logger.Info("Project " + args[0] + " operation completion status: " + strconv.FormatBool(status))
+	if !status {
+		os.Exit(1)
+	}
 }
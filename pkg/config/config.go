@@ -17,21 +17,229 @@ limitations under the License.
 package config
 
 import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
 	"github.com/kelseyhightower/envconfig"
 	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Apply modes of the manifests
+const (
+	AutoApply       = "auto"
+	ServerSideApply = "server-side"
+	ClientSideApply = "client-side"
 )
 
 type Config struct {
 	DeployerVersion string `default:"1.0.0" split_words:"true"`
-	BackupDirectory string `default:"/tmp/backup_for_canary"`
+	// Field manager owning the fields applied by Rooster (server-side apply)
+	FieldManager string `default:"rooster" split_words:"true"`
+	// How the manifests are applied: server-side, client-side, or auto, probing server-side apply first
+	ApplyMode string `default:"auto" split_words:"true"`
+	// Namespace of the rooster-project-<project> ConfigMaps
+	ProjectNamespace string `default:"kube-system" split_words:"true"`
+	// YAML file mapping custom kinds to readiness expressions
+	ReadinessRulesFile string `split_words:"true"`
+	// YAML file listing the prerequisites nodes must meet before being patched
+	NodeConformanceFile string `split_words:"true"`
+	// YAML file restricting the identities of the tenants to their namespaces & node selectors
+	TenantPolicyFile string `split_words:"true"`
+	// Identity recorded as the initiator of the rollouts. Left empty, it is deduced from the CI job or the OS user
+	Initiator string
+	// Left empty, the backup directory is placed under the OS specific data directory
+	BackupDirectory string
+	// Rate limits of the API clients. 0: client-go defaults
+	ClientQps   float32 `split_words:"true"`
+	ClientBurst int     `split_words:"true"`
+	// Pause between two node patches, spreading large batches over time
+	PatchInterval time.Duration `split_words:"true"`
+	// How long the patched nodes are given to show the canary label, and the time left to the scheduler afterwards
+	LabelCheckTimeout time.Duration `default:"30s" split_words:"true"`
+	LabelSettleTime   time.Duration `default:"5s" split_words:"true"`
+	// How long the nodes of a batch are given to run a ready pod of every DaemonSet, before they count as failed
+	BatchBarrierTimeout time.Duration `default:"5m" split_words:"true"`
+	// How long the nodes are given to advertise their devices again, once their device plugin is updated
+	DeviceResourceTimeout time.Duration `default:"2m" split_words:"true"`
+	// Public key the signatures of the test binaries are verified with: file, or KMS URI, as understood by cosign
+	TestBinaryPublicKey string `split_words:"true"`
+	// Network probes: image run on the patched nodes, namespace it runs in, optional URL it must reach, and time it is given
+	NetworkProbeImage     string        `default:"busybox:1.36" split_words:"true"`
+	NetworkProbeNamespace string        `default:"default" split_words:"true"`
+	NetworkProbeUrl       string        `split_words:"true"`
+	NetworkProbeTimeout   time.Duration `default:"1m" split_words:"true"`
+	// How long the health gates are polled after each batch, and the pause between two polls
+	HealthGateTimeout  time.Duration `default:"2m" split_words:"true"`
+	HealthGateInterval time.Duration `default:"5s" split_words:"true"`
+	// Actions confirmed without asking, or declined: action=answer pairs, the answer being prompt, yes or no
+	ConfirmationPolicy string `split_words:"true"`
+	// Webhook the failure reports are posted to, e.g. the GitHub issues API. Template: Go template of the payload
+	FailureWebhookUrl      string `split_words:"true"`
+	FailureWebhookTemplate string `split_words:"true"`
+	FailureWebhookToken    string `split_words:"true" sensitive:"true"`
+	// Bearer token sent to the external strategy, when it is a webhook
+	StrategyWebhookToken string `split_words:"true" sensitive:"true"`
+	// Namespace annotation listing the contacts of a tenant, and the webhook they are notified through before their nodes are patched
+	TenantContactAnnotation string `default:"rooster/contact" split_words:"true"`
+	TenantWebhookUrl        string `split_words:"true"`
+	TenantWebhookToken      string `split_words:"true" sensitive:"true"`
+	// Prometheus API the canary selection queries are run against. NodeLabel: label of the series holding the node name
+	PrometheusUrl       string `split_words:"true"`
+	PrometheusToken     string `split_words:"true" sensitive:"true"`
+	PrometheusNodeLabel string `default:"node" split_words:"true"`
+	// Time during which a destructive operation can be undone. Older snapshots are deleted
+	SnapshotRetention time.Duration `default:"24h" split_words:"true"`
+	// Failure injection of --chaos, for test clusters: share of the API requests failed, share of the readiness checks flapping,
+	// and longest delay added to the API requests. --chaos is refused while all are 0
+	ChaosErrorRate float64       `split_words:"true"`
+	ChaosFlapRate  float64       `split_words:"true"`
+	ChaosMaxDelay  time.Duration `split_words:"true"`
+	// Labels, annotations or taints marking the nodes under maintenance, or about to be removed: key or key=value, comma separated.
+	// Such nodes are left out of the batches
+	MaintenanceMarkers string `default:"ToBeDeletedByClusterAutoscaler,DeletionCandidateOfClusterAutoscaler" split_words:"true"`
+	// Node label rating the criticality of a node: low, medium or high. Weighs in the risk score of the batches
+	CriticalityLabel string `default:"rooster/criticality" split_words:"true"`
 }
 
 var Env Config
 
+// Error met while reading the environment. Reported by Validate
+var processErr error
+
 func init() {
 	logger, _ := zap.NewProduction()
 	defer logger.Sync()
 	if err := envconfig.Process("", &Env); err != nil {
 		logger.Error(err.Error())
+		processErr = err
+	}
+	if Env.BackupDirectory == "" {
+		Env.BackupDirectory = defaultBackupDirectory()
+	}
+}
+
+func defaultBackupDirectory() string {
+	// Windows: %LOCALAPPDATA%. Others: $XDG_DATA_HOME
+	dataDirectory := os.Getenv("XDG_DATA_HOME")
+	if runtime.GOOS == "windows" {
+		dataDirectory = os.Getenv("LOCALAPPDATA")
+	}
+	if dataDirectory == "" {
+		return filepath.Join(os.TempDir(), "backup_for_canary")
+	}
+	return filepath.Join(dataDirectory, "rooster", "backup_for_canary")
+}
+
+// Validate checks the settings, so that invalid values are reported at startup rather than midway through a rollout
+func (c Config) Validate() error {
+	var problems []string
+	if processErr != nil {
+		problems = append(problems, processErr.Error())
+	}
+	if c.FieldManager == "" || len(c.FieldManager) > 128 {
+		problems = append(problems, envName("FieldManager")+": the field manager must be 1 to 128 characters long")
+	}
+	switch c.ApplyMode {
+	case AutoApply, ServerSideApply, ClientSideApply:
+	default:
+		problems = append(problems, envName("ApplyMode")+": "+c.ApplyMode+" is not an apply mode. Expected "+AutoApply+", "+ServerSideApply+" or "+ClientSideApply)
+	}
+	for _, message := range validation.IsDNS1123Label(c.ProjectNamespace) {
+		problems = append(problems, envName("ProjectNamespace")+": "+c.ProjectNamespace+" is not a valid namespace: "+message)
+	}
+	for _, message := range validation.IsDNS1123Label(c.NetworkProbeNamespace) {
+		problems = append(problems, envName("NetworkProbeNamespace")+": "+c.NetworkProbeNamespace+" is not a valid namespace: "+message)
+	}
+	files := map[string]string{"ReadinessRulesFile": c.ReadinessRulesFile, "NodeConformanceFile": c.NodeConformanceFile, "TenantPolicyFile": c.TenantPolicyFile, "FailureWebhookTemplate": c.FailureWebhookTemplate}
+	for fieldName, file := range files {
+		if file == "" {
+			continue
+		}
+		if info, err := os.Stat(file); err != nil || info.IsDir() {
+			problems = append(problems, envName(fieldName)+": "+file+" is not a readable file. Unset the variable or point it to an existing file")
+		}
+	}
+	if c.ClientQps < 0 || c.ClientBurst < 0 || c.PatchInterval < 0 || c.LabelSettleTime < 0 {
+		problems = append(problems, envName("ClientQps")+", "+envName("ClientBurst")+", "+envName("PatchInterval")+" and "+envName("LabelSettleTime")+" cannot be negative")
+	}
+	if c.LabelCheckTimeout <= 0 {
+		problems = append(problems, envName("LabelCheckTimeout")+" must be positive")
+	}
+	if c.BatchBarrierTimeout <= 0 {
+		problems = append(problems, envName("BatchBarrierTimeout")+" must be positive")
+	}
+	if c.NetworkProbeTimeout <= 0 {
+		problems = append(problems, envName("NetworkProbeTimeout")+" must be positive")
+	}
+	if c.HealthGateTimeout <= 0 || c.HealthGateInterval <= 0 {
+		problems = append(problems, envName("HealthGateTimeout")+" and "+envName("HealthGateInterval")+" must be positive")
+	}
+	if c.DeviceResourceTimeout <= 0 {
+		problems = append(problems, envName("DeviceResourceTimeout")+" must be positive")
+	}
+	if c.SnapshotRetention <= 0 {
+		problems = append(problems, envName("SnapshotRetention")+" must be positive")
+	}
+	webhooks := map[string]string{"FailureWebhookUrl": c.FailureWebhookUrl, "TenantWebhookUrl": c.TenantWebhookUrl, "PrometheusUrl": c.PrometheusUrl}
+	for fieldName, webhookUrl := range webhooks {
+		if webhookUrl == "" {
+			continue
+		}
+		if webhook, err := url.Parse(webhookUrl); err != nil || webhook.Scheme == "" || webhook.Host == "" {
+			problems = append(problems, envName(fieldName)+": "+webhookUrl+" is not a valid URL")
+		}
+	}
+	for _, message := range validation.IsQualifiedName(c.TenantContactAnnotation) {
+		problems = append(problems, envName("TenantContactAnnotation")+": "+c.TenantContactAnnotation+" is not a valid annotation key: "+message)
+	}
+	for _, marker := range strings.Split(c.MaintenanceMarkers, ",") {
+		key, _, _ := strings.Cut(strings.TrimSpace(marker), "=")
+		if key == "" {
+			continue
+		}
+		for _, message := range validation.IsQualifiedName(key) {
+			problems = append(problems, envName("MaintenanceMarkers")+": "+key+" is not a valid key: "+message)
+		}
+	}
+	for _, message := range validation.IsQualifiedName(c.CriticalityLabel) {
+		problems = append(problems, envName("CriticalityLabel")+": "+c.CriticalityLabel+" is not a valid label key: "+message)
+	}
+	if c.ChaosErrorRate < 0 || c.ChaosErrorRate > 1 || c.ChaosFlapRate < 0 || c.ChaosFlapRate > 1 {
+		problems = append(problems, envName("ChaosErrorRate")+" and "+envName("ChaosFlapRate")+" must be between 0 and 1")
+	}
+	if c.ChaosMaxDelay < 0 {
+		problems = append(problems, envName("ChaosMaxDelay")+" cannot be negative")
+	}
+	if _, err := parseConfirmationPolicy(c.ConfirmationPolicy); err != nil {
+		problems = append(problems, envName("ConfirmationPolicy")+": "+err.Error())
+	}
+	if err := checkWritableDirectory(c.BackupDirectory); err != nil {
+		problems = append(problems, envName("BackupDirectory")+": "+err.Error()+". Point it to a writable directory")
+	}
+	if len(problems) > 0 {
+		return errors.New("invalid configuration:\n" + strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// checkWritableDirectory creates the directory when missing, and makes sure files can be written to it
+func checkWritableDirectory(directory string) error {
+	if directory == "" {
+		return errors.New("the directory is not set")
+	}
+	if err := os.MkdirAll(directory, os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(directory, ".rooster_write_check_*")
+	if err != nil {
+		return err
 	}
+	f.Close()
+	return os.Remove(f.Name())
 }
@@ -0,0 +1,90 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Actions that may ask for a confirmation
+const (
+	// Roll out although nodes carry the canary label already
+	ExistingCanaryAction = "existing-canary"
+	// Revert a failed rollout
+	RevertAction = "revert"
+	// Delete a project
+	ProjectDeletionAction = "project-delete"
+	// Undo the last destructive operation
+	UndoAction = "undo"
+)
+
+// Answers of the confirmation policy. Prompt: the user is asked
+const (
+	PromptAnswer = "prompt"
+	YesAnswer    = "yes"
+	NoAnswer     = "no"
+)
+
+// Answer of each action when the policy does not mention it
+var defaultConfirmations = map[string]string{
+	ExistingCanaryAction:  PromptAnswer,
+	RevertAction:          PromptAnswer,
+	ProjectDeletionAction: PromptAnswer,
+	UndoAction:            YesAnswer,
+}
+
+// Confirmation returns how the action is confirmed: prompt, yes or no
+func (c Config) Confirmation(action string) string {
+	policy, err := parseConfirmationPolicy(c.ConfirmationPolicy)
+	if err != nil {
+		// Reported by Validate. Asking is the safe choice
+		return PromptAnswer
+	}
+	return policy[action]
+}
+
+// parseConfirmationPolicy reads action=answer pairs, separated by commas, over the default answers
+func parseConfirmationPolicy(policy string) (map[string]string, error) {
+	answers := make(map[string]string, len(defaultConfirmations))
+	for action, answer := range defaultConfirmations {
+		answers[action] = answer
+	}
+	if policy == "" {
+		return answers, nil
+	}
+	for _, pair := range strings.Split(policy, ",") {
+		action, answer, _ := strings.Cut(strings.TrimSpace(pair), "=")
+		if _, known := defaultConfirmations[action]; !known {
+			return nil, errors.New("unknown action " + action + ". Expected: " + strings.Join(confirmationActions(), ", "))
+		}
+		if answer != PromptAnswer && answer != YesAnswer && answer != NoAnswer {
+			return nil, errors.New("invalid answer " + answer + " for action " + action + ". Expected: prompt, yes or no")
+		}
+		answers[action] = answer
+	}
+	return answers, nil
+}
+
+func confirmationActions() (actions []string) {
+	for action := range defaultConfirmations {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	return
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import "time"
+
+// RoosterOptions holds the options of a rollout, as indicated on the command line
+type RoosterOptions struct {
+	// YAML file declaring the options of the rollout
+	ConfigFile string
+	// Profile of the user config file
+	ConfigProfile string
+	// Project whose defaults are stored in-cluster
+	Project string
+	// Create the project ConfigMap when missing
+	Initialize   bool
+	ManifestPath string
+	DryRun       bool
+	TargetLabel  string
+	CanaryLabel  string
+	Canary       int
+	Namespace    string
+	TestPackage  string
+	TestBinary   string
+	// Ordered test suites run between the batches. name=package[,policy[,stage]]. Replace the test package
+	TestSuites []string
+	// NAME=provider:reference. Resolved values are passed to the tests as environment variables
+	TestSecrets []string
+	// KEY=VALUE pairs passed to the tests. Without the inherited environment, the tests only get PATH, HOME & the explicit variables
+	TestEnv         []string
+	TestInheritEnv  bool
+	TestWorkdir     string
+	CanaryPoolLabel string
+	Profile         string
+	// Time after which the canary label of an uncompleted rollout is removed by the next run. 0: no expiry
+	CanaryLabelTTL time.Duration
+	// Where the version, i.e. the value of the canary label, is derived from: image. Empty: the value of the canary label as given
+	VersionFrom string
+	// Record the project, the version & the batch on the patched nodes, for the node-local agents
+	AnnotateNodes bool
+	// Linear increments, in percentage. Replace the increments of the profile
+	Increment int
+	// Command, or HTTP(S) URL, deciding the increments one at a time. Replaces the increments of the profile
+	ExternalStrategy string
+	Overlay          string
+	// CEL expression over the batch signals. Replaces the built-in readiness & test gates
+	SuccessCriteria string
+	// Missing resources are skipped when reverting. Otherwise they fail the revert
+	IgnoreNotFound bool
+	// Strip the data of Secrets from the backups
+	RedactSecrets bool
+	// Skip the snapshot of the live resources taken before they are deleted
+	NoBackup bool
+	// Checksum & cosign signature the test binary is verified against
+	TestBinarySha256    string
+	TestBinarySignature string
+	// ConfigMap the test target is written to, for the tests running in the cluster
+	TestTargetConfigMap string
+	// Check the pod network & the DNS on the patched nodes, batch after batch
+	NetworkProbe bool
+	// Endpoints polled after each batch until healthy: API server paths or HTTP(S) URLs. {node} is replaced with each node of the batch
+	HealthGates []string
+	// NDJSON file the rollout state transitions are appended to
+	EventsFile string
+	// Preflight findings output
+	FindingsFormat string
+	FindingsFile   string
+	// namespace=context:<name> or namespace=serviceaccount:<namespace>/<name> pairs. Identity the resources of the namespace are applied with
+	NamespaceIdentities string
+	// Namespace creation
+	CreateNamespace      bool
+	NamespaceLabels      string
+	NamespaceAnnotations string
+	// Notify the owners of the namespaces running on a batch before it is patched
+	NotifyTenants bool
+	// Patch the least risky nodes first
+	OrderByRisk bool
+	// Prometheus query returning a value per node. The canary nodes are the ones with the least, or the most, following the policy
+	CanarySelectionQuery  string
+	CanarySelectionPolicy string
+	// Time the canary batch is held and analysed before the rollout continues
+	CanaryHold time.Duration
+	// Stop after the canary batch. The remaining nodes are patched by rooster promote
+	CanaryOnly bool
+	// Longest pause after the canary batch (--canary-only, or --canary-hold), before the rollout is rolled back or completed, following OnMaxPause. 0: no limit
+	MaxPause   time.Duration
+	OnMaxPause string
+	// Answer yes to the confirmations the policy leaves to the user
+	AssumeYes bool
+	// Never ask the user: the confirmations the policy leaves to the user are answered no, unless AssumeYes is set
+	NonInteractive bool
+	// What to do when nodes carry the canary label already: abort or continue. Empty: confirmation policy, or prompt
+	OnExistingCanary string
+	// Nodes of the rollout tolerated not to get ready. They are left out of the readiness checks that follow
+	MaxNodeFailures int
+	// Inject API errors, delays & readiness flaps, as set by the CHAOS_* variables. For test clusters only
+	Chaos bool
+	// Version skew policy: versions the target nodes may run at once, and how long a partial rollout may cover more than
+	// a share of them, in percentage. 0: no limit
+	MaxVersions        int
+	MaxPartialCoverage int
+	MaxPartialDuration time.Duration
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Source tells where the value of a setting comes from
+type Source string
+
+const (
+	SourceFlag        Source = "flag"
+	SourceEnv         Source = "env"
+	SourceRolloutFile Source = "rollout file"
+	SourceConfigFile  Source = "config file"
+	SourceProject     Source = "project"
+	SourceDefault     Source = "default"
+)
+
+// Setting is the effective value of an option, and its source
+type Setting struct {
+	Name   string
+	Value  string
+	Source Source
+}
+
+// Resolver sets the options of a flag set from the configuration sources.
+// Sources are applied by decreasing precedence: flags > env > rollout file > config file > project > defaults
+type Resolver struct {
+	flags   *flag.FlagSet
+	sources map[string]Source
+}
+
+// NewResolver starts the resolution from the options indicated on the command line. The flag set must be parsed
+func NewResolver(flags *flag.FlagSet) *Resolver {
+	resolver := &Resolver{flags: flags, sources: make(map[string]Source)}
+	flags.Visit(func(f *flag.Flag) {
+		resolver.sources[f.Name] = SourceFlag
+	})
+	return resolver
+}
+
+// Apply sets the options that are not resolved yet. Unknown options are returned, and left aside
+func (r *Resolver) Apply(source Source, values map[string]string) (unknown []string, err error) {
+	for name, value := range values {
+		if r.flags.Lookup(name) == nil {
+			unknown = append(unknown, name)
+			continue
+		}
+		if _, resolved := r.sources[name]; resolved {
+			continue
+		}
+		if err = r.flags.Set(name, value); err != nil {
+			return
+		}
+		r.sources[name] = source
+	}
+	sort.Strings(unknown)
+	return
+}
+
+// ApplyEnv sets the options that are not resolved yet from the ROOSTER_<OPTION> environment variables
+func (r *Resolver) ApplyEnv() error {
+	values := make(map[string]string)
+	r.flags.VisitAll(func(f *flag.Flag) {
+		if value, found := os.LookupEnv(OptionEnvName(f.Name)); found {
+			values[f.Name] = value
+		}
+	})
+	_, err := r.Apply(SourceEnv, values)
+	return err
+}
+
+// Settings lists the options, sorted by name
+func (r *Resolver) Settings() (settings []Setting) {
+	r.flags.VisitAll(func(f *flag.Flag) {
+		source, resolved := r.sources[f.Name]
+		if !resolved {
+			source = SourceDefault
+		}
+		settings = append(settings, Setting{Name: f.Name, Value: f.Value.String(), Source: source})
+	})
+	return
+}
+
+// Values returns the options resolved from the source, leaving out the excluded ones
+func (r *Resolver) Values(source Source, excluded ...string) map[string]string {
+	values := make(map[string]string)
+	r.flags.VisitAll(func(f *flag.Flag) {
+		if r.sources[f.Name] == source {
+			values[f.Name] = f.Value.String()
+		}
+	})
+	for _, name := range excluded {
+		delete(values, name)
+	}
+	return values
+}
+
+// OptionEnvName returns the environment variable an option is read from. target-label: ROOSTER_TARGET_LABEL
+func OptionEnvName(option string) string {
+	return "ROOSTER_" + strings.ToUpper(strings.ReplaceAll(option, "-", "_"))
+}
+
+// Sources of the Config fields that were not read from the environment
+var envSources = make(map[string]Source)
+
+// ApplyProfileSettings sets the Config fields the profile indicates, unless they are read from the environment
+func ApplyProfileSettings(profile UserProfile) error {
+	if profile.BackupDirectory == "" {
+		return nil
+	}
+	if _, found := os.LookupEnv(envName("BackupDirectory")); found {
+		return nil
+	}
+	if err := checkWritableDirectory(profile.BackupDirectory); err != nil {
+		return errors.New("backupDirectory of the user profile: " + err.Error() + ". Point it to a writable directory")
+	}
+	Env.BackupDirectory = profile.BackupDirectory
+	envSources["BackupDirectory"] = SourceConfigFile
+	return nil
+}
+
+// EnvSettings lists the Config fields, named after their environment variable
+func EnvSettings() (settings []Setting) {
+	fields := reflect.TypeOf(Env)
+	for i := 0; i < fields.NumField(); i++ {
+		field := fields.Field(i)
+		name := envName(field.Name)
+		source, found := envSources[field.Name]
+		if !found {
+			source = SourceDefault
+			if _, set := os.LookupEnv(name); set {
+				source = SourceEnv
+			}
+		}
+		value := reflectField(Env, field.Name)
+		if field.Tag.Get("sensitive") == "true" && value != "" {
+			value = "<redacted>"
+		}
+		settings = append(settings, Setting{Name: name, Value: value, Source: source})
+	}
+	sort.Slice(settings, func(i, j int) bool {
+		return settings[i].Name < settings[j].Name
+	})
+	return
+}
+
+func reflectField(c Config, fieldName string) string {
+	return reflect.ValueOf(c).FieldByName(fieldName).String()
+}
+
+var wordBoundary = regexp.MustCompile("([a-z0-9])([A-Z])")
+
+// envName follows the naming of envconfig: words are split for the fields tagged with split_words
+func envName(fieldName string) string {
+	field, _ := reflect.TypeOf(Env).FieldByName(fieldName)
+	if field.Tag.Get("split_words") == "true" {
+		fieldName = wordBoundary.ReplaceAllString(fieldName, "${1}_${2}")
+	}
+	return strings.ToUpper(fieldName)
+}
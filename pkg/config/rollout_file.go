@@ -0,0 +1,119 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	rolloutFileAPIVersion = "rooster/v1"
+	rolloutFileKind       = "Rollout"
+)
+
+// StringList collects the values of a repeatable option
+type StringList []string
+
+func (s *StringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *StringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// rolloutFile declares the options of a rollout, keyed by option name. Repeatable options take a list
+type rolloutFile struct {
+	APIVersion string               `yaml:"apiVersion"`
+	Kind       string               `yaml:"kind"`
+	Options    map[string]yaml.Node `yaml:"options"`
+}
+
+// ApplyRolloutFile sets the options that are not resolved yet from the rollout file.
+// Unlike the other sources, the file is validated as a whole: unknown options, lists given to options that are not repeatable
+// and invalid values are errors
+func (r *Resolver) ApplyRolloutFile(file string) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	decoder := yaml.NewDecoder(strings.NewReader(string(content)))
+	decoder.KnownFields(true)
+	declared := rolloutFile{}
+	if err = decoder.Decode(&declared); err != nil {
+		return errors.New(file + ": " + err.Error())
+	}
+	if declared.APIVersion != rolloutFileAPIVersion || declared.Kind != rolloutFileKind {
+		return errors.New(file + ": expected apiVersion " + rolloutFileAPIVersion + " and kind " + rolloutFileKind)
+	}
+	names := make([]string, 0, len(declared.Options))
+	for name := range declared.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var problems []string
+	for _, name := range names {
+		if err = r.applyDeclaredOption(name, declared.Options[name]); err != nil {
+			problems = append(problems, name+": "+err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(file + ":\n" + strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+func (r *Resolver) applyDeclaredOption(name string, node yaml.Node) error {
+	f := r.flags.Lookup(name)
+	if f == nil || name == "config" {
+		return errors.New("unknown option")
+	}
+	var values []string
+	switch node.Kind {
+	case yaml.ScalarNode:
+		values = []string{node.Value}
+	case yaml.SequenceNode:
+		if _, repeatable := f.Value.(*StringList); !repeatable {
+			return errors.New("the option is not repeatable. Expected a single value")
+		}
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return errors.New("expected a list of values")
+			}
+			values = append(values, item.Value)
+		}
+	default:
+		return errors.New("expected a value, or a list of values")
+	}
+	// The options indicated on the command line, or in the environment, take precedence
+	if _, resolved := r.sources[name]; resolved {
+		return nil
+	}
+	for _, value := range values {
+		if err := r.flags.Set(name, value); err != nil {
+			return err
+		}
+	}
+	r.sources[name] = SourceRolloutFile
+	return nil
+}
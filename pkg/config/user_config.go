@@ -0,0 +1,68 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// UserProfile gathers the settings of a cluster, as declared in the user config file
+type UserProfile struct {
+	Kubeconfig      string `yaml:"kubeconfig"`
+	Context         string `yaml:"context"`
+	BackupDirectory string `yaml:"backupDirectory"`
+	// Option values, keyed by option name
+	Options map[string]string `yaml:"options"`
+}
+
+type userConfig struct {
+	Profiles map[string]UserProfile `yaml:"profiles"`
+}
+
+// UserConfigFile returns the path of the user config file: <user config dir>/rooster/config.yaml
+func UserConfigFile() (string, error) {
+	configDirectory, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDirectory, "rooster", "config.yaml"), nil
+}
+
+// LoadUserProfile reads the indicated profile from the user config file
+func LoadUserProfile(name string) (profile UserProfile, err error) {
+	configFile, err := UserConfigFile()
+	if err != nil {
+		return
+	}
+	content, err := os.ReadFile(configFile)
+	if err != nil {
+		return
+	}
+	userConfig := userConfig{}
+	if err = yaml.Unmarshal(content, &userConfig); err != nil {
+		return
+	}
+	profile, found := userConfig.Profiles[name]
+	if !found {
+		err = errors.New("profile " + name + " not found in " + configFile)
+	}
+	return
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package strategy decides how a rollout progresses: the canary batch, then the increments covering the remaining nodes.
+// Custom strategies are registered by name, and selected like the built-in ones, with --profile
+package strategy
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	core_v1 "k8s.io/api/core/v1"
+)
+
+// Strategy describes how the rollout progresses once the canary batch is validated
+type Strategy interface {
+	// DefaultCanary is the canary batch size, in percentage, used when none is indicated
+	DefaultCanary() int
+	// Increments returns the node coverage to reach at each increment, in percentage, the canary batch covering canary percent.
+	// The last increment should reach 100
+	Increments(canary int) []int
+	// Soak is the time to wait before each increment
+	Soak() time.Duration
+}
+
+// Ramp is a strategy with fixed increments
+type Ramp struct {
+	Canary   int
+	Coverage []int
+	SoakTime time.Duration
+}
+
+func (r Ramp) DefaultCanary() int { return r.Canary }
+
+func (r Ramp) Increments(canary int) []int {
+	// Do not share the increments of the registered strategy
+	return append([]int{}, r.Coverage...)
+}
+
+func (r Ramp) Soak() time.Duration { return r.SoakTime }
+
+// Linear covers Step more percent of the nodes at each increment
+type Linear struct {
+	Base Strategy
+	Step int
+}
+
+func (l Linear) DefaultCanary() int { return l.Base.DefaultCanary() }
+
+func (l Linear) Increments(canary int) (increments []int) {
+	for coverage := canary + l.Step; coverage < 100; coverage += l.Step {
+		increments = append(increments, coverage)
+	}
+	return append(increments, 100)
+}
+
+func (l Linear) Soak() time.Duration { return l.Base.Soak() }
+
+// AllAtOnce patches all the remaining nodes right after the canary batch. Used when no profile is indicated
+var AllAtOnce Strategy = Ramp{Coverage: []int{100}}
+
+var strategies = map[string]Strategy{
+	"conservative": Ramp{Canary: 5, Coverage: []int{10, 25, 50, 100}, SoakTime: 10 * time.Minute},
+	"standard":     Ramp{Canary: 10, Coverage: []int{50, 100}, SoakTime: 5 * time.Minute},
+	"aggressive":   Ramp{Canary: 25, Coverage: []int{100}, SoakTime: time.Minute},
+}
+
+// Register makes a strategy selectable by name. Meant to be called before the rollout starts, e.g. from an init function
+func Register(name string, strategy Strategy) error {
+	if name == "" || strategy == nil {
+		return errors.New("a strategy needs a name and an implementation")
+	}
+	if _, found := strategies[name]; found {
+		return errors.New("strategy " + name + " is registered already")
+	}
+	strategies[name] = strategy
+	return nil
+}
+
+// Get returns the strategy registered under the name. An empty name selects AllAtOnce
+func Get(name string) (Strategy, error) {
+	if name == "" {
+		return AllAtOnce, nil
+	}
+	strategy, found := strategies[name]
+	if !found {
+		return nil, errors.New("unknown profile: " + name + ". Expected " + strings.Join(Names(), ", "))
+	}
+	return strategy, nil
+}
+
+// Names lists the registered strategies, sorted
+func Names() (names []string) {
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// Plan splits the nodes into the canary batch, followed by the increments
+func Plan(nodes []core_v1.Node, canary int, increments []int) (batches [][]core_v1.Node) {
+	patchedNodes := int(math.Round(float64(len(nodes)*canary) / 100))
+	if patchedNodes > len(nodes) {
+		patchedNodes = len(nodes)
+	}
+	batches = append(batches, nodes[:patchedNodes])
+	for _, coverage := range increments {
+		nodesToCover := int(math.Round(float64(len(nodes)*coverage) / 100))
+		if nodesToCover > len(nodes) {
+			nodesToCover = len(nodes)
+		}
+		if nodesToCover <= patchedNodes {
+			continue
+		}
+		batches = append(batches, nodes[patchedNodes:nodesToCover])
+		patchedNodes = nodesToCover
+	}
+	return
+}
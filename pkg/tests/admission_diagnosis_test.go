@@ -0,0 +1,78 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tests
+
+import (
+	"testing"
+
+	"rooster/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type AdmissionDiagnosisTest struct {
+	suite.Suite
+}
+
+func (suite *AdmissionDiagnosisTest) TestDeniedRequests() {
+	cases := []struct {
+		output  string
+		webhook string
+		reason  string
+	}{
+		{
+			`Error from server (Forbidden): error when creating "daemonset.yaml": admission webhook "validation.gatekeeper.sh" denied the request: [require-team-label] missing label team`,
+			"validation.gatekeeper.sh",
+			"[require-team-label] missing label team",
+		},
+		// Kyverno lists the policies on the next lines: the first one is kept
+		{
+			"admission webhook \"validate.kyverno.svc-fail\" denied the request: \n\nresource Node//node-01 was blocked due to the following policies\n\nrestrict-node-labels: ...",
+			"validate.kyverno.svc-fail",
+			"resource Node//node-01 was blocked due to the following policies",
+		},
+		{
+			`admission webhook "nodes.policy.example.com" denied the request`,
+			"nodes.policy.example.com",
+			"",
+		},
+	}
+	for _, c := range cases {
+		webhook, reason, denied := worker.DiagnoseAdmissionDenial(c.output)
+		assert.True(suite.T(), denied, c.output)
+		assert.Equal(suite.T(), c.webhook, webhook, c.output)
+		assert.Equal(suite.T(), c.reason, reason, c.output)
+	}
+}
+
+func (suite *AdmissionDiagnosisTest) TestOtherFailures() {
+	for _, output := range []string{
+		`Error from server (NotFound): daemonsets.apps "coredns" not found`,
+		`Error from server (Forbidden): nodes "node-01" is forbidden: User "ci" cannot patch resource "nodes"`,
+		// Not the message of the API server
+		`admission webhook denied the request`,
+		"",
+	} {
+		_, _, denied := worker.DiagnoseAdmissionDenial(output)
+		assert.False(suite.T(), denied, output)
+	}
+}
+
+func TestAdmissionDiagnosis(t *testing.T) {
+	suite.Run(t, new(AdmissionDiagnosisTest))
+}
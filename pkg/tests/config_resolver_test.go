@@ -0,0 +1,153 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tests
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"rooster/pkg/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ConfigResolverTest struct {
+	suite.Suite
+	flags       *flag.FlagSet
+	namespace   *string
+	targetLabel *string
+	canary      *int
+}
+
+func (suite *ConfigResolverTest) SetupTest() {
+	suite.flags = flag.NewFlagSet("test", flag.ContinueOnError)
+	suite.namespace = suite.flags.String("namespace", "", "")
+	suite.targetLabel = suite.flags.String("target-label", "", "")
+	suite.canary = suite.flags.Int("canary", 0, "")
+}
+
+func sources(settings []config.Setting) map[string]config.Source {
+	sources := make(map[string]config.Source)
+	for _, setting := range settings {
+		sources[setting.Name] = setting.Source
+	}
+	return sources
+}
+
+func (suite *ConfigResolverTest) TestPrecedence() {
+	err := suite.flags.Parse([]string{"-namespace", "from-flag"})
+	assert.Nil(suite.T(), err)
+	suite.T().Setenv("ROOSTER_NAMESPACE", "from-env")
+	suite.T().Setenv("ROOSTER_TARGET_LABEL", "env=true")
+	resolver := config.NewResolver(suite.flags)
+	assert.Nil(suite.T(), resolver.ApplyEnv())
+	_, err = resolver.Apply(config.SourceConfigFile, map[string]string{"namespace": "from-file", "target-label": "file=true"})
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "from-flag", *suite.namespace)
+	assert.Equal(suite.T(), "env=true", *suite.targetLabel)
+	assert.Equal(suite.T(), 0, *suite.canary)
+	assert.Equal(suite.T(), map[string]config.Source{
+		"canary":       config.SourceDefault,
+		"namespace":    config.SourceFlag,
+		"target-label": config.SourceEnv,
+	}, sources(resolver.Settings()))
+}
+
+func (suite *ConfigResolverTest) TestUnknownOption() {
+	assert.Nil(suite.T(), suite.flags.Parse(nil))
+	resolver := config.NewResolver(suite.flags)
+	unknown, err := resolver.Apply(config.SourceProject, map[string]string{"canary": "10", "unknown": "x"})
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []string{"unknown"}, unknown)
+	assert.Equal(suite.T(), 10, *suite.canary)
+}
+
+func (suite *ConfigResolverTest) TestInvalidValue() {
+	assert.Nil(suite.T(), suite.flags.Parse(nil))
+	_, err := config.NewResolver(suite.flags).Apply(config.SourceProject, map[string]string{"canary": "ten"})
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *ConfigResolverTest) writeRolloutFile(content string) string {
+	file := filepath.Join(suite.T().TempDir(), "rollout.yaml")
+	assert.Nil(suite.T(), os.WriteFile(file, []byte(content), 0o600))
+	return file
+}
+
+func (suite *ConfigResolverTest) TestRolloutFile() {
+	var healthGates config.StringList
+	suite.flags.Var(&healthGates, "health-gate", "")
+	assert.Nil(suite.T(), suite.flags.Parse([]string{"-canary", "5"}))
+	file := suite.writeRolloutFile(`apiVersion: rooster/v1
+kind: Rollout
+options:
+  namespace: from-rollout-file
+  canary: 20
+  health-gate:
+    - alerts
+    - errors
+`)
+	resolver := config.NewResolver(suite.flags)
+	assert.Nil(suite.T(), resolver.ApplyRolloutFile(file))
+	assert.Equal(suite.T(), "from-rollout-file", *suite.namespace)
+	assert.Equal(suite.T(), 5, *suite.canary)
+	assert.Equal(suite.T(), config.StringList{"alerts", "errors"}, healthGates)
+	assert.Equal(suite.T(), config.SourceRolloutFile, sources(resolver.Settings())["namespace"])
+}
+
+func (suite *ConfigResolverTest) TestInvalidRolloutFile() {
+	assert.Nil(suite.T(), suite.flags.Parse(nil))
+	file := suite.writeRolloutFile(`apiVersion: rooster/v1
+kind: Rollout
+options:
+  canary: ten
+  namespace: [a, b]
+  unknown: x
+`)
+	err := config.NewResolver(suite.flags).ApplyRolloutFile(file)
+	assert.ErrorContains(suite.T(), err, "canary")
+	assert.ErrorContains(suite.T(), err, "namespace: the option is not repeatable")
+	assert.ErrorContains(suite.T(), err, "unknown: unknown option")
+}
+
+func (suite *ConfigResolverTest) TestValidateEnv() {
+	env := config.Config{FieldManager: "rooster", ApplyMode: "auto", ProjectNamespace: "kube-system", NetworkProbeNamespace: "default", BackupDirectory: suite.T().TempDir(), LabelCheckTimeout: 30 * time.Second, BatchBarrierTimeout: 5 * time.Minute, SnapshotRetention: 24 * time.Hour, DeviceResourceTimeout: 2 * time.Minute, NetworkProbeTimeout: time.Minute, HealthGateTimeout: 2 * time.Minute, HealthGateInterval: 5 * time.Second, TenantContactAnnotation: "rooster/contact", CriticalityLabel: "rooster/criticality"}
+	assert.Nil(suite.T(), env.Validate())
+	env.ProjectNamespace = "Kube_System"
+	env.NodeConformanceFile = "/missing/conformance.yaml"
+	err := env.Validate()
+	assert.ErrorContains(suite.T(), err, "PROJECT_NAMESPACE")
+	assert.ErrorContains(suite.T(), err, "NODE_CONFORMANCE_FILE")
+}
+
+func (suite *ConfigResolverTest) TestConfirmationPolicy() {
+	env := config.Config{ConfirmationPolicy: "revert=no, existing-canary=yes"}
+	assert.Equal(suite.T(), config.NoAnswer, env.Confirmation(config.RevertAction))
+	assert.Equal(suite.T(), config.YesAnswer, env.Confirmation(config.ExistingCanaryAction))
+	assert.Equal(suite.T(), config.PromptAnswer, env.Confirmation(config.ProjectDeletionAction))
+	env.ConfirmationPolicy = "revert=maybe"
+	assert.ErrorContains(suite.T(), env.Validate(), "CONFIRMATION_POLICY")
+}
+
+func TestConfigResolver(t *testing.T) {
+	s := new(ConfigResolverTest)
+	suite.Run(t, s)
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"rooster/pkg/config"
+	"rooster/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+type FleetTest struct {
+	suite.Suite
+}
+
+func (suite *FleetTest) fleetFile(content string) string {
+	file := filepath.Join(suite.T().TempDir(), "fleet.yaml")
+	assert.Nil(suite.T(), os.WriteFile(file, []byte(content), 0600))
+	return file
+}
+
+func (suite *FleetTest) TestLoadFleet() {
+	fleet, err := worker.LoadFleet(suite.fleetFile(`
+clusters:
+- name: staging
+  context: staging-ctx
+- name: prod
+  kubeconfig: /etc/rooster/prod.kubeconfig
+desired:
+  dns: v1.4.0
+`))
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), fleet.Clusters, 2)
+	assert.Equal(suite.T(), map[string]string{"dns": "v1.4.0"}, fleet.DesiredVersions(fleet.Clusters[1]))
+}
+
+// All the invalid clusters are reported, not only the last one
+func (suite *FleetTest) TestInvalidClustersAreAllReported() {
+	_, err := worker.LoadFleet(suite.fleetFile(`
+clusters:
+- context: staging-ctx
+- name: prod
+- name: prod
+- context: dev-ctx
+`))
+	assert.NotNil(suite.T(), err)
+	assert.Contains(suite.T(), err.Error(), "cluster #1 has no name")
+	assert.Contains(suite.T(), err.Error(), "cluster prod is listed twice")
+	assert.Contains(suite.T(), err.Error(), "cluster #4 has no name")
+}
+
+func (suite *FleetTest) TestEmptyFleet() {
+	_, err := worker.LoadFleet(suite.fleetFile("clusters: []\n"))
+	assert.NotNil(suite.T(), err)
+}
+
+func convergenceFleet() worker.Fleet {
+	return worker.Fleet{
+		Clusters: []worker.FleetCluster{{Name: "prod-eu", Environment: "prod"}},
+		Projects: map[string]map[string]worker.FleetRelease{"dns": {"prod": {Version: "v1.4.0", Source: "/releases/dns/v1.4.0"}}},
+	}
+}
+
+// A cluster rolling the desired version out is promoted: its nodes still running the previous version get patched
+func (suite *FleetTest) TestRollingClusterConverges() {
+	fleet := convergenceFleet()
+	cluster := fleet.Clusters[0]
+	nodes := versionedNodes("dns", "v1.4.0", "v1.4.0", "v1.3.0", "v1.3.0", "v1.3.0", "v1.3.0", "v1.3.0", "v1.3.0", "", "v1.3.0")
+	entry := worker.ProjectComplianceEntry("dns", cluster.Name, nodes, "dns", fleet.DesiredVersions(cluster)["dns"])
+	assert.Equal(suite.T(), "rolling", entry.Status)
+	update, err := worker.PlanFleetUpdate(fleet, cluster, entry, "dns")
+	assert.Nil(suite.T(), err)
+	assert.NotNil(suite.T(), update)
+	assert.True(suite.T(), update.Promote)
+	assert.Equal(suite.T(), "dns=v1.4.0", update.CanaryLabel)
+	assert.Equal(suite.T(), "/releases/dns/v1.4.0", update.ManifestPath)
+	batches, err := worker.PlanPromotionBatches(nodes, config.RoosterOptions{Canary: 20, CanaryLabel: update.CanaryLabel})
+	assert.Nil(suite.T(), err)
+	assert.ElementsMatch(suite.T(), batchNames([][]core_v1.Node{nodes[2:]}), batchNames(batches))
+}
+
+// A cluster running the previous version only is rolled out to, from the canary batch
+func (suite *FleetTest) TestLaggingClusterConverges() {
+	fleet := convergenceFleet()
+	cluster := fleet.Clusters[0]
+	entry := worker.ProjectComplianceEntry("dns", cluster.Name, versionedNodes("dns", "v1.3.0", "v1.3.0"), "dns", "v1.4.0")
+	assert.Equal(suite.T(), "lagging", entry.Status)
+	update, err := worker.PlanFleetUpdate(fleet, cluster, entry, "dns")
+	assert.Nil(suite.T(), err)
+	assert.NotNil(suite.T(), update)
+	assert.False(suite.T(), update.Promote)
+}
+
+func (suite *FleetTest) TestCompliantClusterIsLeftAlone() {
+	fleet := convergenceFleet()
+	cluster := fleet.Clusters[0]
+	entry := worker.ProjectComplianceEntry("dns", cluster.Name, versionedNodes("dns", "v1.4.0", "v1.4.0"), "dns", "v1.4.0")
+	assert.Equal(suite.T(), "compliant", entry.Status)
+	update, err := worker.PlanFleetUpdate(fleet, cluster, entry, "dns")
+	assert.Nil(suite.T(), err)
+	assert.Nil(suite.T(), update)
+}
+
+func (suite *FleetTest) TestLaggingClusterWithoutSource() {
+	fleet := convergenceFleet()
+	cluster := worker.FleetCluster{Name: "staging-eu", Environment: "staging"}
+	entry := worker.ProjectComplianceEntry("dns", cluster.Name, versionedNodes("dns", "v1.3.0"), "dns", "v1.4.0")
+	_, err := worker.PlanFleetUpdate(fleet, cluster, entry, "dns")
+	assert.NotNil(suite.T(), err)
+}
+
+// The destination rolling the source version out is promoted, from the backup of the version
+func (suite *FleetTest) TestClusterPromotionResumesRollout() {
+	backupDirectory := suite.T().TempDir()
+	manifests := filepath.Join(backupDirectory, "versions", "example.com_ingress", "2.1", "manifests")
+	assert.Nil(suite.T(), os.MkdirAll(manifests, os.ModePerm))
+	manifestPath, err := worker.VersionManifests(backupDirectory, "example.com/ingress=2.1")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), manifests, manifestPath)
+	destination := worker.FleetCluster{Name: "prod", Context: "prod-ctx"}
+	nodes := versionedNodes("ingress", "2.1", "2.0", "1.9", "", "2.0", "2.0", "2.1")
+	entry := worker.ProjectComplianceEntry("ingress", destination.Name, nodes, "ingress", "2.1")
+	update, err := worker.PlanPromotionUpdate(destination, entry, "ingress", manifestPath)
+	assert.Nil(suite.T(), err)
+	assert.NotNil(suite.T(), update)
+	assert.True(suite.T(), update.Promote)
+	assert.Equal(suite.T(), "ingress=2.1", update.CanaryLabel)
+	assert.Equal(suite.T(), manifests, update.ManifestPath)
+	batches, err := worker.PlanPromotionBatches(nodes, config.RoosterOptions{Canary: 10, Profile: "conservative", CanaryLabel: update.CanaryLabel})
+	assert.Nil(suite.T(), err)
+	assert.ElementsMatch(suite.T(), []string{"node-02-2.0", "node-03-1.9", "node-04-", "node-05-2.0", "node-06-2.0"}, batchNames(batches))
+}
+
+// Without a backup of the version, nothing tells which manifests the source runs
+func (suite *FleetTest) TestClusterPromotionWithoutBackup() {
+	_, err := worker.VersionManifests(suite.T().TempDir(), "ingress=2.1")
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *FleetTest) TestClusterPromotionOfUpToDateCluster() {
+	destination := worker.FleetCluster{Name: "prod"}
+	entry := worker.ProjectComplianceEntry("ingress", destination.Name, versionedNodes("ingress", "2.1", "2.1"), "ingress", "2.1")
+	update, err := worker.PlanPromotionUpdate(destination, entry, "ingress", "/releases/ingress/2.1")
+	assert.Nil(suite.T(), err)
+	assert.Nil(suite.T(), update)
+}
+
+func (suite *FleetTest) TestClusterPromotionToUninitializedProject() {
+	destination := worker.FleetCluster{Name: "prod"}
+	entry := worker.FleetReportEntry{Project: "ingress", Cluster: destination.Name, Desired: "2.1", Status: "missing"}
+	_, err := worker.PlanPromotionUpdate(destination, entry, "", "/releases/ingress/2.1")
+	assert.NotNil(suite.T(), err)
+}
+
+func TestFleet(t *testing.T) {
+	suite.Run(t, new(FleetTest))
+}
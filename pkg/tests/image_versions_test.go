@@ -0,0 +1,109 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"rooster/pkg/config"
+	"rooster/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+)
+
+type ImageVersionTest struct {
+	suite.Suite
+}
+
+func (suite *ImageVersionTest) manifestPath(image string) string {
+	manifestPath := suite.T().TempDir()
+	daemonSet := `apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: coredns
+spec:
+  selector:
+    matchLabels:
+      app: coredns
+  template:
+    metadata:
+      labels:
+        app: coredns
+    spec:
+      containers:
+      - name: coredns
+        image: ` + image + "\n"
+	assert.Nil(suite.T(), os.WriteFile(filepath.Join(manifestPath, "daemonset.yaml"), []byte(daemonSet), 0600))
+	return manifestPath
+}
+
+func (suite *ImageVersionTest) TestImageVersion() {
+	versions := map[string]string{
+		"coredns:1.11.1":                                          "1.11.1",
+		"registry.local:5000/dns/coredns:v2":                      "v2",
+		"coredns:v2@sha256:0123456789abcdef0":                     "v2",
+		"registry.local:5000/coredns@sha256:0123456789abcdef0123": "sha256-0123456789ab",
+	}
+	for image, expected := range versions {
+		version, err := worker.ImageVersion(image)
+		assert.Nil(suite.T(), err, image)
+		assert.Equal(suite.T(), expected, version, image)
+	}
+}
+
+func (suite *ImageVersionTest) TestImagePinningNoVersion() {
+	for _, image := range []string{"coredns", "coredns:latest", "registry.local:5000/coredns", "coredns@sha256:0123", "coredns:" + strings.Repeat("1", 70)} {
+		_, err := worker.ImageVersion(image)
+		assert.NotNil(suite.T(), err, image)
+	}
+}
+
+func (suite *ImageVersionTest) TestVersionFromImage() {
+	options := config.RoosterOptions{CanaryLabel: "rooster/dns", VersionFrom: "image", ManifestPath: suite.manifestPath("coredns:1.11.1")}
+	assert.Nil(suite.T(), worker.ApplyVersionFrom(zap.NewNop(), &options))
+	assert.Equal(suite.T(), "rooster/dns=1.11.1", options.CanaryLabel)
+	// The value of the project defaults is replaced
+	options.ManifestPath = suite.manifestPath("coredns:1.11.3")
+	assert.Nil(suite.T(), worker.ApplyVersionFrom(zap.NewNop(), &options))
+	assert.Equal(suite.T(), "rooster/dns=1.11.3", options.CanaryLabel)
+}
+
+func (suite *ImageVersionTest) TestVersionFromInvalidOptions() {
+	manifestPath := suite.manifestPath("coredns:1.11.1")
+	invalidOptions := []config.RoosterOptions{
+		{CanaryLabel: "", VersionFrom: "image", ManifestPath: manifestPath},
+		{CanaryLabel: "rooster/dns", VersionFrom: "chart", ManifestPath: manifestPath},
+		{CanaryLabel: "rooster/dns", VersionFrom: "image", ManifestPath: suite.manifestPath("coredns:latest")},
+		{CanaryLabel: "rooster/dns", VersionFrom: "image", ManifestPath: suite.T().TempDir()},
+	}
+	for _, options := range invalidOptions {
+		assert.NotNil(suite.T(), worker.ApplyVersionFrom(zap.NewNop(), &options))
+	}
+	// Without --version-from, the canary label is left as is
+	options := config.RoosterOptions{CanaryLabel: "rooster/dns=v1", ManifestPath: manifestPath}
+	assert.Nil(suite.T(), worker.ApplyVersionFrom(zap.NewNop(), &options))
+	assert.Equal(suite.T(), "rooster/dns=v1", options.CanaryLabel)
+}
+
+func TestImageVersion(t *testing.T) {
+	suite.Run(t, new(ImageVersionTest))
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"rooster/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+)
+
+type ManifestFilesTest struct {
+	suite.Suite
+	logger *zap.Logger
+}
+
+func (suite *ManifestFilesTest) SetupSuite() {
+	suite.logger = zap.NewNop()
+}
+
+func writeManifest(t *testing.T, dir string, name string, content string) {
+	err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	assert.Nil(t, err)
+}
+
+func (suite *ManifestFilesTest) TestMultipleDocuments() {
+	dir := suite.T().TempDir()
+	writeManifest(suite.T(), dir, "resources.yaml", `---
+# leading separator and comments
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: agent
+  namespace: monitoring
+unknownField: ignored
+---
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: agent
+  namespace: monitoring
+`)
+	resources, err := worker.ReadManifestFiles(suite.logger, dir, "")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), map[string]string{
+		"ServiceAccount,agent": "monitoring",
+		"DaemonSet,agent":      "monitoring",
+	}, resources)
+}
+
+func (suite *ManifestFilesTest) TestIndicatedNamespace() {
+	dir := suite.T().TempDir()
+	writeManifest(suite.T(), dir, "cm.yaml", `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+`)
+	resources, err := worker.ReadManifestFiles(suite.logger, dir, "monitoring")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "monitoring", resources["ConfigMap,settings"])
+}
+
+func (suite *ManifestFilesTest) TestErrorContext() {
+	dir := suite.T().TempDir()
+	writeManifest(suite.T(), dir, "broken.yaml", `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  namespace: monitoring
+`)
+	_, err := worker.ReadManifestFiles(suite.logger, dir, "")
+	manifestError := &worker.ManifestError{}
+	assert.True(suite.T(), errors.As(err, &manifestError))
+	assert.Equal(suite.T(), filepath.Join(dir, "broken.yaml"), manifestError.File)
+	assert.Equal(suite.T(), 2, manifestError.Document)
+}
+
+func (suite *ManifestFilesTest) TestNamespaceConflict() {
+	dir := suite.T().TempDir()
+	writeManifest(suite.T(), dir, "cm.yaml", `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: monitoring
+`)
+	_, err := worker.ReadManifestFiles(suite.logger, dir, "default")
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *ManifestFilesTest) TestDuplicateResources() {
+	dir := suite.T().TempDir()
+	configMap := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: monitoring
+`
+	writeManifest(suite.T(), dir, "a.yaml", configMap)
+	writeManifest(suite.T(), dir, "b.yaml", configMap)
+	_, err := worker.ReadManifestFiles(suite.logger, dir, "")
+	assert.NotNil(suite.T(), err)
+	assert.Contains(suite.T(), err.Error(), filepath.Join(dir, "a.yaml"))
+	assert.Contains(suite.T(), err.Error(), filepath.Join(dir, "b.yaml"))
+}
+
+func TestManifestFiles(t *testing.T) {
+	s := new(ManifestFilesTest)
+	suite.Run(t, s)
+}
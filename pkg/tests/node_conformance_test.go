@@ -0,0 +1,147 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"rooster/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type NodeConformanceTest struct {
+	suite.Suite
+}
+
+func (suite *NodeConformanceTest) conformanceFile(content string) string {
+	file := filepath.Join(suite.T().TempDir(), "conformance.yaml")
+	assert.Nil(suite.T(), os.WriteFile(file, []byte(content), 0600))
+	return file
+}
+
+func kernelNode(name string, kernelVersion string) core_v1.Node {
+	node := core_v1.Node{ObjectMeta: meta_v1.ObjectMeta{Name: name}}
+	node.Status.NodeInfo.KernelVersion = kernelVersion
+	return node
+}
+
+// Under the skip policy, a canary batch left without any node aborts the rollout
+func (suite *NodeConformanceTest) TestEmptyCanaryBatch() {
+	file := suite.conformanceFile("policy: skip\nminKernelVersion: 5.15.0\n")
+	nodes := []core_v1.Node{kernelNode("node-01", "5.4.0-1103-aws"), kernelNode("node-02", "5.10.0")}
+	conformingNodes, err := worker.FilterCanaryBatch(zap.NewNop(), file, nodes)
+	assert.NotNil(suite.T(), err)
+	assert.Empty(suite.T(), conformingNodes)
+	// The other batches may be emptied
+	conformingNodes, err = worker.FilterConformingNodes(zap.NewNop(), file, nodes)
+	assert.Nil(suite.T(), err)
+	assert.Empty(suite.T(), conformingNodes)
+}
+
+func (suite *NodeConformanceTest) TestPartialCanaryBatch() {
+	file := suite.conformanceFile("policy: skip\nminKernelVersion: 5.15.0\n")
+	nodes := []core_v1.Node{kernelNode("node-01", "5.4.0"), kernelNode("node-02", "6.1.0")}
+	conformingNodes, err := worker.FilterCanaryBatch(zap.NewNop(), file, nodes)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []core_v1.Node{nodes[1]}, conformingNodes)
+}
+
+func conformanceNode(mutate func(node *core_v1.Node)) core_v1.Node {
+	node := kernelNode("node", "6.1.0-1012-aws")
+	node.Labels = map[string]string{"pool": "workers", "zone": "a"}
+	node.Status.NodeInfo.ContainerRuntimeVersion = "containerd://1.7.2"
+	mutate(&node)
+	return node
+}
+
+func (suite *NodeConformanceTest) TestPrerequisites() {
+	file := suite.conformanceFile(`policy: skip
+minKernelVersion: 5.15.0
+minContainerdVersion: 1.6.0
+requiredLabels:
+- pool=workers
+- zone in (a, b)
+forbiddenTaints:
+- node.kubernetes.io/unschedulable
+rejectDiskPressuredNodes: true
+`)
+	cases := []struct {
+		name       string
+		node       core_v1.Node
+		conforming bool
+	}{
+		{"conforming", conformanceNode(func(node *core_v1.Node) {}), true},
+		{"old kernel", conformanceNode(func(node *core_v1.Node) { node.Status.NodeInfo.KernelVersion = "5.4.0-1103-aws" }), false},
+		{"unparsable kernel", conformanceNode(func(node *core_v1.Node) { node.Status.NodeInfo.KernelVersion = "unknown" }), false},
+		{"old containerd", conformanceNode(func(node *core_v1.Node) { node.Status.NodeInfo.ContainerRuntimeVersion = "containerd://1.5.9" }), false},
+		{"other runtime", conformanceNode(func(node *core_v1.Node) { node.Status.NodeInfo.ContainerRuntimeVersion = "cri-o://1.27.0" }), false},
+		{"missing label", conformanceNode(func(node *core_v1.Node) { delete(node.Labels, "pool") }), false},
+		{"label out of set", conformanceNode(func(node *core_v1.Node) { node.Labels["zone"] = "c" }), false},
+		{"forbidden taint", conformanceNode(func(node *core_v1.Node) {
+			node.Spec.Taints = []core_v1.Taint{{Key: "node.kubernetes.io/unschedulable", Effect: core_v1.TaintEffectNoSchedule}}
+		}), false},
+		{"other taint", conformanceNode(func(node *core_v1.Node) {
+			node.Spec.Taints = []core_v1.Taint{{Key: "dedicated", Value: "dns", Effect: core_v1.TaintEffectNoSchedule}}
+		}), true},
+		{"disk pressure", conformanceNode(func(node *core_v1.Node) {
+			node.Status.Conditions = []core_v1.NodeCondition{{Type: core_v1.NodeDiskPressure, Status: core_v1.ConditionTrue}}
+		}), false},
+		{"disk pressure over", conformanceNode(func(node *core_v1.Node) {
+			node.Status.Conditions = []core_v1.NodeCondition{{Type: core_v1.NodeDiskPressure, Status: core_v1.ConditionFalse}}
+		}), true},
+	}
+	for _, c := range cases {
+		conformingNodes, err := worker.FilterConformingNodes(zap.NewNop(), file, []core_v1.Node{c.node})
+		assert.Nil(suite.T(), err, c.name)
+		assert.Equal(suite.T(), c.conforming, len(conformingNodes) == 1, c.name)
+	}
+}
+
+// Under the fail policy, the default, a non-conforming node aborts the rollout
+func (suite *NodeConformanceTest) TestFailPolicy() {
+	file := suite.conformanceFile("minKernelVersion: 5.15.0\n")
+	nodes := []core_v1.Node{kernelNode("node-01", "6.1.0"), kernelNode("node-02", "5.4.0")}
+	_, err := worker.FilterConformingNodes(zap.NewNop(), file, nodes)
+	assert.NotNil(suite.T(), err)
+	assert.Contains(suite.T(), err.Error(), "node-02")
+	conformingNodes, err := worker.FilterConformingNodes(zap.NewNop(), file, nodes[:1])
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), nodes[:1], conformingNodes)
+}
+
+func (suite *NodeConformanceTest) TestInvalidConformanceFile() {
+	nodes := []core_v1.Node{kernelNode("node-01", "6.1.0")}
+	for _, content := range []string{"policy: warn\n", "minKernelVersion: [5.15\n"} {
+		_, err := worker.FilterConformingNodes(zap.NewNop(), suite.conformanceFile(content), nodes)
+		assert.NotNil(suite.T(), err, content)
+	}
+	// Without conformance file, every node conforms
+	conformingNodes, err := worker.FilterConformingNodes(zap.NewNop(), "", nodes)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), nodes, conformingNodes)
+}
+
+func TestNodeConformance(t *testing.T) {
+	suite.Run(t, new(NodeConformanceTest))
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"rooster/pkg/utils"
+	"rooster/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type NodeLabelsTest struct {
+	suite.Suite
+}
+
+// Two projects sharing a node: labeling the node for the 2nd one keeps the canary label of the 1st one
+func (suite *NodeLabelsTest) TestCanaryLabelsOfTwoProjects() {
+	m, err := utils.New("")
+	assert.Nil(suite.T(), err)
+	ctx := context.TODO()
+	nodes, err := m.GetClient().CoreV1().Nodes().List(ctx, meta_v1.ListOptions{})
+	assert.Nil(suite.T(), err)
+	assert.NotEmpty(suite.T(), nodes.Items)
+	nodeName := nodes.Items[0].Name
+	clients := worker.Clients{K8sClient: *m}
+	defer func() {
+		patch := []byte(`{"metadata":{"labels":{"rooster-test/dns":null,"rooster-test/ingress":null}}}`)
+		_, err := m.GetClient().CoreV1().Nodes().Patch(ctx, nodeName, types.MergePatchType, patch, meta_v1.PatchOptions{})
+		assert.Nil(suite.T(), err)
+	}()
+	assert.Nil(suite.T(), clients.ApplyCanaryLabel(ctx, nodeName, "rooster-test/dns", "v2", false))
+	assert.Nil(suite.T(), clients.ApplyCanaryLabel(ctx, nodeName, "rooster-test/ingress", "v7", false))
+	node, err := m.GetClient().CoreV1().Nodes().Get(ctx, nodeName, meta_v1.GetOptions{})
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "v2", node.Labels["rooster-test/dns"])
+	assert.Equal(suite.T(), "v7", node.Labels["rooster-test/ingress"])
+}
+
+func TestNodeLabels(t *testing.T) {
+	suite.Run(t, new(NodeLabelsTest))
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"rooster/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+)
+
+type OverlayHandlersTest struct {
+	suite.Suite
+	manifestPath string
+}
+
+const overlayBaseManifests = `apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: coredns
+  namespace: kube-system
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: coredns-config
+  namespace: kube-system
+`
+
+func (suite *OverlayHandlersTest) SetupTest() {
+	suite.manifestPath = suite.T().TempDir()
+	assert.Nil(suite.T(), os.WriteFile(filepath.Join(suite.manifestPath, "coredns.yaml"), []byte(overlayBaseManifests), 0600))
+}
+
+// overlay writes the files of <manifest-path>/overlays/<name>
+func (suite *OverlayHandlersTest) overlay(name string, files map[string]string) string {
+	overlayPath := filepath.Join(suite.manifestPath, "overlays", name)
+	assert.Nil(suite.T(), os.MkdirAll(overlayPath, os.ModePerm))
+	for file, content := range files {
+		assert.Nil(suite.T(), os.WriteFile(filepath.Join(overlayPath, file), []byte(content), 0600))
+	}
+	return overlayPath
+}
+
+func (suite *OverlayHandlersTest) TestReadPatches() {
+	overlayPath := suite.overlay("production", map[string]string{
+		"resources.yaml": `apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: coredns
+spec:
+  template:
+    spec:
+      priorityClassName: system-node-critical
+---
+target:
+  kind: ConfigMap
+  name: coredns-config
+patch:
+- op: replace
+  path: /data/cache
+  value: "300"
+`,
+	})
+	patches, err := worker.ReadOverlayPatches(overlayPath)
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), patches, 2)
+	expected := []struct{ kind, name, patchType string }{
+		{"DaemonSet", "coredns", "strategic"},
+		{"ConfigMap", "coredns-config", "json"},
+	}
+	for i, patch := range patches {
+		assert.Equal(suite.T(), expected[i].kind, patch.Kind)
+		assert.Equal(suite.T(), expected[i].name, patch.Name)
+		assert.Equal(suite.T(), expected[i].patchType, patch.PatchType)
+		assert.Equal(suite.T(), filepath.Join(overlayPath, "resources.yaml"), patch.File)
+	}
+}
+
+func (suite *OverlayHandlersTest) TestPatchesWithoutTarget() {
+	invalidPatches := map[string]string{
+		"no name":          "apiVersion: apps/v1\nkind: DaemonSet\nspec: {}\n",
+		"no kind":          "metadata:\n  name: coredns\n",
+		"json, no name":    "target:\n  kind: ConfigMap\npatch: []\n",
+		"json, no target":  "target: {}\npatch: []\n",
+		"invalid document": "kind: [DaemonSet\n",
+	}
+	for name, content := range invalidPatches {
+		_, err := worker.ReadOverlayPatches(suite.overlay(name, map[string]string{"patch.yaml": content}))
+		assert.NotNil(suite.T(), err, name)
+	}
+}
+
+// A patch whose target is not in the base manifests fails the rendering. No patch is applied, so kubectl is not needed
+func (suite *OverlayHandlersTest) TestPatchOfUnknownResource() {
+	suite.overlay("staging", map[string]string{"patch.yaml": "apiVersion: apps/v1\nkind: DaemonSet\nmetadata:\n  name: kube-proxy\n"})
+	renderedPath, err := worker.RenderOverlay(zap.NewNop(), suite.manifestPath, "staging")
+	if renderedPath != "" {
+		defer os.RemoveAll(renderedPath)
+	}
+	assert.NotNil(suite.T(), err)
+	assert.Contains(suite.T(), err.Error(), "DaemonSet kube-proxy was not found in the base manifests")
+	_, err = worker.RenderOverlay(zap.NewNop(), suite.manifestPath, "missing")
+	assert.NotNil(suite.T(), err)
+}
+
+// An empty overlay renders the base manifests, one file per resource
+func (suite *OverlayHandlersTest) TestEmptyOverlay() {
+	suite.overlay("empty", nil)
+	renderedPath, err := worker.RenderOverlay(zap.NewNop(), suite.manifestPath, "empty")
+	defer os.RemoveAll(renderedPath)
+	assert.Nil(suite.T(), err)
+	for _, file := range []string{"DaemonSet_coredns.yaml", "ConfigMap_coredns-config.yaml"} {
+		_, err = os.Stat(filepath.Join(renderedPath, file))
+		assert.Nil(suite.T(), err, file)
+	}
+}
+
+func TestOverlayHandlers(t *testing.T) {
+	suite.Run(t, new(OverlayHandlersTest))
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"rooster/pkg/config"
+	"rooster/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+type PromotionTest struct {
+	suite.Suite
+}
+
+// versionedNodes returns nodes named after their version, carrying it as the value of the canary label key.
+// An empty version leaves the node without the key
+func versionedNodes(key string, versions ...string) (nodes []core_v1.Node) {
+	for i, version := range versions {
+		node := core_v1.Node{}
+		node.Name = fmt.Sprintf("node-%02d-%s", i+1, version)
+		node.Labels = map[string]string{}
+		if version != "" {
+			node.Labels[key] = version
+		}
+		nodes = append(nodes, node)
+	}
+	return
+}
+
+func batchNames(batches [][]core_v1.Node) (names []string) {
+	for _, batch := range batches {
+		for _, node := range batch {
+			names = append(names, node.Name)
+		}
+	}
+	return
+}
+
+func (suite *PromotionTest) TestOldVersionNodesArePromoted() {
+	nodes := versionedNodes("app", "v2", "v1", "v1", "v1", "", "v1")
+	batches, err := worker.PlanPromotionBatches(nodes, config.RoosterOptions{Canary: 20, CanaryLabel: "app=v2"})
+	assert.Nil(suite.T(), err)
+	assert.ElementsMatch(suite.T(), []string{"node-02-v1", "node-03-v1", "node-04-v1", "node-05-", "node-06-v1"}, batchNames(batches))
+}
+
+func (suite *PromotionTest) TestNothingToPromote() {
+	nodes := versionedNodes("app", "v2", "v2", "v2")
+	batches, err := worker.PlanPromotionBatches(nodes, config.RoosterOptions{Canary: 30, CanaryLabel: "app=v2"})
+	assert.Nil(suite.T(), err)
+	assert.Empty(suite.T(), batches)
+}
+
+func TestPromotion(t *testing.T) {
+	suite.Run(t, new(PromotionTest))
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"rooster/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type RolloutHistoryTest struct {
+	suite.Suite
+}
+
+// v1 is rolled out at once. v2 fails & is reverted, then rolled out with a canary pause. v3 is dry run only
+const rolloutEvents = `{"time":"2023-05-01T10:00:00Z","type":"rollout_started","canaryLabel":"rooster/dns=v1"}
+{"time":"2023-05-01T10:05:00Z","type":"batch_verified","canaryLabel":"rooster/dns=v1","batch":0}
+{"time":"2023-05-01T10:20:00Z","type":"batch_verified","canaryLabel":"rooster/dns=v1","batch":1}
+{"time":"2023-05-01T10:30:00Z","type":"rollout_completed","canaryLabel":"rooster/dns=v1"}
+{"time":"2023-05-02T09:00:00Z","type":"rollout_started","canaryLabel":"rooster/ingress=v7"}
+{"time":"2023-05-03T09:00:00Z","type":"rollout_started","canaryLabel":"rooster/dns=v2"}
+{"time":"2023-05-03T09:04:00Z","type":"rollout_failed","canaryLabel":"rooster/dns=v2","reason":"TestFailure"}
+{"time":"2023-05-03T09:05:00Z","type":"revert_started","canaryLabel":"rooster/dns=v2"}
+{"time":"2023-05-03T09:06:00Z","type":"revert_completed","canaryLabel":"rooster/dns=v2"}
+{"time":"2023-05-03T09:10:00Z","type":"rollout_started","canaryLabel":"rooster/dns=v3","dryRun":true}
+{"time":"2023-05-03T09:11:00Z","type":"batch_verified","canaryLabel":"rooster/dns=v3","batch":0}
+{"time":"2023-05-03T09:12:00Z","type":"rollout_completed","canaryLabel":"rooster/dns=v3","dryRun":true}
+{"time":"2023-05-03T10:00:00Z","type":"rollout_started","canaryLabel":"rooster/dns=v2"}
+{"time":"2023-05-03T10:05:00Z","type":"batch_verified","canaryLabel":"rooster/dns=v2","batch":0}
+{"time":"2023-05-03T10:06:00Z","type":"canary_completed","canaryLabel":"rooster/dns=v2"}
+{"time":"2023-05-03T10:10:00Z","type":"promotion_started","canaryLabel":"rooster/dns=v2"}
+{"time":"2023-05-03T10:15:00Z","type":"batch_verified","canaryLabel":"rooster/dns=v2","batch":1}
+{"time":"2023-05-03T10:20:00Z","type":"rollout_completed","canaryLabel":"rooster/dns=v2"}
+{"time":"2023-04-28T08:00:00Z","type":"rollout_started","manifestPath":"/path/to/files"}
+`
+
+func (suite *RolloutHistoryTest) eventsFile(content string) string {
+	file := filepath.Join(suite.T().TempDir(), "events.ndjson")
+	assert.Nil(suite.T(), os.WriteFile(file, []byte(content), 0600))
+	return file
+}
+
+func (suite *RolloutHistoryTest) TestVersionStatistics() {
+	history, err := worker.ReadRolloutHistory(suite.eventsFile(rolloutEvents), "")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 1, history.Skipped)
+	assert.Len(suite.T(), history.Versions, 3)
+	v1, v7, v2 := history.Versions[0], history.Versions[1], history.Versions[2]
+	assert.Equal(suite.T(), worker.VersionStatistics{
+		CanaryLabel: "rooster/dns=v1", Started: "2023-05-01T10:00:00Z", Completed: "2023-05-01T10:30:00Z", Duration: "30m0s",
+		Attempts: 1, Batches: 2, Outcome: "completed",
+	}, v1)
+	assert.Equal(suite.T(), "rooster/ingress=v7", v7.CanaryLabel)
+	assert.Equal(suite.T(), "in progress", v7.Outcome)
+	assert.Empty(suite.T(), v7.Duration)
+	// From the first attempt to the completion of the promotion
+	assert.Equal(suite.T(), worker.VersionStatistics{
+		CanaryLabel: "rooster/dns=v2", Started: "2023-05-03T09:00:00Z", Completed: "2023-05-03T10:20:00Z", Duration: "1h20m0s", DurationChange: "+50m0s",
+		Attempts: 2, Batches: 2, Failures: 1, Rollbacks: 1, Outcome: "completed",
+	}, v2)
+}
+
+func (suite *RolloutHistoryTest) TestCanaryLabelFilter() {
+	file := suite.eventsFile(rolloutEvents)
+	cases := map[string][]string{
+		"rooster/dns":     {"rooster/dns=v1", "rooster/dns=v2"},
+		"rooster/dns=v2":  {"rooster/dns=v2"},
+		"rooster/ingress": {"rooster/ingress=v7"},
+		"rooster/dn":      nil,
+	}
+	for canaryLabel, expected := range cases {
+		history, err := worker.ReadRolloutHistory(file, canaryLabel)
+		assert.Nil(suite.T(), err, canaryLabel)
+		versions := []string{}
+		for _, version := range history.Versions {
+			versions = append(versions, version.CanaryLabel)
+		}
+		assert.ElementsMatch(suite.T(), expected, versions, canaryLabel)
+	}
+}
+
+func (suite *RolloutHistoryTest) TestHistoryTable() {
+	history, err := worker.ReadRolloutHistory(suite.eventsFile(rolloutEvents), "rooster/dns")
+	assert.Nil(suite.T(), err)
+	content, err := history.Marshal("table")
+	assert.Nil(suite.T(), err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	assert.Len(suite.T(), lines, 3)
+	assert.Equal(suite.T(), []string{"rooster/dns=v2", "2023-05-03T09:00:00Z", "1h20m0s", "+50m0s", "2", "2", "1", "1", "completed"}, strings.Fields(lines[2]))
+	_, err = history.Marshal("csv")
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *RolloutHistoryTest) TestInvalidEventsFile() {
+	for _, content := range []string{
+		"{\"time\":\"2023-05-01T10:00:00Z\",\"type\":\"rollout_started\",\"canaryLabel\":\"rooster/dns=v1\"}\n{\"time\":",
+		"{\"time\":\"yesterday\",\"type\":\"rollout_started\",\"canaryLabel\":\"rooster/dns=v1\"}\n",
+	} {
+		_, err := worker.ReadRolloutHistory(suite.eventsFile(content), "")
+		assert.NotNil(suite.T(), err, content)
+	}
+	_, err := worker.ReadRolloutHistory(filepath.Join(suite.T().TempDir(), "missing.ndjson"), "")
+	assert.NotNil(suite.T(), err)
+}
+
+func TestRolloutHistory(t *testing.T) {
+	suite.Run(t, new(RolloutHistoryTest))
+}
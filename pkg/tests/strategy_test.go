@@ -0,0 +1,112 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"rooster/pkg/config"
+	"rooster/pkg/strategy"
+	"rooster/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+type StrategyTest struct {
+	suite.Suite
+}
+
+func batchSizes(batches [][]core_v1.Node) (sizes []int) {
+	for _, batch := range batches {
+		sizes = append(sizes, len(batch))
+	}
+	return
+}
+
+func (suite *StrategyTest) TestCanaryThenRest() {
+	options := config.RoosterOptions{Canary: 10}
+	batches, err := worker.SimulateBatches(20, 1, options)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []int{2, 18}, batchSizes(batches))
+}
+
+func (suite *StrategyTest) TestLinearIncrements() {
+	options := config.RoosterOptions{Canary: 5, Increment: 20}
+	batches, err := worker.SimulateBatches(120, 3, options)
+	assert.Nil(suite.T(), err)
+	// Coverage: 5%, 25%, 45%, 65%, 85%, 100%
+	assert.Equal(suite.T(), []int{6, 24, 24, 24, 24, 18}, batchSizes(batches))
+}
+
+func (suite *StrategyTest) TestProfile() {
+	options := config.RoosterOptions{Profile: "conservative"}
+	batches, err := worker.SimulateBatches(100, 2, options)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []int{5, 5, 15, 25, 50}, batchSizes(batches))
+}
+
+func (suite *StrategyTest) TestAllNodesCovered() {
+	options := config.RoosterOptions{Canary: 33, Increment: 33}
+	batches, err := worker.SimulateBatches(7, 1, options)
+	assert.Nil(suite.T(), err)
+	seen := make(map[string]bool)
+	for _, batch := range batches {
+		for _, node := range batch {
+			assert.False(suite.T(), seen[node.Name])
+			seen[node.Name] = true
+		}
+	}
+	assert.Len(suite.T(), seen, 7)
+}
+
+func (suite *StrategyTest) TestInvalidOptions() {
+	_, err := worker.SimulateBatches(10, 1, config.RoosterOptions{Canary: 150})
+	assert.NotNil(suite.T(), err)
+	_, err = worker.SimulateBatches(10, 1, config.RoosterOptions{Profile: "unknown"})
+	assert.NotNil(suite.T(), err)
+}
+
+// powerOfTwo doubles the node coverage at each increment
+type powerOfTwo struct{}
+
+func (powerOfTwo) DefaultCanary() int { return 1 }
+
+func (powerOfTwo) Increments(canary int) (increments []int) {
+	for coverage := canary * 2; coverage < 100; coverage *= 2 {
+		increments = append(increments, coverage)
+	}
+	return append(increments, 100)
+}
+
+func (powerOfTwo) Soak() time.Duration { return 0 }
+
+func (suite *StrategyTest) TestCustomStrategy() {
+	assert.Nil(suite.T(), strategy.Register("power-of-two", powerOfTwo{}))
+	assert.NotNil(suite.T(), strategy.Register("power-of-two", powerOfTwo{}))
+	batches, err := worker.SimulateBatches(100, 1, config.RoosterOptions{Profile: "power-of-two", Canary: 10})
+	assert.Nil(suite.T(), err)
+	// Coverage: 10%, 20%, 40%, 80%, 100%
+	assert.Equal(suite.T(), []int{10, 10, 20, 40, 20}, batchSizes(batches))
+}
+
+func TestStrategy(t *testing.T) {
+	s := new(StrategyTest)
+	suite.Run(t, s)
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tests
+
+import (
+	"testing"
+
+	"rooster/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type SuccessCriteriaTest struct {
+	suite.Suite
+}
+
+func (suite *SuccessCriteriaTest) TestEvaluation() {
+	healthy := worker.BatchSignals{Ready: true, ReadyRatio: 1, Restarts: 0, TestsRun: true, TestsPassed: true}
+	flapping := worker.BatchSignals{Ready: true, ReadyRatio: 0.97, Restarts: 3, TestsRun: true, TestsPassed: true}
+	untested := worker.BatchSignals{Ready: false, ReadyRatio: 0.5}
+	cases := []struct {
+		expression string
+		signals    worker.BatchSignals
+		met        bool
+	}{
+		{"tests.passed && restarts == 0 && ready_ratio >= 0.98", healthy, true},
+		{"tests.passed && restarts == 0 && ready_ratio >= 0.98", flapping, false},
+		{"ready_ratio >= 0.95 && restarts < 5", flapping, true},
+		{"!tests.run || tests.passed", untested, true},
+		{"ready", untested, false},
+		// Without criteria, the batch has to be ready
+		{"", healthy, true},
+		{"", untested, false},
+	}
+	for _, c := range cases {
+		met, err := worker.EvaluateSuccessCriteria(c.expression, c.signals)
+		assert.Nil(suite.T(), err, c.expression)
+		assert.Equal(suite.T(), c.met, met, c.expression)
+	}
+}
+
+func (suite *SuccessCriteriaTest) TestInvalidCriteria() {
+	for _, expression := range []string{
+		"ready &&",
+		// Not a boolean
+		"ready_ratio * 100",
+		"restarts == 0 && latency < 200",
+		// restarts is an integer
+		"restarts == 0.5",
+	} {
+		_, err := worker.EvaluateSuccessCriteria(expression, worker.BatchSignals{})
+		assert.NotNil(suite.T(), err, expression)
+	}
+}
+
+func TestSuccessCriteria(t *testing.T) {
+	suite.Run(t, new(SuccessCriteriaTest))
+}
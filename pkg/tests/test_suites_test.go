@@ -0,0 +1,97 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tests
+
+import (
+	"testing"
+
+	"rooster/pkg/config"
+	"rooster/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type TestSuitesTest struct {
+	suite.Suite
+}
+
+func (suite *TestSuitesTest) TestStages() {
+	options := config.RoosterOptions{TestSuites: []string{
+		"smoke=SmokeTest",
+		"dns=DnsTest,blocking,batch",
+		"perf=PerfTest,informational,batch",
+		"e2e=E2ETest,blocking,final",
+	}}
+	cases := []struct {
+		name          string
+		batch         int
+		last          bool
+		blocking      []string
+		informational []string
+	}{
+		{"canary batch", 0, false, []string{"smoke", "dns"}, []string{"perf"}},
+		{"intermediate batch", 2, false, []string{"dns"}, []string{"perf"}},
+		{"last batch", 3, true, []string{"dns", "e2e"}, []string{"perf"}},
+		// A rollout of a single batch
+		{"canary & last batch", 0, true, []string{"smoke", "dns", "e2e"}, []string{"perf"}},
+	}
+	for _, c := range cases {
+		blocking, informational, err := worker.PlanTestSuites(options, c.batch, c.last)
+		assert.Nil(suite.T(), err, c.name)
+		assert.Equal(suite.T(), c.blocking, blocking, c.name)
+		assert.Equal(suite.T(), c.informational, informational, c.name)
+	}
+}
+
+// Without suites, the test package is a blocking suite run after the canary batch
+func (suite *TestSuitesTest) TestTestPackage() {
+	options := config.RoosterOptions{TestPackage: "CanaryTest", TestBinary: "tests.bin"}
+	blocking, informational, err := worker.PlanTestSuites(options, 0, false)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []string{"tests"}, blocking)
+	assert.Empty(suite.T(), informational)
+	blocking, _, err = worker.PlanTestSuites(options, 1, true)
+	assert.Nil(suite.T(), err)
+	assert.Empty(suite.T(), blocking)
+	// No test at all
+	blocking, informational, err = worker.PlanTestSuites(config.RoosterOptions{}, 0, true)
+	assert.Nil(suite.T(), err)
+	assert.Empty(suite.T(), blocking)
+	assert.Empty(suite.T(), informational)
+}
+
+func (suite *TestSuitesTest) TestInvalidSuites() {
+	cases := map[string]config.RoosterOptions{
+		"no package":        {TestSuites: []string{"smoke="}},
+		"no name":           {TestSuites: []string{"=SmokeTest"}},
+		"no separator":      {TestSuites: []string{"SmokeTest"}},
+		"too many fields":   {TestSuites: []string{"smoke=SmokeTest,blocking,canary,again"}},
+		"unknown policy":    {TestSuites: []string{"smoke=SmokeTest,optional"}},
+		"unknown stage":     {TestSuites: []string{"smoke=SmokeTest,blocking,nightly"}},
+		"declared twice":    {TestSuites: []string{"smoke=SmokeTest", "smoke=OtherTest"}},
+		"with test package": {TestSuites: []string{"smoke=SmokeTest"}, TestPackage: "CanaryTest"},
+	}
+	for name, options := range cases {
+		_, _, err := worker.PlanTestSuites(options, 0, false)
+		assert.NotNil(suite.T(), err, name)
+	}
+}
+
+func TestTestSuites(t *testing.T) {
+	suite.Run(t, new(TestSuitesTest))
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"rooster/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type VersionBackupsTest struct {
+	suite.Suite
+	backupDirectory string
+}
+
+// Backups of rooster/dns v2 & v3, and of rooster/ingress v2
+func (suite *VersionBackupsTest) SetupTest() {
+	suite.backupDirectory = suite.T().TempDir()
+	for _, version := range []string{"rooster_dns/v2", "rooster_dns/v3", "rooster_ingress/v2"} {
+		for _, directory := range []string{"manifests", "resources"} {
+			assert.Nil(suite.T(), os.MkdirAll(filepath.Join(suite.backupDirectory, "versions", version, directory), os.ModePerm))
+		}
+	}
+}
+
+func (suite *VersionBackupsTest) TestRestoreFromDirectory() {
+	backup, err := worker.ResolveBackupDirectory(suite.backupDirectory, suite.backupDirectory)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), suite.backupDirectory, backup)
+	// The default backup directory
+	backup, err = worker.ResolveBackupDirectory(suite.backupDirectory, "")
+	assert.Nil(suite.T(), err)
+	assert.Empty(suite.T(), backup)
+}
+
+func (suite *VersionBackupsTest) TestRestoreFromVersion() {
+	backup, err := worker.ResolveBackupDirectory(suite.backupDirectory, "rooster/ingress=v2")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), filepath.Join(suite.backupDirectory, "versions", "rooster_ingress", "v2", "resources"), backup)
+	// A single key has a backup of v3
+	backup, err = worker.ResolveBackupDirectory(suite.backupDirectory, "v3")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), filepath.Join(suite.backupDirectory, "versions", "rooster_dns", "v3", "resources"), backup)
+}
+
+func (suite *VersionBackupsTest) TestRestoreFromUnknownVersion() {
+	for _, backup := range []string{"rooster/ingress=v3", "v4", filepath.Join(suite.backupDirectory, "missing")} {
+		_, err := worker.ResolveBackupDirectory(suite.backupDirectory, backup)
+		assert.NotNil(suite.T(), err, backup)
+	}
+	// Both keys have a backup of v2
+	_, err := worker.ResolveBackupDirectory(suite.backupDirectory, "v2")
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *VersionBackupsTest) TestVersionManifests() {
+	manifestPath, err := worker.VersionManifests(suite.backupDirectory, "rooster/dns=v3")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), filepath.Join(suite.backupDirectory, "versions", "rooster_dns", "v3", "manifests"), manifestPath)
+	_, err = worker.VersionManifests(suite.backupDirectory, "rooster/dns=v4")
+	assert.NotNil(suite.T(), err)
+}
+
+func TestVersionBackups(t *testing.T) {
+	suite.Run(t, new(VersionBackupsTest))
+}
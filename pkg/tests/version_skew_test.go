@@ -0,0 +1,99 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"rooster/pkg/config"
+	"rooster/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+type VersionSkewTest struct {
+	suite.Suite
+}
+
+// rolledOutNodes annotates the nodes running the version as rolled out that long ago, as --annotate-nodes does
+func rolledOutNodes(nodes []core_v1.Node, version string, elapsed time.Duration) []core_v1.Node {
+	for i := range nodes {
+		if nodes[i].Labels["rooster/dns"] != version {
+			continue
+		}
+		nodes[i].Annotations = map[string]string{
+			"rooster/version":         version,
+			"rooster/last-transition": time.Now().Add(-elapsed).Format(time.RFC3339),
+		}
+	}
+	return nodes
+}
+
+func (suite *VersionSkewTest) TestMaxVersions() {
+	cases := []struct {
+		name        string
+		canaryLabel string
+		maxVersions int
+		versions    []string
+		preflight   bool
+		violations  int
+	}{
+		{"two versions", "rooster/dns=v2", 2, []string{"v1", "v1", "v2"}, false, 0},
+		// The nodes without the canary label count as one version
+		{"unlabeled nodes", "rooster/dns=v2", 2, []string{"", "v1", "v2"}, false, 1},
+		// The version about to be rolled out counts as running already
+		{"preflight of a new version", "rooster/dns=v3", 2, []string{"v1", "v2"}, true, 1},
+		{"preflight of a running version", "rooster/dns=v2", 2, []string{"v1", "v2"}, true, 0},
+		{"no limit", "rooster/dns=v4", 0, []string{"", "v1", "v2", "v3"}, true, 0},
+	}
+	for _, c := range cases {
+		options := config.RoosterOptions{CanaryLabel: c.canaryLabel, MaxVersions: c.maxVersions}
+		violations := worker.FindSkewViolations(zap.NewNop(), options, versionedNodes("rooster/dns", c.versions...), c.preflight)
+		assert.Len(suite.T(), violations, c.violations, c.name)
+	}
+}
+
+func (suite *VersionSkewTest) TestMaxPartialCoverage() {
+	options := config.RoosterOptions{CanaryLabel: "rooster/dns=v2", MaxPartialCoverage: 30, MaxPartialDuration: 6 * time.Hour}
+	cases := []struct {
+		name       string
+		nodes      []core_v1.Node
+		preflight  bool
+		violations int
+	}{
+		{"partial for too long", rolledOutNodes(versionedNodes("rooster/dns", "v1", "v1", "v2", "v2"), "v2", 7*time.Hour), false, 1},
+		{"partial for a while", rolledOutNodes(versionedNodes("rooster/dns", "v1", "v1", "v2", "v2"), "v2", time.Hour), false, 0},
+		{"under the coverage", rolledOutNodes(versionedNodes("rooster/dns", "v1", "v1", "v1", "v2"), "v2", 7*time.Hour), false, 0},
+		{"complete", rolledOutNodes(versionedNodes("rooster/dns", "v2", "v2"), "v2", 7*time.Hour), false, 0},
+		// Without the rollout annotations, the duration is unknown
+		{"not annotated", versionedNodes("rooster/dns", "v1", "v2", "v2"), false, 0},
+		// The duration is not checked before a rollout
+		{"preflight", rolledOutNodes(versionedNodes("rooster/dns", "v1", "v2", "v2"), "v2", 7*time.Hour), true, 0},
+	}
+	for _, c := range cases {
+		violations := worker.FindSkewViolations(zap.NewNop(), options, c.nodes, c.preflight)
+		assert.Len(suite.T(), violations, c.violations, c.name)
+	}
+}
+
+func TestVersionSkew(t *testing.T) {
+	suite.Run(t, new(VersionSkewTest))
+}
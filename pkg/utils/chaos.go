@@ -0,0 +1,85 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Failure injection, for rehearsing the retries, aborts & resumes of a rollout in test clusters. Disabled by default
+var (
+	chaosErrorRate float64
+	chaosFlapRate  float64
+	chaosMaxDelay  time.Duration
+)
+
+// SetChaos makes the API requests fail, or be delayed, at random, and the readiness checks flap.
+// Rates are between 0 and 1. The clients created afterwards are affected
+func SetChaos(errorRate float64, flapRate float64, maxDelay time.Duration) {
+	chaosErrorRate = errorRate
+	chaosFlapRate = flapRate
+	chaosMaxDelay = maxDelay
+}
+
+func chaosEnabled() bool {
+	return chaosErrorRate > 0 || chaosFlapRate > 0 || chaosMaxDelay > 0
+}
+
+// InjectReadinessFlap tells whether a readiness check should fail, regardless of the resources
+func InjectReadinessFlap() bool {
+	return chaosFlapRate > 0 && rand.Float64() < chaosFlapRate
+}
+
+// chaosTransport delays the requests, and answers some of them with a server error or a throttling response, without sending them
+type chaosTransport struct {
+	next http.RoundTripper
+}
+
+func (t chaosTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if chaosMaxDelay > 0 {
+		time.Sleep(time.Duration(rand.Int63n(int64(chaosMaxDelay))))
+	}
+	if chaosErrorRate > 0 && rand.Float64() < chaosErrorRate {
+		// Half of the injected errors are throttling responses, the other half server errors
+		if rand.Intn(2) == 0 {
+			return chaosResponse(request, http.StatusTooManyRequests, "TooManyRequests", "chaos: injected throttling"), nil
+		}
+		return chaosResponse(request, http.StatusInternalServerError, "InternalError", "chaos: injected server error"), nil
+	}
+	return t.next.RoundTrip(request)
+}
+
+// chaosResponse is an API server Status response
+func chaosResponse(request *http.Request, code int, reason string, message string) *http.Response {
+	body := `{"kind":"Status","apiVersion":"v1","status":"Failure","message":"` + message + `","reason":"` + reason + `","code":` + strconv.Itoa(code) + `}`
+	header := http.Header{"Content-Type": []string{"application/json"}}
+	if code == http.StatusTooManyRequests {
+		header.Set("Retry-After", "1")
+	}
+	return &http.Response{
+		Status:     strconv.Itoa(code) + " " + http.StatusText(code),
+		StatusCode: code,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    request,
+	}
+}
@@ -40,13 +40,24 @@ func Shell(format string, args ...interface{}) (string, error) {
 func Kubectl(namespace, subcommand string, args ...string) (string, error) {
 	var cmd string
 	rest := strings.Join(args, " ")
+	namespaceFlag := ""
+	if namespace != "" {
+		namespaceFlag = "-n " + namespace + " "
+	}
+	contextFlag := ""
+	if kubectlKubeconfig != "" {
+		contextFlag = "--kubeconfig '" + kubectlKubeconfig + "' "
+	}
+	if kubeContext != "" {
+		contextFlag += "--context '" + kubeContext + "' "
+	}
 	switch len(args) {
 	case 0:
-		cmd = fmt.Sprintf("kubectl %s %s", subcommand, rest)
+		cmd = fmt.Sprintf("kubectl %s%s %s", contextFlag, subcommand, rest)
 	case 1:
-		cmd = fmt.Sprintf("kubectl -n %s %s -f %s", namespace, subcommand, args[0])
+		cmd = fmt.Sprintf("kubectl %s%s%s -f '%s'", contextFlag, namespaceFlag, subcommand, args[0])
 	default:
-		cmd = fmt.Sprintf("kubectl -n %s %s %s", namespace, subcommand, rest)
+		cmd = fmt.Sprintf("kubectl %s%s%s %s", contextFlag, namespaceFlag, subcommand, rest)
 	}
 	return Shell(cmd)
 }
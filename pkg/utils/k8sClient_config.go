@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
 
@@ -37,11 +38,69 @@ type K8sClient struct {
 	dynamicClient *dynamic.Interface
 }
 
+var (
+	// Context used by the clients & kubectl. Left empty, the current context of the kubeconfig is used
+	kubeContext string
+	// Kubeconfig kubectl is pointed to. Left empty, kubectl follows $KUBECONFIG
+	kubectlKubeconfig string
+	// Identify & pace the requests of the clients. Left empty, the client-go defaults apply
+	userAgent string
+	qps       float32
+	burst     int
+)
+
+// SetKubeContext selects the kubeconfig context the clients & kubectl commands work with
+func SetKubeContext(context string) {
+	kubeContext = context
+}
+
+// SetKubeconfig points the kubectl commands to the kubeconfig the clients are built from. Left empty, kubectl follows $KUBECONFIG
+func SetKubeconfig(path string) {
+	kubectlKubeconfig = path
+}
+
+// DefaultKubeconfig returns the kubeconfig the clients are built from when none is indicated
+func DefaultKubeconfig() string {
+	return filepath.Join(os.Getenv("HOME"), ".kube", "config")
+}
+
+// SetClientSettings sets the user agent of the clients, so API Priority & Fairness can tell Rooster requests apart, and their rate limits
+func SetClientSettings(agent string, queriesPerSecond float32, maxBurst int) {
+	userAgent = agent
+	qps = queriesPerSecond
+	burst = maxBurst
+}
+
 func getConfig(kubeconfigPath string) (config *rest.Config, err error) {
+	config, err = loadConfig(kubeconfigPath)
+	if err != nil {
+		return
+	}
+	if userAgent != "" {
+		config.UserAgent = userAgent
+	}
+	if qps > 0 {
+		config.QPS = qps
+	}
+	if burst > 0 {
+		config.Burst = burst
+	}
+	if chaosEnabled() {
+		config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return chaosTransport{next: rt}
+		})
+	}
+	return config, nil
+}
+
+func loadConfig(kubeconfigPath string) (config *rest.Config, err error) {
 	if kubeconfigPath == "" {
-		kubeconfigPath = filepath.Join(
-			os.Getenv("HOME"), ".kube", "config",
-		)
+		kubeconfigPath = DefaultKubeconfig()
+	}
+	if kubeContext != "" {
+		loadingRules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfigPath}
+		overrides := &clientcmd.ConfigOverrides{CurrentContext: kubeContext}
+		return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
 	}
 	config, err = clientcmd.BuildConfigFromFlags("", kubeconfigPath)
 	return config, err
@@ -0,0 +1,60 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"regexp"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+// Message of the API server when an admission webhook denies a request
+var admissionDenial = regexp.MustCompile(`admission webhook "([^"]+)" denied the request:?\s*(.*)`)
+
+// DiagnoseAdmissionDenial tells which admission webhook denied a request, and why, from the output of the request. No cluster is needed
+func DiagnoseAdmissionDenial(output string) (webhook string, reason string, denied bool) {
+	match := admissionDenial.FindStringSubmatch(output)
+	if match == nil {
+		return "", "", false
+	}
+	return match[1], match[2], true
+}
+
+// logRequestFailure logs the failure, putting the admission webhook that denied the request forward
+func logRequestFailure(logger *zap.Logger, subject string, output string) {
+	if webhook, reason, denied := DiagnoseAdmissionDenial(output); denied {
+		logger.Error(subject + " was denied by the admission webhook " + webhook + ": " + reason)
+		return
+	}
+	logger.Error(output)
+}
+
+// preflightNodePatch labels a node in dry-run mode. Admission policies rejecting the canary label are detected before any node is patched
+func (c Clients) preflightNodePatch(logger *zap.Logger, node core_v1.Node, canaryLabelKey string, canaryLabelValue string) error {
+	err := c.ApplyCanaryLabel(context.TODO(), node.Name, canaryLabelKey, canaryLabelValue, true)
+	if err == nil {
+		return nil
+	}
+	if webhook, reason, denied := DiagnoseAdmissionDenial(err.Error()); denied {
+		return errors.New("the admission webhook " + webhook + " denies the canary label on node " + node.Name + ": " + reason)
+	}
+	logger.Warn("The dry-run patch of node " + node.Name + " failed: " + err.Error())
+	return nil
+}
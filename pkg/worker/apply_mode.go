@@ -0,0 +1,49 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"context"
+
+	"rooster/pkg/config"
+
+	"go.uber.org/zap"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	core_v1_apply "k8s.io/client-go/applyconfigurations/core/v1"
+)
+
+// Name of the ConfigMap applied in dry-run mode, to find out whether server-side apply is available
+const applyProbeConfigMap = "rooster-apply-probe"
+
+// useServerSideApply tells how the manifests are applied. In auto mode, server-side apply is probed with a dry-run apply:
+// old clusters, or admission webhooks restricting the field managers, fall back to client-side apply
+func (c Clients) useServerSideApply(logger *zap.Logger) bool {
+	switch config.Env.ApplyMode {
+	case config.ServerSideApply:
+		return true
+	case config.ClientSideApply:
+		logger.Info("Apply mode: client-side")
+		return false
+	}
+	probe := core_v1_apply.ConfigMap(applyProbeConfigMap, config.Env.ProjectNamespace).WithData(map[string]string{"probe": "true"})
+	applyOptions := meta_v1.ApplyOptions{FieldManager: config.Env.FieldManager, Force: true, DryRun: []string{"All"}}
+	if _, err := c.K8sClient.GetClient().CoreV1().ConfigMaps(config.Env.ProjectNamespace).Apply(context.TODO(), probe, applyOptions); err != nil {
+		logger.Warn("Server-side apply is not available (" + err.Error() + "). Falling back to client-side apply")
+		return false
+	}
+	return true
+}
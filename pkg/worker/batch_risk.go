@@ -0,0 +1,116 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"rooster/pkg/config"
+
+	core_v1 "k8s.io/api/core/v1"
+)
+
+// Weights of the risk signals. A critical node outweighs a handful of tenant pods
+const (
+	tenantPodRisk         = 1
+	statefulPodRisk       = 5
+	mediumCriticalityRisk = 10
+	highCriticalityRisk   = 50
+)
+
+// nodeRisk holds the signals of the disruption a patch of the node may cause
+type nodeRisk struct {
+	tenantPods   int
+	statefulPods int
+	criticality  string
+	score        int
+}
+
+// scoreNodes weighs the risk of patching each node, from its tenant pods, its stateful workloads and its criticality label
+func (c Clients) scoreNodes(nodes []core_v1.Node) (risks map[string]nodeRisk, err error) {
+	risks = make(map[string]nodeRisk)
+	for _, node := range nodes {
+		pods, err := c.workloadPods(node)
+		if err != nil {
+			return nil, err
+		}
+		risk := nodeRisk{tenantPods: len(pods), criticality: node.Labels[config.Env.CriticalityLabel]}
+		for _, pod := range pods {
+			if isStatefulPod(pod) {
+				risk.statefulPods++
+			}
+		}
+		risk.score = risk.tenantPods*tenantPodRisk + risk.statefulPods*statefulPodRisk
+		switch risk.criticality {
+		case "medium":
+			risk.score += mediumCriticalityRisk
+		case "high":
+			risk.score += highCriticalityRisk
+		}
+		risks[node.Name] = risk
+	}
+	return
+}
+
+// isStatefulPod tells whether the pod belongs to a StatefulSet, or keeps its data on a persistent volume
+func isStatefulPod(pod core_v1.Pod) bool {
+	for _, owner := range pod.OwnerReferences {
+		if owner.Kind == "StatefulSet" {
+			return true
+		}
+	}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// orderNodesByRisk sorts the nodes from the least to the most risky, so that the first batches put the least at stake
+func orderNodesByRisk(nodes []core_v1.Node, risks map[string]nodeRisk) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return risks[nodes[i].Name].score < risks[nodes[j].Name].score
+	})
+}
+
+func printBatchRisks(batches [][]core_v1.Node, risks map[string]nodeRisk) {
+	for i, batch := range batches {
+		total := nodeRisk{}
+		critical := 0
+		for _, node := range batch {
+			risk := risks[node.Name]
+			total.score += risk.score
+			total.tenantPods += risk.tenantPods
+			total.statefulPods += risk.statefulPods
+			if risk.criticality == "medium" || risk.criticality == "high" {
+				critical++
+			}
+		}
+		fmt.Println("  Batch " + strconv.Itoa(i) + ": " + strconv.Itoa(total.score) + " (tenant pods: " + strconv.Itoa(total.tenantPods) +
+			", stateful pods: " + strconv.Itoa(total.statefulPods) + ", critical nodes: " + strconv.Itoa(critical) + ")")
+	}
+}
+
+func nodesOf(batches [][]core_v1.Node) (nodes []core_v1.Node) {
+	for _, batch := range batches {
+		nodes = append(nodes, batch...)
+	}
+	return
+}
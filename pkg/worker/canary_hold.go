@@ -0,0 +1,46 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+// Interval of the analysis of the canary batch, while it is held
+const canaryHoldCheckInterval = time.Minute
+
+// holdCanary keeps the rollout to the canary batch for the hold period, analysing the batch at regular intervals.
+// The rollout continues once the period is over, unless the analysis failed in the meantime
+func (c Clients) holdCanary(logger *zap.Logger, hold time.Duration, criteria *successCriteria, targetResources map[string]string, nodes []core_v1.Node, testsRun bool, testsPassed bool) bool {
+	deadline := time.Now().Add(hold)
+	logger.Info("Holding the canary batch for " + hold.String() + ", until " + deadline.Format(time.RFC3339))
+	for remaining := time.Until(deadline); remaining > 0; remaining = time.Until(deadline) {
+		if remaining > canaryHoldCheckInterval {
+			remaining = canaryHoldCheckInterval
+		}
+		waitForResources(remaining)
+		if met := c.judgeBatch(logger, criteria, targetResources, nodes, testsRun, testsPassed); !met {
+			logger.Warn("The canary batch failed the analysis while being held")
+			return false
+		}
+	}
+	logger.Info("The canary batch stayed healthy for " + hold.String() + ". Continuing the rollout")
+	return true
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"rooster/pkg/utils"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// Set on the patched nodes when the canary label has a TTL. Removed once the rollout completes
+	canaryLabelExpiryAnnotation = "rooster/canary-label-expires-at"
+	rolloutAbandonedEvent       = "rollout_abandoned"
+)
+
+// setCanaryLabelExpiry records when the canary label of the nodes expires, should the rollout never complete
+func setCanaryLabelExpiry(logger *zap.Logger, nodes []core_v1.Node, ttl time.Duration) {
+	expiresAt := time.Now().UTC().Add(ttl).Format(time.RFC3339)
+	for _, node := range nodes {
+		cmd, err := utils.Kubectl("", "annotate --overwrite node "+node.Name+" "+canaryLabelExpiryAnnotation+"="+expiresAt)
+		if err != nil {
+			logger.Warn("Could not set the canary label expiry of node " + node.Name + ": " + cmd)
+		}
+	}
+}
+
+// clearCanaryLabelExpiry makes the canary label of the nodes permanent
+func clearCanaryLabelExpiry(logger *zap.Logger, nodes []core_v1.Node) {
+	for _, node := range nodes {
+		cmd, err := utils.Kubectl("", "annotate node "+node.Name+" "+canaryLabelExpiryAnnotation+"-")
+		if err != nil {
+			logger.Warn("Could not clear the canary label expiry of node " + node.Name + ": " + cmd)
+		}
+	}
+}
+
+// expireCanaryLabels removes the canary label from the nodes whose label outlived its TTL. The rollout that set it was abandoned
+func (c Clients) expireCanaryLabels(logger *zap.Logger, canaryLabel string, events *eventRecorder, dryRun bool) error {
+	nodes, err := c.K8sClient.GetClient().CoreV1().Nodes().List(context.TODO(), meta_v1.ListOptions{LabelSelector: canaryLabel})
+	if err != nil {
+		return err
+	}
+	canaryLabelKey := strings.Split(canaryLabel, "=")[0]
+	expiredNodes := []core_v1.Node{}
+	for _, node := range nodes.Items {
+		expiresAt, err := time.Parse(time.RFC3339, node.Annotations[canaryLabelExpiryAnnotation])
+		if err != nil || time.Now().Before(expiresAt) {
+			continue
+		}
+		expiredNodes = append(expiredNodes, node)
+	}
+	if len(expiredNodes) == 0 {
+		return nil
+	}
+	events.recordBatch(rolloutAbandonedEvent, 0, expiredNodes, 0)
+	for _, node := range expiredNodes {
+		logger.Warn("The canary label of node " + node.Name + " expired. The rollout that set it was abandoned")
+		if dryRun {
+			continue
+		}
+		if _, err = c.removeLabelFromNode(logger, node, canaryLabel, canaryLabelKey); err != nil {
+			return err
+		}
+		clearCanaryLabelExpiry(logger, []core_v1.Node{node})
+	}
+	return nil
+}
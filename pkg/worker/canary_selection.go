@@ -0,0 +1,145 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"rooster/pkg/config"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+// Canary selection policies: the nodes serving the least, or the most, come first
+const (
+	leastSelectionPolicy = "least"
+	mostSelectionPolicy  = "most"
+)
+
+// prometheusResponse is the part of the Prometheus instant query response Rooster reads
+type prometheusResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric map[string]string `json:"metric"`
+			// Timestamp & value, as a string
+			Value [2]interface{} `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// orderTargetNodes decides in which order the target nodes are patched: by telemetry or by risk, the nodes of the canary pool always coming first
+func (c Clients) orderTargetNodes(logger *zap.Logger, nodes []core_v1.Node, options config.RoosterOptions) error {
+	if options.OrderByRisk && options.CanarySelectionQuery != "" {
+		return errors.New("--order-by-risk and --canary-selection-query cannot be used together")
+	}
+	if options.OrderByRisk {
+		risks, err := c.scoreNodes(nodes)
+		if err != nil {
+			return err
+		}
+		orderNodesByRisk(nodes, risks)
+	}
+	if options.CanarySelectionQuery != "" {
+		values, err := queryNodeMetric(options.CanarySelectionQuery)
+		if err != nil {
+			return err
+		}
+		if err = orderNodesByMetric(logger, nodes, values, options.CanarySelectionPolicy); err != nil {
+			return err
+		}
+	}
+	// Nodes of the canary pool always absorb the first exposure
+	if err := moveCanaryPoolFirst(nodes, options.CanaryPoolLabel); err != nil {
+		logger.Warn(err.Error())
+	}
+	return nil
+}
+
+// queryNodeMetric runs the instant query against Prometheus. The series are matched to the nodes through the PROMETHEUS_NODE_LABEL label
+func queryNodeMetric(query string) (values map[string]float64, err error) {
+	if config.Env.PrometheusUrl == "" {
+		return nil, errors.New("--canary-selection-query requires the PROMETHEUS_URL environment variable")
+	}
+	request, err := http.NewRequest(http.MethodGet, config.Env.PrometheusUrl+"/api/v1/query?query="+url.QueryEscape(query), nil)
+	if err != nil {
+		return
+	}
+	if config.Env.PrometheusToken != "" {
+		request.Header.Set("Authorization", "Bearer "+config.Env.PrometheusToken)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	response, err := client.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	result := prometheusResponse{}
+	if err = json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, errors.New("unexpected answer of Prometheus (" + response.Status + "): " + err.Error())
+	}
+	if result.Status != "success" {
+		return nil, errors.New("the canary selection query failed: " + result.Error)
+	}
+	if result.Data.ResultType != "vector" {
+		return nil, errors.New("the canary selection query must return an instant vector, not a " + result.Data.ResultType)
+	}
+	values = make(map[string]float64)
+	for _, series := range result.Data.Result {
+		node := series.Metric[config.Env.PrometheusNodeLabel]
+		sample, _ := series.Value[1].(string)
+		value, err := strconv.ParseFloat(sample, 64)
+		if node == "" || err != nil {
+			continue
+		}
+		values[node] = value
+	}
+	return
+}
+
+// orderNodesByMetric sorts the nodes by the value of the metric, following the policy. Nodes without a value come last
+func orderNodesByMetric(logger *zap.Logger, nodes []core_v1.Node, values map[string]float64, policy string) error {
+	if policy != leastSelectionPolicy && policy != mostSelectionPolicy {
+		return errors.New("unknown canary selection policy: " + policy + ". Expected least or most")
+	}
+	for _, node := range nodes {
+		if _, found := values[node.Name]; !found {
+			logger.Warn("The canary selection query returned no value for node " + node.Name + ". It is patched last")
+		}
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		valueI, foundI := values[nodes[i].Name]
+		valueJ, foundJ := values[nodes[j].Name]
+		if foundI != foundJ {
+			return foundI
+		}
+		if policy == mostSelectionPolicy {
+			return valueI > valueJ
+		}
+		return valueI < valueJ
+	})
+	return nil
+}
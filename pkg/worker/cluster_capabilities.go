@@ -0,0 +1,67 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// Kubernetes versions Rooster is supported on: server-side apply is GA from 1.22, and client-go supports servers up to one minor version ahead of it
+var (
+	minServerVersion = version.MustParseGeneric("1.22")
+	maxServerVersion = version.MustParseGeneric("1.27")
+)
+
+// APIs Rooster cannot do without: the nodes, and the DaemonSets rolled out
+var requiredAPIs = []string{"v1", "apps/v1"}
+
+// checkClusterCapabilities verifies the version of the cluster and the APIs it serves, before anything is changed.
+// A version outside of the supported range is reported as a warning, a missing API as an error
+func (c Clients) checkClusterCapabilities(logger *zap.Logger) (warnings []string, err error) {
+	discovery := c.K8sClient.GetClient().Discovery()
+	info, err := discovery.ServerVersion()
+	if err != nil {
+		return nil, errors.New("could not read the version of the cluster: " + err.Error())
+	}
+	serverVersion, err := version.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return nil, errors.New("could not read the version of the cluster: " + err.Error())
+	}
+	logger.Info("Cluster version: " + info.GitVersion)
+	serverMinor := version.MustParseGeneric(strconv.Itoa(int(serverVersion.Major())) + "." + strconv.Itoa(int(serverVersion.Minor())))
+	if serverMinor.LessThan(minServerVersion) || maxServerVersion.LessThan(serverMinor) {
+		warnings = append(warnings, "the cluster runs Kubernetes "+info.GitVersion+", out of the range Rooster is supported on ("+minServerVersion.String()+" to "+maxServerVersion.String()+")")
+	}
+	var missing []string
+	for _, groupVersion := range requiredAPIs {
+		if _, err := discovery.ServerResourcesForGroupVersion(groupVersion); err != nil {
+			logger.Info("API " + groupVersion + ": unavailable (" + err.Error() + ")")
+			missing = append(missing, groupVersion)
+			continue
+		}
+		logger.Info("API " + groupVersion + ": available")
+	}
+	if len(missing) > 0 {
+		return warnings, errors.New("the cluster does not serve the APIs Rooster requires: " + strings.Join(missing, ", "))
+	}
+	return warnings, nil
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"rooster/pkg/config"
+	"rooster/pkg/utils"
+
+	"go.uber.org/zap"
+)
+
+// PlanClusterPromotion sets up the rollout of the version a project runs in the source cluster to the destination cluster.
+// The version is the value of the canary label all the target nodes of the source carry: a rollout still in progress there is refused.
+// manifestPath: manifests of the version. Left empty, the manifests are read from the backup of the version, recorded when it was rolled out.
+// No update is returned when the destination runs the version already
+func PlanClusterPromotion(logger *zap.Logger, source FleetCluster, destination FleetCluster, project string, manifestPath string) (update *FleetUpdate, err error) {
+	sourceClient, err := UseFleetCluster(source)
+	if err != nil {
+		return
+	}
+	version, err := clusterVersion(sourceClient, source.Name, project)
+	if err != nil {
+		return
+	}
+	if manifestPath == "" {
+		sourceDefaults, err := GetProjectDefaults(sourceClient, project)
+		if err != nil {
+			return nil, err
+		}
+		sourceCanaryLabelKey, _, _ := strings.Cut(sourceDefaults["canary-label"], "=")
+		manifestPath, err = VersionManifests(config.Env.BackupDirectory, sourceCanaryLabelKey+"="+version)
+		if err != nil {
+			return nil, errors.New(err.Error() + ". Indicate the manifests of version " + version + " with --manifest-path")
+		}
+	}
+	if !checkDirectoryExistence(manifestPath) {
+		return nil, errors.New("the manifests of version " + version + " are not found at " + manifestPath + ". Indicate them with --manifest-path")
+	}
+	logger.Info("Cluster " + source.Name + " runs version " + version + " of project " + project + ", rolled out from " + manifestPath)
+	destinationClient, err := UseFleetCluster(destination)
+	if err != nil {
+		return
+	}
+	entries, err := clusterComplianceEntries(destinationClient, destination.Name, map[string]string{project: version})
+	if err != nil {
+		return
+	}
+	entry, _ := projectEntry(entries, project)
+	canaryLabelKey := ""
+	if entry.Status == laggingStatus || entry.Status == rollingStatus {
+		defaults, err := GetProjectDefaults(destinationClient, project)
+		if err != nil {
+			return nil, err
+		}
+		canaryLabelKey, _, _ = strings.Cut(defaults["canary-label"], "=")
+	}
+	update, err = PlanPromotionUpdate(destination, entry, canaryLabelKey, manifestPath)
+	if err == nil && update == nil {
+		logger.Info("Cluster " + destination.Name + " runs version " + version + " already")
+	}
+	return
+}
+
+// PlanPromotionUpdate returns the rollout bringing the project of the destination cluster to the desired version of its entry,
+// nil when it runs it already. A rollout in progress is promoted. No cluster is needed
+func PlanPromotionUpdate(destination FleetCluster, entry FleetReportEntry, canaryLabelKey string, manifestPath string) (*FleetUpdate, error) {
+	switch entry.Status {
+	case missingStatus:
+		return nil, errors.New("project " + entry.Project + " is not initialized in cluster " + destination.Name + ". Run a first rollout there with --initialize")
+	case unknownStatus:
+		return nil, errors.New("cluster " + destination.Name + ": " + entry.Error)
+	case compliantStatus:
+		return nil, nil
+	}
+	if canaryLabelKey == "" {
+		return nil, errors.New("project " + entry.Project + " has no canary label in cluster " + destination.Name)
+	}
+	return &FleetUpdate{
+		Cluster:      destination,
+		Project:      entry.Project,
+		CanaryLabel:  canaryLabelKey + "=" + entry.Desired,
+		ManifestPath: manifestPath,
+		Promote:      entry.Status == rollingStatus,
+	}, nil
+}
+
+// clusterVersion returns the version all the target nodes of the project run in the cluster
+func clusterVersion(kubernetesClient *utils.K8sClient, cluster string, project string) (string, error) {
+	entries, err := clusterComplianceEntries(kubernetesClient, cluster, nil)
+	if err != nil {
+		return "", err
+	}
+	entry, found := projectEntry(entries, project)
+	if !found {
+		return "", errors.New("project " + project + " is not found in cluster " + cluster)
+	}
+	if entry.Error != "" {
+		return "", errors.New("cluster " + cluster + ": " + entry.Error)
+	}
+	versions := make([]string, 0, len(entry.Versions))
+	for version := range entry.Versions {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	if len(versions) != 1 || versions[0] == unlabeledVersion {
+		return "", errors.New("the target nodes of project " + project + " in cluster " + cluster + " do not run a single version: " + strings.Join(versions, ", ") + ". Complete the rollout there first")
+	}
+	return versions[0], nil
+}
+
+func projectEntry(entries []FleetReportEntry, project string) (FleetReportEntry, bool) {
+	for _, entry := range entries {
+		if entry.Project == project {
+			return entry, true
+		}
+	}
+	return FleetReportEntry{}, false
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+	apps_v1 "k8s.io/api/apps/v1"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+// Annotation of the DaemonSet pod templates, holding the hash of the ConfigMaps & Secrets their pods use.
+// A configuration change changes the pod template, and restarts the pods like any other change
+const configHashAnnotation = "rooster/config-hash"
+
+// renderConfigHashes stamps the hash of the configuration they use on the DaemonSets of the manifests.
+// The resulting manifests are written in a temporary directory, whose path is returned. Nothing is rendered when no DaemonSet uses a ConfigMap or a Secret of the manifests.
+// The manifests are read twice, one document at a time, so that large manifest sets are never held in memory
+func renderConfigHashes(logger *zap.Logger, manifestPath string) (renderedPath string, err error) {
+	files, err := listManifestFiles(manifestPath)
+	if err != nil {
+		return
+	}
+	// 1st pass: hash the configuration, and keep the pod specs of the DaemonSets
+	configHashes := make(map[string]string)
+	podSpecs := make(map[string]core_v1.PodSpec)
+	for _, file := range files {
+		err = streamDocuments(file, func(document map[string]interface{}) error {
+			switch document["kind"] {
+			case "ConfigMap", "Secret":
+				hash, err := configurationHash(document)
+				if err != nil {
+					return err
+				}
+				configHashes[document["kind"].(string)+"/"+documentName(document)] = hash
+			case "DaemonSet":
+				daemonSet, err := toDaemonSet(document)
+				if err != nil {
+					return err
+				}
+				podSpecs[daemonSet.Name] = daemonSet.Spec.Template.Spec
+			}
+			return nil
+		})
+		if err != nil {
+			return
+		}
+	}
+	daemonSetHashes := make(map[string]string)
+	for name, podSpec := range podSpecs {
+		if hash := podConfigHash(podSpec, configHashes); hash != "" {
+			logger.Info("Configuration hash of DaemonSet " + name + ": " + hash)
+			daemonSetHashes[name] = hash
+		}
+	}
+	if len(daemonSetHashes) == 0 {
+		return
+	}
+	renderedPath, err = os.MkdirTemp("", "rooster_config_hash_*")
+	if err != nil {
+		return
+	}
+	// 2nd pass: write the documents, the DaemonSets being stamped
+	for _, file := range files {
+		err = streamDocuments(file, func(document map[string]interface{}) error {
+			kind, _ := document["kind"].(string)
+			name := documentName(document)
+			if kind == "" || name == "" {
+				return nil
+			}
+			if hash, found := daemonSetHashes[name]; found && kind == "DaemonSet" {
+				setTemplateAnnotation(document, configHashAnnotation, hash)
+			}
+			content, err := yaml.Marshal(document)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(filepath.Join(renderedPath, kind+"_"+name+".yaml"), content, 0644)
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return
+}
+
+func documentName(document map[string]interface{}) string {
+	metadata, _ := document["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	return name
+}
+
+func toDaemonSet(document map[string]interface{}) (daemonSet apps_v1.DaemonSet, err error) {
+	content, err := json.Marshal(document)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(content, &daemonSet)
+	return
+}
+
+// configurationHash hashes the content of a ConfigMap or a Secret
+func configurationHash(document map[string]interface{}) (string, error) {
+	// Maps are marshalled with sorted keys: the hash does not depend on the order of the manifest
+	content, err := json.Marshal([]interface{}{document["data"], document["binaryData"], document["stringData"]})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// podConfigHash combines the hashes of the ConfigMaps & Secrets of the manifests the pods use. Empty when they use none
+func podConfigHash(podSpec core_v1.PodSpec, configHashes map[string]string) string {
+	references := make(map[string]bool)
+	for _, volume := range podSpec.Volumes {
+		if volume.ConfigMap != nil {
+			references["ConfigMap/"+volume.ConfigMap.Name] = true
+		}
+		if volume.Secret != nil {
+			references["Secret/"+volume.Secret.SecretName] = true
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.ConfigMap != nil {
+					references["ConfigMap/"+source.ConfigMap.Name] = true
+				}
+				if source.Secret != nil {
+					references["Secret/"+source.Secret.Name] = true
+				}
+			}
+		}
+	}
+	for _, container := range append(podSpec.InitContainers, podSpec.Containers...) {
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.ConfigMapRef != nil {
+				references["ConfigMap/"+envFrom.ConfigMapRef.Name] = true
+			}
+			if envFrom.SecretRef != nil {
+				references["Secret/"+envFrom.SecretRef.Name] = true
+			}
+		}
+		for _, env := range container.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			if env.ValueFrom.ConfigMapKeyRef != nil {
+				references["ConfigMap/"+env.ValueFrom.ConfigMapKeyRef.Name] = true
+			}
+			if env.ValueFrom.SecretKeyRef != nil {
+				references["Secret/"+env.ValueFrom.SecretKeyRef.Name] = true
+			}
+		}
+	}
+	// Only the configuration shipped with the manifests is tracked
+	used := []string{}
+	for reference := range references {
+		if hash, found := configHashes[reference]; found {
+			used = append(used, reference+"="+hash)
+		}
+	}
+	if len(used) == 0 {
+		return ""
+	}
+	sort.Strings(used)
+	content, _ := json.Marshal(used)
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func setTemplateAnnotation(daemonSet map[string]interface{}, key string, value string) {
+	spec := childMap(daemonSet, "spec")
+	template := childMap(spec, "template")
+	metadata := childMap(template, "metadata")
+	annotations := childMap(metadata, "annotations")
+	annotations[key] = value
+}
+
+// childMap returns the map held under the key, created when missing
+func childMap(parent map[string]interface{}, key string) map[string]interface{} {
+	child, found := parent[key].(map[string]interface{})
+	if !found {
+		child = make(map[string]interface{})
+		parent[key] = child
+	}
+	return child
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"fmt"
+	"strings"
+
+	"rooster/pkg/config"
+
+	"go.uber.org/zap"
+)
+
+// Policies of --on-existing-canary
+const (
+	abortOnExistingCanary    = "abort"
+	continueOnExistingCanary = "continue"
+)
+
+// Set by --non-interactive: the user is never asked
+var nonInteractive bool
+
+// SetNonInteractive keeps Confirm from reading the standard input. The questions left to the user are answered no
+func SetNonInteractive(enabled bool) {
+	nonInteractive = enabled
+}
+
+// Confirm tells whether the action goes ahead. The confirmation policy answers, or has the user asked.
+// assumeYes answers yes to the questions the user would be asked. In non-interactive mode, they are answered no
+func Confirm(logger *zap.Logger, action string, question string, assumeYes bool) bool {
+	switch config.Env.Confirmation(action) {
+	case config.YesAnswer:
+		logger.Info(question + " Yes, as set by the confirmation policy of " + action)
+		return true
+	case config.NoAnswer:
+		logger.Info(question + " No, as set by the confirmation policy of " + action)
+		return false
+	}
+	if assumeYes {
+		logger.Info(question + " Yes, as assumed with --yes")
+		return true
+	}
+	if nonInteractive {
+		logger.Warn(question + " No, as nobody is asked in non-interactive mode. Use --yes, or the confirmation policy of " + action)
+		return false
+	}
+	var response string
+	fmt.Println(question + " (y/n)")
+	fmt.Scanln(&response)
+	return strings.EqualFold(response, "Y")
+}
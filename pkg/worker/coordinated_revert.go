@@ -0,0 +1,67 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"rooster/pkg/config"
+	"rooster/pkg/utils"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+// RevertProjects reverts the rollouts of several projects, in order, and reports their outcome together.
+// Coordinated, the canary labels of all the projects are removed before any resource is reverted: the agents sharing
+// the nodes, e.g. a CNI & a network policy agent, leave the nodes together rather than one project after the other
+func RevertProjects(kubernetesClient *utils.K8sClient, logger *zap.Logger, projects []config.RoosterOptions, coordinated bool) bool {
+	clients := Clients{}
+	clients.K8sClient = *kubernetesClient
+	reverted := make([]bool, len(projects))
+	if coordinated {
+		canaryNodes := make([][]core_v1.Node, len(projects))
+		for i, options := range projects {
+			logger.Info("Removing the canary label " + options.CanaryLabel + " of project " + options.Project)
+			canaryNodes[i] = clients.releaseCanaryNodes(logger, options)
+		}
+		for i, options := range projects {
+			logger.Info("Reverting the resources of project " + options.Project)
+			reverted[i] = clients.recordRevert(logger, options, func() bool {
+				return clients.revertResources(logger, options, canaryNodes[i])
+			})
+		}
+	} else {
+		for i, options := range projects {
+			logger.Info("Reverting project " + options.Project)
+			reverted[i] = RevertDeployment(kubernetesClient, logger, options)
+		}
+	}
+	// Combined report
+	succeeded := true
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROJECT\tCANARY LABEL\tREVERTED")
+	for i, options := range projects {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", options.Project, options.CanaryLabel, strconv.FormatBool(reverted[i]))
+		succeeded = succeeded && reverted[i]
+	}
+	w.Flush()
+	return succeeded
+}
@@ -18,10 +18,10 @@ package worker
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
-	"fmt"
-	"math"
+	"os"
+	"os/exec"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -31,8 +31,13 @@ import (
 
 	"go.uber.org/zap"
 	core_v1 "k8s.io/api/core/v1"
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
 )
 
 const (
@@ -56,108 +61,436 @@ type basicK8sConfiguration struct {
 }
 
 type basicK8sMetadata struct {
-	Name      string `json:"name"`
-	Namespace string `json:"namespace"`
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	Annotations map[string]string `json:"annotations"`
 }
 
-func ProceedToDeployment(kubernetesClient *utils.K8sClient, logger *zap.Logger, manifestPath string, dryRun bool, targetLabel string, canaryLabel string, canary int, targetNamespace string, testPackage string, testBinary string) bool {
+func ProceedToDeployment(kubernetesClient *utils.K8sClient, logger *zap.Logger, options config.RoosterOptions) (succeeded bool) {
 	// Client settings
 	clients := Clients{}
 	clients.K8sClient = *kubernetesClient
-	// What to deploy
-	targetResources := readmanifestFiles(logger, manifestPath, targetNamespace)
+	initiator := determineInitiator()
+	logger.Info("Rollout initiated by " + initiator)
+	// State transitions, for log pipelines
+	events, err := newEventRecorder(logger, options.EventsFile, initiator, options.ManifestPath, options.CanaryLabel)
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	defer events.close()
+	events.record(rolloutEvent{Type: rolloutStartedEvent, DryRun: options.DryRun})
+	// Why the rollout failed. Updated as the rollout goes past its preflight checks
+	reason := preflightFailedReason
+	defer func() {
+		if succeeded && options.CanaryOnly {
+			events.record(rolloutEvent{Type: canaryCompletedEvent, DryRun: options.DryRun})
+			return
+		}
+		if succeeded {
+			events.record(rolloutEvent{Type: rolloutCompletedEvent, DryRun: options.DryRun})
+			return
+		}
+		lastFailureReason = reason
+		events.record(rolloutEvent{Type: rolloutFailedEvent, Reason: reason, DryRun: options.DryRun})
+	}()
+	// Preflight findings, in a machine readable format
+	findings, err := newFindingsReport(options.FindingsFormat, options.FindingsFile)
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	defer func() {
+		if err := findings.write(); err != nil {
+			logger.Error(err.Error())
+		}
+	}()
+	// Labels left by abandoned rollouts
+	if err = clients.expireCanaryLabels(logger, options.CanaryLabel, events, options.DryRun); err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	// Preflight checks, on the rendered manifests. Their warnings & failures are reported as findings
+	preflight, cleanup, preflightReason := clients.renderAndValidate(logger, options, initiator, false, findings)
+	defer cleanup()
+	if preflight == nil {
+		reason = preflightReason
+		return false
+	}
+	// Backed up along with the version, once rolled out
+	sourceManifests := options.ManifestPath
+	options.ManifestPath = preflight.options.ManifestPath
 	// Verify the canary label
-	if valid := clients.validateCanaryLabel(logger, canaryLabel); !valid {
+	if preflight.existingCanary && !confirmExistingCanary(logger, options.OnExistingCanary, options.AssumeYes) {
+		reason = existingCanaryReason
+		findings.addWarning("Nodes already carry the canary label " + options.CanaryLabel + ". The rollout was aborted")
 		return false
 	}
-	// Where to deploy it
-	customOptions := meta_v1.ListOptions{}
-	customOptions.LabelSelector = targetLabel
-	targetNodes := clients.getTargetNodes(logger, targetLabel, customOptions)
-	canaryTargetNodes, batchSize := defineCanaryBatchSize(logger, targetNodes, canary)
-	logger.Info("Patching nodes...")
-	patchComplete := clients.patchTargetNodes(logger, canaryTargetNodes, canaryLabel, batchSize, dryRun)
-	if !patchComplete {
-		logger.Warn("Issues encountered while patching nodes. Aborting...")
+	targetResources := preflight.targetResources
+	canary, profile := preflight.canary, preflight.profile
+	identities := preflight.identities
+	successCriteria := preflight.successCriteria
+	testSuites := preflight.testSuites
+	devicePlugin := preflight.devicePlugin
+	targetNodes := preflight.targetNodes
+	if err = clients.orderTargetNodes(logger, targetNodes.Items, options); err != nil {
+		findings.addError(err)
+		logger.Error(err.Error())
 		return false
 	}
-	// make sure the latest version will be deployed by removing the old ones first
-	_, err := clients.deletePreviousSettings(logger, targetResources, dryRun, true)
+	batches := planBatches(targetNodes.Items, canary, profile)
+	canaryTargetNodes := batches[0]
+	logger.Info("Batch size: " + strconv.Itoa(len(canaryTargetNodes)) + "/" + strconv.Itoa(len(targetNodes.Items)))
+	events.record(rolloutEvent{Type: rolloutPlannedEvent, Message: strconv.Itoa(len(batches)) + " batches over " + strconv.Itoa(len(targetNodes.Items)) + " nodes"})
+	// Make sure the nodes meet the prerequisites
+	conformance, err := loadNodeConformance(config.Env.NodeConformanceFile)
 	if err != nil {
+		logger.Error(err.Error())
 		return false
 	}
-	if dryRun {
+	canaryTargetNodes, err = conformance.filterCanaryBatch(logger, canaryTargetNodes)
+	if err != nil {
+		reason = nodeConformanceReason
+		findings.addError(err)
+		logger.Error(err.Error())
+		return false
+	}
+	// The nodes left out by the conformance checks are not labeled
+	batchSize := float64(len(canaryTargetNodes))
+	// Detect the admission policies rejecting the canary label before patching the fleet
+	if len(canaryTargetNodes) > 0 {
+		canaryLabelKey, canaryLabelValue, _ := strings.Cut(options.CanaryLabel, "=")
+		if err = clients.preflightNodePatch(logger, canaryTargetNodes[0], canaryLabelKey, canaryLabelValue); err != nil {
+			findings.addError(err)
+			logger.Error(err.Error())
+			return false
+		}
+	}
+	if options.NotifyTenants && !options.DryRun {
+		clients.notifyTenants(logger, 0, canaryTargetNodes, initiator)
+	}
+	// Phase of each node, batch after batch
+	statuses := newNodeStatusTable(append([][]core_v1.Node{canaryTargetNodes}, batches[1:]...))
+	logger.Info("Patching nodes...")
+	labeledAt := time.Now()
+	patchComplete := clients.patchTargetNodes(logger, canaryTargetNodes, options.CanaryLabel, batchSize, options.DryRun)
+	if !patchComplete {
+		reason = patchFailedReason
+		logger.Warn("Issues encountered while patching nodes. Aborting...")
+		return false
+	}
+	canaryCoverage := 0
+	if len(targetNodes.Items) > 0 {
+		canaryCoverage = len(canaryTargetNodes) * 100 / len(targetNodes.Items)
+	}
+	events.recordBatch(batchPatchedEvent, 0, canaryTargetNodes, canaryCoverage)
+	statuses.set(canaryTargetNodes, 0, nodeLabeledPhase)
+	if options.CanaryLabelTTL > 0 && !options.DryRun {
+		setCanaryLabelExpiry(logger, canaryTargetNodes, options.CanaryLabelTTL)
+	}
+	if options.AnnotateNodes && !options.DryRun {
+		setRolloutAnnotations(logger, canaryTargetNodes, options, 0)
+	}
+	// Keep a copy of the live resources. Server-side apply merges the new manifests into them, without deleting anything
+	logger.Info("Backing up resources")
+	if completed, _ := backupResources(logger, targetResources, options.RedactSecrets); !completed {
+		logger.Warn("Backup failed. Resources that are not deployed yet cannot be backed up")
+	}
+	if options.DryRun {
+		// The canary batch, as filtered by the conformance checks
+		plannedBatches := append([][]core_v1.Node{canaryTargetNodes}, batches[1:]...)
+		if options.ExternalStrategy != "" {
+			// The increments are decided as the rollout goes
+			logger.Info("The increments are decided by the external strategy " + options.ExternalStrategy)
+			plannedBatches = plannedBatches[:1]
+		}
+		if err = clients.printExecutionPlan(logger, plannedBatches, targetResources, options.ManifestPath, identities, options.CreateNamespace, initiator); err != nil {
+			logger.Error(err.Error())
+			return false
+		}
 		logger.Info("As dry as it gets")
 		return true
 	}
-	err = deployResources(logger, manifestPath)
+	// Namespaces created now are deleted if the deployment is reverted
+	createdNamespaces := []string{}
+	if options.CreateNamespace {
+		createdNamespaces, err = clients.createMissingNamespaces(logger, targetResources, options.NamespaceLabels, options.NamespaceAnnotations)
+		if err != nil {
+			reason = deployFailedReason
+			logger.Error(err.Error())
+			return false
+		}
+	}
+	if err = recordCreatedNamespaces(config.Env.BackupDirectory, createdNamespaces); err != nil {
+		reason = deployFailedReason
+		logger.Error(err.Error())
+		return false
+	}
+	err = deployResources(logger, options.ManifestPath, clients.useServerSideApply(logger), identities)
 	if err != nil {
+		reason = deployFailedReason
 		logger.Error(err.Error())
 		return false
 	}
-	statusReport := clients.areResourcesReady(logger, targetResources)
-	if statusReport == nil {
+	recordInitiator(logger, targetResources, initiator)
+	events.record(rolloutEvent{Type: resourcesDeployedEvent})
+	// The nodes that did not get ready are tolerated, up to --max-node-failures
+	canaryTargetNodes = clients.awaitBatchNodes(logger, statuses, targetResources, 0, canaryTargetNodes, labeledAt)
+	if err := checkNodeFailures(statuses, options.MaxNodeFailures); err != nil {
+		reason = readinessTimeoutReason
+		logger.Error(err.Error())
 		return false
 	}
-	for resource, readinessStatus := range statusReport {
-		if !readinessStatus {
-			kind := getAttribute(resource, 0)
-			name := getAttribute(resource, 1)
-			logger.Warn("Issues encountered with " + kind + " " + name)
+	// Readiness is evaluated on the patched nodes only. The DaemonSets may run on other nodes of a shared cluster
+	patchedNodeList := canaryTargetNodes
+	if successCriteria == nil {
+		if ready := clients.verifyResourcesStatus(logger, targetResources, patchedNodeList); !ready {
+			reason = readinessTimeoutReason
+			return false
+		}
+	}
+	if devicePlugin {
+		if err = clients.verifyDeviceResources(logger, canaryTargetNodes); err != nil {
+			reason = deviceResourcesReason
+			logger.Error(err.Error())
+			return false
+		}
+	}
+	if options.NetworkProbe {
+		if err = clients.probeNodeNetworks(logger, canaryTargetNodes); err != nil {
+			reason = networkProbeReason
+			logger.Error(err.Error())
+			return false
+		}
+	}
+	if len(options.HealthGates) > 0 {
+		if err = clients.checkHealthGates(logger, options.HealthGates, canaryTargetNodes); err != nil {
+			reason = healthGateFailedReason
+			logger.Error(err.Error())
 			return false
 		}
 	}
-	// Run the tests
-	err = runTests(logger, testPackage, testBinary)
+	// Run the test suites due after the canary batch
+	testsRun, err := clients.testBatch(logger, options, testSuites, 0, canaryTargetNodes, len(batches) == 1 && options.ExternalStrategy == "", events)
+	testsPassed := err == nil
 	if err != nil {
 		logger.Error(err.Error())
 		logger.Warn("Tests have failed.")
-		return false
+		reason = testFailureReason
+		// The success criteria decide whether failed tests block the promotion
+		if successCriteria == nil {
+			return false
+		}
 	}
-	// Complete the rollout
-	otherNodes := defineRestOfNodes(targetNodes, len(canaryTargetNodes))
-	logger.Info("Patching remaining nodes...")
-	patchComplete = clients.patchTargetNodes(logger, otherNodes, canaryLabel, batchSize, dryRun)
-	if !patchComplete {
-		logger.Warn("Issues encountered while patching nodes. Aborting...")
-		return false
+	if successCriteria != nil {
+		if met := clients.judgeBatch(logger, successCriteria, targetResources, patchedNodeList, testsRun, testsPassed); !met {
+			reason = judgementReason(successCriteria)
+			return false
+		}
 	}
-	// Check if all resources are ready after the patch operation
-	statusReport = clients.areResourcesReady(logger, targetResources)
-	if statusReport == nil {
-		return false
+	events.recordBatch(batchVerifiedEvent, 0, canaryTargetNodes, canaryCoverage)
+	statuses.set(canaryTargetNodes, 0, nodeVerifiedPhase)
+	// The remaining nodes are left to rooster promote
+	if options.CanaryOnly {
+		// The canary batch is the last one of the run
+		if recovered := clients.retryFailedNodes(logger, statuses, targetResources); len(recovered) > 0 {
+			events.record(rolloutEvent{Type: nodesRecoveredEvent, Nodes: nodeNames(recovered)})
+		}
+		if options.MaxPause > 0 && !options.DryRun {
+			setPauseDeadline(logger, canaryTargetNodes, options.MaxPause, options.OnMaxPause)
+			logger.Info("Unless promoted within " + options.MaxPause.String() + ", the rollout is " + pauseOutcome(options.OnMaxPause) + " by rooster check-pause")
+		}
+		logger.Info("The canary batch is verified. Run rooster promote with the same options to patch the remaining nodes")
+		return true
 	}
-	for resource, readinessStatus := range statusReport {
-		if !readinessStatus {
-			kind := getAttribute(resource, 0)
-			name := getAttribute(resource, 1)
-			logger.Warn("Issues encountered with " + kind + " " + name)
+	// Let the canary batch prove itself over time before the fleet is exposed
+	if options.CanaryHold > 0 && (len(batches) > 1 || options.ExternalStrategy != "") {
+		// Should Rooster stop during the hold, rooster check-pause takes over once the pause is over
+		if options.MaxPause > 0 && !options.DryRun {
+			setPauseDeadline(logger, canaryTargetNodes, options.MaxPause, options.OnMaxPause)
+		}
+		if held := clients.holdCanary(logger, options.CanaryHold, successCriteria, targetResources, patchedNodeList, testsRun, testsPassed); !held {
+			reason = judgementReason(successCriteria)
+			return false
+		}
+		if options.MaxPause > 0 && !options.DryRun {
+			canaryLabelKey := strings.Split(options.CanaryLabel, "=")[0]
+			clearPauseDeadline(logger, clients.ensureCanaryLabelPropagation(logger, canaryLabelKey, options.CanaryLabel))
+		}
+		events.record(rolloutEvent{Type: canaryHeldEvent, Message: options.CanaryHold.String()})
+	}
+	// Complete the rollout, increment after increment
+	patchedNodes := int(batchSize)
+	for i := 0; ; i++ {
+		batch, lastBatch, done, err := nextIncrement(logger, options, batches[1:], i+1, targetNodes.Items, patchedNodeList)
+		if err != nil {
+			reason = strategyFailedReason
+			logger.Error(err.Error())
+			return false
+		}
+		if done {
+			break
+		}
+		if profile.soak > 0 {
+			logger.Info("Soaking for " + profile.soak.String() + " before the next increment")
+			waitForResources(profile.soak)
+			if met := clients.judgeBatch(logger, successCriteria, targetResources, patchedNodeList, testsRun, testsPassed); !met {
+				reason = judgementReason(successCriteria)
+				return false
+			}
+		}
+		otherNodes, err := conformance.filterNodes(logger, batch)
+		if err != nil {
+			reason = nodeConformanceReason
+			logger.Error(err.Error())
+			return false
+		}
+		coverage := (patchedNodes + len(otherNodes)) * 100 / len(targetNodes.Items)
+		if options.NotifyTenants {
+			clients.notifyTenants(logger, i+1, otherNodes, initiator)
+		}
+		logger.Info("Patching remaining nodes... Coverage: " + strconv.Itoa(coverage) + "%")
+		// The nodes patched so far carry the canary label already
+		labeledAt = time.Now()
+		patchComplete = clients.patchTargetNodes(logger, otherNodes, options.CanaryLabel, float64(patchedNodes), options.DryRun)
+		if !patchComplete {
+			reason = patchFailedReason
+			logger.Warn("Issues encountered while patching nodes. Aborting...")
+			return false
+		}
+		patchedNodes += len(otherNodes)
+		if options.CanaryLabelTTL > 0 {
+			setCanaryLabelExpiry(logger, otherNodes, options.CanaryLabelTTL)
+		}
+		if options.AnnotateNodes {
+			setRolloutAnnotations(logger, otherNodes, options, i+1)
+		}
+		events.recordBatch(batchPatchedEvent, i+1, otherNodes, coverage)
+		statuses.set(otherNodes, i+1, nodeLabeledPhase)
+		otherNodes = clients.awaitBatchNodes(logger, statuses, targetResources, i+1, otherNodes, labeledAt)
+		// The failed nodes are retried after the last batch. Until then, they count against --max-node-failures
+		if err := checkNodeFailures(statuses, options.MaxNodeFailures); err != nil {
+			reason = readinessTimeoutReason
+			logger.Error(err.Error())
+			return false
+		}
+		patchedNodeList = append(patchedNodeList, otherNodes...)
+		if devicePlugin {
+			if err = clients.verifyDeviceResources(logger, otherNodes); err != nil {
+				reason = deviceResourcesReason
+				logger.Error(err.Error())
+				return false
+			}
+		}
+		if options.NetworkProbe {
+			if err = clients.probeNodeNetworks(logger, otherNodes); err != nil {
+				reason = networkProbeReason
+				logger.Error(err.Error())
+				return false
+			}
+		}
+		if len(options.HealthGates) > 0 {
+			if err = clients.checkHealthGates(logger, options.HealthGates, otherNodes); err != nil {
+				reason = healthGateFailedReason
+				logger.Error(err.Error())
+				return false
+			}
+		}
+		// The suites due after this batch. The signals reflect the latest run
+		batchTestsRun, err := clients.testBatch(logger, options, testSuites, i+1, otherNodes, lastBatch, events)
+		if batchTestsRun {
+			testsRun, testsPassed = true, err == nil
+		}
+		if err != nil {
+			logger.Error(err.Error())
+			logger.Warn("Tests have failed.")
+			reason = testFailureReason
+			if successCriteria == nil {
+				return false
+			}
+		}
+		// Check if all resources are ready after the patch operation
+		if met := clients.judgeBatch(logger, successCriteria, targetResources, patchedNodeList, testsRun, testsPassed); !met {
+			reason = judgementReason(successCriteria)
 			return false
 		}
+		events.recordBatch(batchVerifiedEvent, i+1, otherNodes, coverage)
+		statuses.set(otherNodes, i+1, nodeVerifiedPhase)
+	}
+	// Transient node issues get a second chance
+	if recovered := clients.retryFailedNodes(logger, statuses, targetResources); len(recovered) > 0 {
+		patchedNodeList = append(patchedNodeList, recovered...)
+		events.record(rolloutEvent{Type: nodesRecoveredEvent, Nodes: nodeNames(recovered)})
 	}
+	if options.CanaryLabelTTL > 0 {
+		clearCanaryLabelExpiry(logger, patchedNodeList)
+	}
+	recordVersionBackup(logger, options, sourceManifests, targetResources)
 	logger.Info("The canary realease is now complete.")
 	return true
 }
 
-func RevertDeployment(kubernetesClient *utils.K8sClient, logger *zap.Logger, manifestPath string, targetLabel string, canaryLabel string, targetNamespace string) bool {
+func RevertDeployment(kubernetesClient *utils.K8sClient, logger *zap.Logger, options config.RoosterOptions) (succeeded bool) {
 	// Client settings
 	clients := Clients{}
 	clients.K8sClient = *kubernetesClient
+	return clients.recordRevert(logger, options, func() bool {
+		canaryNodes := clients.releaseCanaryNodes(logger, options)
+		return clients.revertResources(logger, options, canaryNodes)
+	})
+}
+
+// recordRevert runs the revert, recording its start & its outcome in the events file
+func (c Clients) recordRevert(logger *zap.Logger, options config.RoosterOptions, revert func() bool) (succeeded bool) {
+	events, err := newEventRecorder(logger, options.EventsFile, determineInitiator(), options.ManifestPath, options.CanaryLabel)
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	defer events.close()
+	events.record(rolloutEvent{Type: revertStartedEvent})
+	defer func() {
+		if succeeded {
+			events.record(rolloutEvent{Type: revertCompletedEvent})
+			return
+		}
+		events.record(rolloutEvent{Type: revertFailedEvent})
+	}()
+	return revert()
+}
+
+// releaseCanaryNodes removes the canary label from the target nodes. The nodes carrying it are returned
+func (c Clients) releaseCanaryNodes(logger *zap.Logger, options config.RoosterOptions) (canaryNodes []core_v1.Node) {
 	// the labels
-	canaryLabelElements := strings.Split(canaryLabel, "=")
+	canaryLabelElements := strings.Split(options.CanaryLabel, "=")
 	canaryLabelKey := canaryLabelElements[0]
+	// Recorded in the snapshot, so that the revert can be undone
+	canaryNodes = c.ensureCanaryLabelPropagation(logger, canaryLabelKey, options.CanaryLabel)
 	customOptions := meta_v1.ListOptions{}
-	customOptions.LabelSelector = targetLabel
-	targetNodes := clients.getTargetNodes(logger, targetLabel, customOptions)
+	customOptions.LabelSelector = options.TargetLabel
+	targetNodes := c.getTargetNodes(logger, options.TargetLabel, customOptions)
 	for _, targetNode := range targetNodes.Items {
-		_, err := clients.removeLabelFromNode(logger, targetNode, targetLabel, canaryLabelKey)
+		_, err := c.removeLabelFromNode(logger, targetNode, options.TargetLabel, canaryLabelKey)
 		if err != nil {
 			logger.Error(err.Error())
 		}
 	}
+	if options.AnnotateNodes {
+		clearRolloutAnnotations(logger, canaryNodes)
+	}
+	clearPauseDeadline(logger, canaryNodes)
+	return
+}
+
+// revertResources deletes the deployed resources, and redeploys the backed up ones
+func (c Clients) revertResources(logger *zap.Logger, options config.RoosterOptions, canaryNodes []core_v1.Node) bool {
 	// The resources
 	// Get the new resources
-	targetResources := readmanifestFiles(logger, manifestPath, targetNamespace)
+	targetResources, err := ReadManifestFiles(logger, options.ManifestPath, options.Namespace)
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
 	// Get the backup directory
 	backupDirectory := config.Env.BackupDirectory
 	if backupDirectory == "" {
@@ -165,46 +498,98 @@ func RevertDeployment(kubernetesClient *utils.K8sClient, logger *zap.Logger, man
 		return false
 	}
 	// delete new resources & redeploy the old ones
-	opComplete, err := clients.rollbackToPreviousSettings(logger, targetResources, backupDirectory)
+	identities, err := parseNamespaceIdentities(options.NamespaceIdentities, options.Namespace)
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	// The live resources are deleted: keep a copy of them
+	if !options.NoBackup {
+		if _, err = snapshotResources(logger, revertOperation, targetResources, options.RedactSecrets, options.CanaryLabel, canaryNodes); err != nil {
+			logger.Error(err.Error())
+			return false
+		}
+	}
+	opComplete, err := c.rollbackToPreviousSettings(logger, targetResources, backupDirectory, identities, options.IgnoreNotFound)
 	if err != nil {
 		logger.Error(err.Error())
 		return opComplete
 	}
 	// Check if all resources are ready after the patch operation
-	statusReport := clients.areResourcesReady(logger, targetResources)
-	if statusReport == nil {
+	if ready := c.verifyResourcesStatus(logger, targetResources, nil); !ready {
 		return false
 	}
-	for resource, readinessStatus := range statusReport {
-		if !readinessStatus {
-			kind := getAttribute(resource, 0)
-			name := getAttribute(resource, 1)
-			logger.Warn("Issues encountered with " + kind + " " + name)
-			return false
-		}
+	if err = c.deleteCreatedNamespaces(logger, backupDirectory); err != nil {
+		logger.Error(err.Error())
+		return false
 	}
 	logger.Info("The canary deployment has failed. All resources were reverted")
 	return true
 }
 
-func (c Clients) validateCanaryLabel(logger *zap.Logger, canaryLabel string) bool {
-	// Get nodes that are already labeled with the indicated caanary label
-	customOptions := meta_v1.ListOptions{}
-	customOptions.LabelSelector = canaryLabel
-	nodes := c.getTargetNodes(logger, canaryLabel, customOptions)
-	if len(nodes.Items) > 0 {
-		decision := indicateNextAction()
-		return decision
+func RestoreResource(kubernetesClient *utils.K8sClient, logger *zap.Logger, backupDirectory string, resource string) bool {
+	// Client settings
+	clients := Clients{}
+	clients.K8sClient = *kubernetesClient
+	kind, name, err := parseResourceReference(resource)
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	backupFile := backupFileName(backupDirectory, kind, name)
+	if exists := checkDirectoryExistence(backupFile); !exists {
+		logger.Warn("No backup was found for " + kind + " " + name + " at " + backupFile)
+		return false
+	}
+	if isRedactedBackup(backupFile) {
+		logger.Warn("The secret data of " + kind + " " + name + " was redacted from the backup. It has to be restored manually")
+		return false
+	}
+	// Strip the server-populated fields, so the backup can be re-applied over the live object
+	restoreFile, namespace, err := sanitizeBackupFile(backupFile)
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	defer os.Remove(restoreFile)
+	logger.Info("Restoring " + kind + " " + name + " from " + backupFile)
+	cmd, err := utils.Kubectl(namespace, "apply", restoreFile)
+	if err != nil {
+		logger.Error(cmd)
+		return false
+	}
+	if ready := clients.verifyResourcesStatus(logger, map[string]string{kind + "," + name: namespace}, nil); !ready {
+		return false
 	}
+	logger.Info(kind + " " + name + " was restored")
 	return true
 }
 
-func indicateNextAction() bool {
-	var response string
-	fmt.Println("At least one node was found carrying the indicated canary label.")
-	fmt.Println("Would you like to continue? (y/n)")
-	fmt.Scanln(&response)
-	return strings.EqualFold(response, "Y")
+func parseResourceReference(resource string) (kind string, name string, err error) {
+	// Expected format: Kind/name
+	elements := strings.Split(resource, "/")
+	if len(elements) != 2 || elements[0] == "" || elements[1] == "" {
+		err = errors.New("invalid resource reference \"" + resource + "\". Expected format: Kind/name")
+		return
+	}
+	kind = elements[0]
+	name = elements[1]
+	return
+}
+
+// confirmExistingCanary tells whether the rollout goes ahead when nodes carry the canary label already.
+// onExistingCanary: abort or continue. Left empty, the confirmation policy answers, or the user is asked
+func confirmExistingCanary(logger *zap.Logger, onExistingCanary string, assumeYes bool) bool {
+	question := "At least one node was found carrying the indicated canary label. Would you like to continue?"
+	switch onExistingCanary {
+	case abortOnExistingCanary:
+		logger.Info(question + " No, as set by --on-existing-canary")
+		return false
+	case continueOnExistingCanary:
+		logger.Info(question + " Yes, as set by --on-existing-canary")
+		return true
+	}
+	return Confirm(logger, config.ExistingCanaryAction, question, assumeYes)
 }
 
 func (c Clients) removeLabelFromNode(logger *zap.Logger, targetNode core_v1.Node, targetLabel string, labelKey string) (done bool, err error) {
@@ -221,48 +606,87 @@ func (c Clients) removeLabelFromNode(logger *zap.Logger, targetNode core_v1.Node
 	return true, nil
 }
 
-func (c Clients) rollbackToPreviousSettings(logger *zap.Logger, targetResources map[string]string, pathToBackupDirectory string) (bool, error) {
+func (c Clients) rollbackToPreviousSettings(logger *zap.Logger, targetResources map[string]string, pathToBackupDirectory string, identities *namespaceIdentities, ignoreNotFound bool) (bool, error) {
 	logger.Info("----Rolling back to the previous settings------")
 	// delete the resources that are deployed in the cluster
-	_, err := c.deletePreviousSettings(logger, targetResources, false, false)
+	err := c.deletePreviousSettings(logger, targetResources, queryOptions{ignoreNotFound: ignoreNotFound})
 	if err != nil {
 		return false, err
 	}
 	// deploy the resources that had their config backed up before
-	err = deployResources(logger, pathToBackupDirectory)
+	err = deployResources(logger, pathToBackupDirectory, false, identities)
 	if err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
-func (c Clients) areResourcesReady(logger *zap.Logger, targetResources map[string]string) (resourcesStatus map[string]bool) {
+// verifyResourcesStatus checks the resources are ready. When nodes are given, DaemonSets are checked on those nodes only
+func (c Clients) verifyResourcesStatus(logger *zap.Logger, targetResources map[string]string, nodes []core_v1.Node) bool {
+	statusReport := c.areResourcesReady(logger, targetResources, nodes)
+	if statusReport == nil {
+		return false
+	}
+	if utils.InjectReadinessFlap() {
+		logger.Warn("Chaos: readiness flap injected")
+		return false
+	}
+	for resource, readinessStatus := range statusReport {
+		if !readinessStatus {
+			kind := getAttribute(resource, 0)
+			name := getAttribute(resource, 1)
+			logger.Warn("Issues encountered with " + kind + " " + name)
+			return false
+		}
+	}
+	return true
+}
+
+func (c Clients) areResourcesReady(logger *zap.Logger, targetResources map[string]string, nodes []core_v1.Node) (resourcesStatus map[string]bool) {
 	logger.Info("Waiting for resources to be ready...")
 	waitForResources(20 * time.Second)
 	resourcesStatus = make(map[string]bool, len(targetResources))
 	// 0 for the verb GET
-	allResourcesWereFound, resources := c.queryResources(logger, 0, targetResources, false)
+	allResourcesWereFound, resources := c.queryResources(logger, 0, targetResources, queryOptions{})
 	if !allResourcesWereFound {
 		logger.Warn("Not all indicated resources were found in the cluster. Aborting....")
 		return
 	}
+	rules, err := loadReadinessRules(config.Env.ReadinessRulesFile)
+	if err != nil {
+		logger.Error(err.Error())
+		return nil
+	}
 	for _, kubernetesResource := range resources {
-		k8sObject := kubernetesResource.Object
-		kind := k8sObject["kind"].(string)
-		name := k8sObject["metadata"].(map[string]interface{})["name"].(string)
-		status := make(map[string]interface{})
+		kind := kubernetesResource.GetKind()
+		name := kubernetesResource.GetName()
 		logger.Info("Found " + kind + " " + name)
-		if kind == "DaemonSet" {
-			status = k8sObject["status"].(map[string]interface{})
+		_, customRule := rules[kubernetesResource.GroupVersionKind().GroupKind()]
+		if kind == "DaemonSet" && len(nodes) > 0 && !customRule {
+			ready, err := c.checkDaemonSetPodsOnNodes(kubernetesResource, nodes)
+			if err != nil {
+				logger.Warn(err.Error())
+			}
+			resourcesStatus[kind+","+name] = ready
+			continue
 		}
-		ready := checkResourceStatus(logger, kind, status)
+		ready := checkResourceStatus(logger, rules, kubernetesResource)
 		resourcesStatus[kind+","+name] = ready
 	}
 	return resourcesStatus
 }
 
-func checkResourceStatus(logger *zap.Logger, kind string, status map[string]interface{}) (result bool) {
-	if kind == "DaemonSet" {
+func checkResourceStatus(logger *zap.Logger, rules map[schema.GroupKind]readinessRule, resource unstructured.Unstructured) (result bool) {
+	// User defined rules come first
+	if rule, found := rules[resource.GroupVersionKind().GroupKind()]; found {
+		ready, err := rule.evaluate(resource.Object)
+		if err != nil {
+			logger.Error(err.Error())
+		}
+		return ready
+	}
+	if resource.GetKind() == "DaemonSet" {
+		status, _ := resource.Object["status"].(map[string]interface{})
 		ready, err := checkDaemonSetStatus(status)
 		if err != nil {
 			logger.Error(err.Error())
@@ -283,7 +707,64 @@ func checkDaemonSetStatus(dsStatus map[string]interface{}) (ready bool, err erro
 	return desiredNumberScheduled == numberReady, nil
 }
 
-func deployResources(logger *zap.Logger, manifestPath string) (err error) {
+// checkDaemonSetPodsOnNodes makes sure each of the nodes runs a ready pod of the DaemonSet
+func (c Clients) checkDaemonSetPodsOnNodes(daemonSet unstructured.Unstructured, nodes []core_v1.Node) (ready bool, err error) {
+	for _, node := range nodes {
+		pods, err := c.daemonSetPodsOnNode(daemonSet, node)
+		if err != nil {
+			return false, err
+		}
+		if !hasReadyPod(pods) {
+			return false, errors.New("no ready pod of DaemonSet " + daemonSet.GetName() + " on node " + node.Name)
+		}
+	}
+	return true, nil
+}
+
+// daemonSetPodsOnNode lists the pods of the DaemonSet scheduled on the node
+func (c Clients) daemonSetPodsOnNode(daemonSet unstructured.Unstructured, node core_v1.Node) (pods []core_v1.Pod, err error) {
+	return c.daemonSetPods(daemonSet, "spec.nodeName="+node.Name)
+}
+
+// daemonSetPods lists the pods owned by the DaemonSet. The field selector narrows the list down
+func (c Clients) daemonSetPods(daemonSet unstructured.Unstructured, fieldSelector string) (pods []core_v1.Pod, err error) {
+	matchLabels, _, err := unstructured.NestedStringMap(daemonSet.Object, "spec", "selector", "matchLabels")
+	if err != nil {
+		return
+	}
+	customOptions := meta_v1.ListOptions{}
+	customOptions.LabelSelector = labels.SelectorFromSet(matchLabels).String()
+	customOptions.FieldSelector = fieldSelector
+	podList, err := c.K8sClient.GetClient().CoreV1().Pods(daemonSet.GetNamespace()).List(context.TODO(), customOptions)
+	if err != nil {
+		return
+	}
+	for _, pod := range podList.Items {
+		for _, owner := range pod.OwnerReferences {
+			if owner.UID == daemonSet.GetUID() {
+				pods = append(pods, pod)
+				break
+			}
+		}
+	}
+	return
+}
+
+func hasReadyPod(pods []core_v1.Pod) bool {
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == core_v1.PodReady && condition.Status == core_v1.ConditionTrue {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func deployResources(logger *zap.Logger, manifestPath string, serverSide bool, identities *namespaceIdentities) (err error) {
 	if manifestPath == "" {
 		err = errors.New("missing manifest path")
 		return
@@ -295,9 +776,83 @@ func deployResources(logger *zap.Logger, manifestPath string) (err error) {
 	logger.Info("Deploying resources...")
 	logger.Info("Resource path: " + manifestPath)
 	// Follow the given path. Deploy the yaml files in there
-	_, err = utils.Kubectl(targetNamespace, "apply", manifestPath)
-	if err == nil {
+	if !serverSide {
+		files, err := listManifestFiles(manifestPath)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if isRedactedBackup(file) {
+				logger.Warn("Skipping " + file + ". Its secret data was redacted, it has to be restored manually")
+				continue
+			}
+			identityFlags, err := identities.kubectlFlags(file)
+			if err != nil {
+				return err
+			}
+			cmd, err := utils.Kubectl(targetNamespace, "apply"+identityFlags, file)
+			if err != nil {
+				logger.Error(cmd)
+				return err
+			}
+		}
 		logger.Info("Resources were deployed")
+		return nil
+	}
+	// Rooster owns the applied fields. Unchanged fields are left untouched, avoiding pod churn for no-op changes
+	changedFiles, err := changedManifestFiles(logger, manifestPath, identities)
+	if err != nil {
+		return
+	}
+	if len(changedFiles) == 0 {
+		logger.Info("Resources are unchanged. Nothing to deploy")
+		return
+	}
+	for _, file := range changedFiles {
+		identityFlags, err := identities.kubectlFlags(file)
+		if err != nil {
+			return err
+		}
+		cmd, err := utils.Kubectl(targetNamespace, "apply"+serverSideApplyOptions()+identityFlags, file)
+		if err != nil {
+			logRequestFailure(logger, "The apply of "+file, cmd)
+			return err
+		}
+	}
+	logger.Info("Resources were deployed")
+	return
+}
+
+func serverSideApplyOptions() string {
+	return " --server-side --force-conflicts --field-manager=" + config.Env.FieldManager
+}
+
+func changedManifestFiles(logger *zap.Logger, manifestPath string, identities *namespaceIdentities) (changedFiles []string, err error) {
+	files, err := listManifestFiles(manifestPath)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		identityFlags, err := identities.kubectlFlags(file)
+		if err != nil {
+			return nil, err
+		}
+		// kubectl diff exits with 1 when differences are found
+		cmd, err := utils.Kubectl(targetNamespace, "diff"+serverSideApplyOptions()+identityFlags, file)
+		if err == nil {
+			logger.Info("Skipping unchanged file: " + file)
+			continue
+		}
+		var exitError *exec.ExitError
+		if !errors.As(err, &exitError) || exitError.ExitCode() != 1 {
+			// Do not skip what could not be compared. The comparison runs the admission webhooks: report the denials
+			if webhook, reason, denied := DiagnoseAdmissionDenial(cmd); denied {
+				logger.Warn("The admission webhook " + webhook + " denies " + file + ": " + reason)
+			} else {
+				logger.Warn("Could not compare " + file + " with the live resources: " + cmd)
+			}
+		}
+		changedFiles = append(changedFiles, file)
 	}
 	return
 }
@@ -308,7 +863,7 @@ func determineNamespace(manifestIndicatedNamespace string, optionIndicatedNamesp
 	} else {
 		finalNamespace = manifestIndicatedNamespace
 	}
-	if manifestIndicatedNamespace != optionIndicatedNamespace && optionIndicatedNamespace != "" {
+	if manifestIndicatedNamespace != optionIndicatedNamespace && manifestIndicatedNamespace != "" && optionIndicatedNamespace != "" {
 		err = errors.New("!!! Namespace conflict detected !!!" + manifestIndicatedNamespace + " vs " + optionIndicatedNamespace)
 	}
 
@@ -326,6 +881,7 @@ func (c Clients) patchTargetNodes(logger *zap.Logger, targetNodes []core_v1.Node
 	// Case 1: More nodes than specified by the canary batch size have the canary label already. This may be a resource update situation
 	// E.g: batch size=3. nodes with the canary label in the cluster at this point: 4 or more
 	if len(nodesToRevert) > int(batchSize) {
+		var unlabeledNodes []core_v1.Node
 		// iterate in reverse to start with the last nodes
 		for i := len(nodesToRevert) - 1; i >= 0; i-- {
 			// Remove the canary label from the nodes part of the 2nd batch
@@ -339,41 +895,64 @@ func (c Clients) patchTargetNodes(logger *zap.Logger, targetNodes []core_v1.Node
 				logger.Error(err.Error())
 				return false
 			}
+			unlabeledNodes = append(unlabeledNodes, nodesToRevert[i])
+		}
+		if err := c.waitForLabelRemoval(logger, unlabeledNodes, canaryLabelKey); err != nil {
+			logger.Error(err.Error())
+			return false
 		}
-		waitForResources(10 * time.Second)
 		return true
 	}
 	// Case 2: Either no node has the canary label yet, less nodes specified by the canary batch size do
 	// E.g: batch size=3. nodes with the canary label in the cluster at this point: 1, or 0
-	customPatchOptions := meta_v1.PatchOptions{}
-	if dryRun {
-		customPatchOptions.DryRun = append(customPatchOptions.DryRun, "All")
-	}
-	p := types.JSONPatchType
-	payload := []patchStringValue{{
-		Op:    "replace",
-		Path:  "/metadata/labels/" + canaryLabelKey,
-		Value: canaryLabelValue,
-	}}
-	data, err := json.Marshal(payload)
-	if err != nil {
-		logger.Error(err.Error())
-		logger.Info("Operation was aborted")
-		return true
-	}
-	for _, targetNode := range targetNodes {
+	for i, targetNode := range targetNodes {
+		// Spread the patches over time, so large batches do not get throttled
+		if i > 0 && config.Env.PatchInterval > 0 {
+			time.Sleep(config.Env.PatchInterval)
+		}
 		// Label the nodes (canary 1st batch) with the canaryLabel
 		logger.Info("Node to patch: " + targetNode.Name)
-		_, err := c.K8sClient.GetClient().CoreV1().Nodes().Patch(ctx, targetNode.Name, p, data, customPatchOptions)
+		// Back off when API Priority & Fairness rejects the request
+		err := retry.OnError(retry.DefaultBackoff, k8s_errors.IsTooManyRequests, func() error {
+			return c.ApplyCanaryLabel(ctx, targetNode.Name, canaryLabelKey, canaryLabelValue, dryRun)
+		})
 		if err != nil {
-			logger.Error(err.Error())
+			logRequestFailure(logger, "The patch of node "+targetNode.Name, err.Error())
 			return false
 		}
 	}
+	if dryRun {
+		logger.Info("Patching complete")
+		return true
+	}
+	// An accepted patch can still be undone, by a mutating webhook or a controller
+	if err := c.waitForNodeLabels(logger, targetNodes, canaryLabelKey, canaryLabelValue); err != nil {
+		logger.Error(err.Error())
+		return false
+	}
 	logger.Info("Patching complete")
 	return true
 }
 
+// waitForNodeLabels makes sure the nodes carry the label, then leaves the scheduler time to react
+func (c Clients) waitForNodeLabels(logger *zap.Logger, nodes []core_v1.Node, key string, value string) error {
+	for _, node := range nodes {
+		err := wait.PollImmediate(time.Second, config.Env.LabelCheckTimeout, func() (bool, error) {
+			liveNode, err := c.K8sClient.GetClient().CoreV1().Nodes().Get(context.TODO(), node.Name, meta_v1.GetOptions{})
+			if err != nil {
+				logger.Warn(err.Error())
+				return false, nil
+			}
+			return liveNode.Labels[key] == value, nil
+		})
+		if err != nil {
+			return errors.New("node " + node.Name + " does not carry the label " + key + "=" + value + " after " + config.Env.LabelCheckTimeout.String() + ". Was the patch reverted by a webhook or a controller?")
+		}
+	}
+	waitForResources(config.Env.LabelSettleTime)
+	return nil
+}
+
 func waitForResources(duration time.Duration) {
 	time.Sleep(duration)
 }
@@ -408,41 +987,26 @@ func (c Clients) getTargetNodes(logger *zap.Logger, targetLabel string, customOp
 	return
 }
 
-func defineRestOfNodes(nodeList core_v1.NodeList, NumberOfCanaryNodes int) (otherNodes []core_v1.Node) {
-	otherNodes = nodeList.Items[NumberOfCanaryNodes:]
-	return
-}
-
-func defineCanaryBatchSize(logger *zap.Logger, nodeList core_v1.NodeList, canary int) (canaryTargetNodes []core_v1.Node, batchSize float64) {
-	// Deduce the batch size
-	logger.Info("Defining batch size...")
-	batchSize = math.Round(float64(len(nodeList.Items)*canary) / 100)
-	logger.Info("Batch size: " + strconv.Itoa(int(batchSize)) + "/" + strconv.Itoa(len(nodeList.Items)))
-	canaryTargetNodes = nodeList.Items[:int(batchSize)]
-	return
-}
-
-func (c Clients) deletePreviousSettings(logger *zap.Logger, targetResources map[string]string, dryRun bool, backup bool) (backupDir string, err error) {
-	if backup {
-		logger.Info("Backing up resources")
-		completed, backupDirectory := backupResources(logger, targetResources)
-		backupDir = backupDirectory
-		if !completed {
-			logger.Info("Backup failed. Aborting...")
-			return
-		}
+func moveCanaryPoolFirst(nodes []core_v1.Node, canaryPoolLabel string) error {
+	if canaryPoolLabel == "" {
+		return nil
 	}
-	// 0 for the verb GET
-	resourcesExist, _ := c.queryResources(logger, 0, targetResources, dryRun)
-	if !resourcesExist {
-		logger.Info("Resources were not found. Deletion complete")
-		return
+	selector, err := labels.Parse(canaryPoolLabel)
+	if err != nil {
+		return err
 	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return selector.Matches(labels.Set(nodes[i].Labels)) && !selector.Matches(labels.Set(nodes[j].Labels))
+	})
+	return nil
+}
+
+func (c Clients) deletePreviousSettings(logger *zap.Logger, targetResources map[string]string, options queryOptions) (err error) {
 	// Delete them
 	// 3 for the verb DELETE
-	resourcesAreDeleted, _ := c.queryResources(logger, 3, targetResources, dryRun)
+	resourcesAreDeleted, _ := c.queryResources(logger, 3, targetResources, options)
 	if !resourcesAreDeleted {
-		err = errors.New("Issues were encountered while deleting resources. Unchanged resources were backed up at " + backupDir)
+		err = errors.New("issues were encountered while deleting resources")
 		return
 	}
 	logger.Info("Resources deletion is now complete.")
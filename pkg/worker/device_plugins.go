@@ -0,0 +1,100 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"rooster/pkg/config"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Directory the device plugins register with the kubelet through
+const devicePluginsDirectory = "/var/lib/kubelet/device-plugins"
+
+// hasDevicePlugin tells whether the manifests hold a device plugin, i.e. a DaemonSet mounting the device plugin directory of the kubelet
+func hasDevicePlugin(manifestPath string) (bool, error) {
+	files, err := listManifestFiles(manifestPath)
+	if err != nil {
+		return false, err
+	}
+	for _, file := range files {
+		daemonSets, err := readDaemonSets(file)
+		if err != nil {
+			return false, err
+		}
+		for _, daemonSet := range daemonSets {
+			for _, volume := range daemonSet.Spec.Template.Spec.Volumes {
+				if volume.HostPath != nil && strings.HasPrefix(volume.HostPath.Path, devicePluginsDirectory) {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+// isExtendedResource tells whether the resource is advertised by a device plugin, e.g. nvidia.com/gpu
+func isExtendedResource(name core_v1.ResourceName) bool {
+	return strings.Contains(string(name), "/") && !strings.HasPrefix(string(name), "kubernetes.io/")
+}
+
+// verifyDeviceResources waits for the nodes to advertise as many extended resources as they did before they were patched.
+// The nodes are the ones listed before the patch: their allocatable resources are the reference
+func (c Clients) verifyDeviceResources(logger *zap.Logger, nodes []core_v1.Node) error {
+	for _, node := range nodes {
+		expected := make(map[core_v1.ResourceName]int64)
+		for name, quantity := range node.Status.Allocatable {
+			if isExtendedResource(name) && quantity.Value() > 0 {
+				expected[name] = quantity.Value()
+			}
+		}
+		if len(expected) == 0 {
+			continue
+		}
+		missing := []string{}
+		err := wait.PollImmediate(5*time.Second, config.Env.DeviceResourceTimeout, func() (bool, error) {
+			liveNode, err := c.K8sClient.GetClient().CoreV1().Nodes().Get(context.TODO(), node.Name, meta_v1.GetOptions{})
+			if err != nil {
+				logger.Warn(err.Error())
+				return false, nil
+			}
+			missing = missing[:0]
+			for name, count := range expected {
+				if advertised := liveNode.Status.Allocatable[name]; advertised.Value() < count {
+					missing = append(missing, string(name)+": "+advertised.String()+"/"+strconv.FormatInt(count, 10))
+				}
+			}
+			return len(missing) == 0, nil
+		})
+		if err != nil {
+			sort.Strings(missing)
+			return errors.New("node " + node.Name + " does not advertise its devices again after " + config.Env.DeviceResourceTimeout.String() + ": " + strings.Join(missing, ", ") + ". Check the device plugin")
+		}
+		logger.Info("Node " + node.Name + " advertises its devices again")
+	}
+	return nil
+}
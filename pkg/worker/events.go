@@ -0,0 +1,125 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+// Rollout state transitions
+const (
+	rolloutStartedEvent    = "rollout_started"
+	rolloutPlannedEvent    = "rollout_planned"
+	batchPatchedEvent      = "batch_patched"
+	resourcesDeployedEvent = "resources_deployed"
+	testsFinishedEvent     = "tests_finished"
+	batchVerifiedEvent     = "batch_verified"
+	canaryHeldEvent        = "canary_held"
+	canaryCompletedEvent   = "canary_completed"
+	nodesRecoveredEvent    = "nodes_recovered"
+	promotionStartedEvent  = "promotion_started"
+	promotionPendingEvent  = "promotion_pending"
+	rolloutCompletedEvent  = "rollout_completed"
+	rolloutFailedEvent     = "rollout_failed"
+	revertStartedEvent     = "revert_started"
+	revertCompletedEvent   = "revert_completed"
+	revertFailedEvent      = "revert_failed"
+)
+
+// rolloutEvent is a line of the events file
+type rolloutEvent struct {
+	Time         string `json:"time"`
+	Type         string `json:"type"`
+	Initiator    string `json:"initiator"`
+	ManifestPath string `json:"manifestPath"`
+	// Canary label of the rollout: the version
+	CanaryLabel string `json:"canaryLabel,omitempty"`
+	// Position of the batch, the canary batch being 0
+	Batch *int     `json:"batch,omitempty"`
+	Nodes []string `json:"nodes,omitempty"`
+	// Share of the target nodes patched so far, in percentage
+	Coverage *int   `json:"coverage,omitempty"`
+	Passed   *bool  `json:"passed,omitempty"`
+	DryRun   bool   `json:"dryRun,omitempty"`
+	Message  string `json:"message,omitempty"`
+	// Reason code of a failed rollout
+	Reason string `json:"reason,omitempty"`
+}
+
+// eventRecorder appends the rollout events to a NDJSON file. Without a file, nothing is recorded
+type eventRecorder struct {
+	logger       *zap.Logger
+	file         *os.File
+	initiator    string
+	manifestPath string
+	canaryLabel  string
+}
+
+func newEventRecorder(logger *zap.Logger, eventsFile string, initiator string, manifestPath string, canaryLabel string) (*eventRecorder, error) {
+	recorder := &eventRecorder{logger: logger, initiator: initiator, manifestPath: manifestPath, canaryLabel: canaryLabel}
+	if eventsFile == "" {
+		return recorder, nil
+	}
+	// The revert of a failed rollout is appended to the events of the rollout
+	f, err := os.OpenFile(eventsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	recorder.file = f
+	return recorder, nil
+}
+
+func (r *eventRecorder) record(event rolloutEvent) {
+	if r.file == nil {
+		return
+	}
+	event.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	event.Initiator = r.initiator
+	event.ManifestPath = r.manifestPath
+	event.CanaryLabel = r.canaryLabel
+	line, err := json.Marshal(event)
+	if err != nil {
+		r.logger.Warn("Could not record the " + event.Type + " event: " + err.Error())
+		return
+	}
+	if _, err = r.file.Write(append(line, '\n')); err != nil {
+		r.logger.Warn("Could not record the " + event.Type + " event: " + err.Error())
+	}
+}
+
+func (r *eventRecorder) recordBatch(eventType string, batch int, nodes []core_v1.Node, coverage int) {
+	r.record(rolloutEvent{Type: eventType, Batch: &batch, Nodes: nodeNames(nodes), Coverage: &coverage})
+}
+
+func nodeNames(nodes []core_v1.Node) []string {
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, node.Name)
+	}
+	return names
+}
+
+func (r *eventRecorder) close() {
+	if r.file != nil {
+		r.file.Close()
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+// printExecutionPlan describes what a dry-run rollout would do: the batches, the files to apply, and the namespaces to create
+func (c Clients) printExecutionPlan(logger *zap.Logger, batches [][]core_v1.Node, targetResources map[string]string, manifestPath string, identities *namespaceIdentities, createNamespace bool, initiator string) error {
+	totalNodes := 0
+	for _, batch := range batches {
+		totalNodes += len(batch)
+	}
+	fmt.Println("Execution plan")
+	fmt.Println("Nodes: " + strconv.Itoa(totalNodes))
+	printBatches(batches, totalNodes)
+	risks, err := c.scoreNodes(nodesOf(batches))
+	if err != nil {
+		return err
+	}
+	fmt.Println("Risk scores:")
+	printBatchRisks(batches, risks)
+	// The workloads that may be disrupted, batch after batch
+	fmt.Println("Affected tenants:")
+	for i, batch := range batches {
+		tenants, err := c.listTenants(batch)
+		if err != nil {
+			return err
+		}
+		c.resolveTenantContacts(logger, tenants)
+		fmt.Println("  Batch " + strconv.Itoa(i) + ": " + strconv.Itoa(len(tenants)) + " namespaces")
+		printTenants(tenants)
+	}
+
+	changedFiles, err := changedManifestFiles(logger, manifestPath, identities)
+	if err != nil {
+		return err
+	}
+	files, err := listManifestFiles(manifestPath)
+	if err != nil {
+		return err
+	}
+	changed := make(map[string]bool)
+	for _, file := range changedFiles {
+		changed[file] = true
+	}
+	fmt.Println("Manifest files:")
+	for _, file := range files {
+		action := "unchanged, skipped"
+		if changed[file] {
+			action = "applied (server-side)"
+		}
+		fmt.Println("  - " + filepath.Base(file) + ": " + action)
+	}
+
+	resources := make([]string, 0, len(targetResources))
+	for kindName := range targetResources {
+		resources = append(resources, kindName)
+	}
+	sort.Strings(resources)
+	fmt.Println("Resources: " + strconv.Itoa(len(resources)))
+	for _, kindName := range resources {
+		resource := getAttribute(kindName, 0) + "/" + getAttribute(kindName, 1)
+		if namespace := targetResources[kindName]; namespace != "" {
+			resource += " (namespace: " + namespace + ")"
+		}
+		fmt.Println("  - " + resource)
+	}
+	fmt.Println("Annotations recorded on the resources: " + initiatorAnnotation + "=" + initiator + ", " + deployedAtAnnotation)
+
+	missingNamespaces, err := c.missingNamespaces(targetResources)
+	if err != nil {
+		return err
+	}
+	if len(missingNamespaces) == 0 {
+		return nil
+	}
+	title := "Missing namespaces, to create with --create-namespace"
+	if createNamespace {
+		title = "Namespaces to create"
+	}
+	fmt.Println(title + ": " + strconv.Itoa(len(missingNamespaces)))
+	for _, namespace := range missingNamespaces {
+		fmt.Println("  - " + namespace)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"rooster/pkg/config"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+// Time the external strategy is given to decide the next increment
+const externalStrategyTimeout = time.Minute
+
+// strategyNode is a target node, as described to the external strategy
+type strategyNode struct {
+	Name    string            `json:"name"`
+	Labels  map[string]string `json:"labels"`
+	Patched bool              `json:"patched"`
+}
+
+// strategyState is sent to the external strategy before each increment
+type strategyState struct {
+	// Position of the increment to decide, the canary batch being 0
+	Batch       int            `json:"batch"`
+	Project     string         `json:"project,omitempty"`
+	TargetLabel string         `json:"targetLabel"`
+	CanaryLabel string         `json:"canaryLabel"`
+	Nodes       []strategyNode `json:"nodes"`
+}
+
+// strategyDecision is the answer of the external strategy: the nodes of the next increment, and whether it is the last one
+type strategyDecision struct {
+	Nodes []string `json:"nodes"`
+	Done  bool     `json:"done"`
+}
+
+// isExternalStrategyUrl tells whether the external strategy is a webhook, rather than a command
+func isExternalStrategyUrl(externalStrategy string) bool {
+	return strings.HasPrefix(externalStrategy, "http://") || strings.HasPrefix(externalStrategy, "https://")
+}
+
+// nextIncrement returns the increment at the position, the first one after the canary batch being 1.
+// Planned increments are used unless an external strategy is set, in which case it decides. done: no increment is left
+func nextIncrement(logger *zap.Logger, options config.RoosterOptions, planned [][]core_v1.Node, position int, targetNodes []core_v1.Node, patchedNodes []core_v1.Node) (batch []core_v1.Node, last bool, done bool, err error) {
+	if options.ExternalStrategy == "" {
+		if position > len(planned) {
+			return nil, false, true, nil
+		}
+		return planned[position-1], position == len(planned), false, nil
+	}
+	patched := make(map[string]bool, len(patchedNodes))
+	for _, node := range patchedNodes {
+		patched[node.Name] = true
+	}
+	if len(patched) >= len(targetNodes) {
+		return nil, false, true, nil
+	}
+	state := strategyState{Batch: position, Project: options.Project, TargetLabel: options.TargetLabel, CanaryLabel: options.CanaryLabel}
+	for _, node := range targetNodes {
+		state.Nodes = append(state.Nodes, strategyNode{Name: node.Name, Labels: node.Labels, Patched: patched[node.Name]})
+	}
+	decision, err := askExternalStrategy(options.ExternalStrategy, state)
+	if err != nil {
+		return nil, false, false, errors.New("the external strategy failed: " + err.Error())
+	}
+	if len(decision.Nodes) == 0 {
+		if decision.Done {
+			return nil, false, true, nil
+		}
+		return nil, false, false, errors.New("the external strategy returned no node, and is not done")
+	}
+	byName := make(map[string]core_v1.Node, len(targetNodes))
+	for _, node := range targetNodes {
+		byName[node.Name] = node
+	}
+	for _, name := range decision.Nodes {
+		node, found := byName[name]
+		if !found || patched[name] {
+			return nil, false, false, errors.New("the external strategy picked node " + name + ", which is not a target node left to patch")
+		}
+		batch = append(batch, node)
+		patched[name] = true
+	}
+	logger.Info("The external strategy picked " + strconv.Itoa(len(batch)) + " nodes for batch " + strconv.Itoa(position))
+	return batch, decision.Done, false, nil
+}
+
+// askExternalStrategy sends the state to the command, on its standard input, or to the webhook, and reads the decision it answers with
+func askExternalStrategy(externalStrategy string, state strategyState) (decision strategyDecision, err error) {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), externalStrategyTimeout)
+	defer cancel()
+	var answer []byte
+	if isExternalStrategyUrl(externalStrategy) {
+		answer, err = postStrategyWebhook(ctx, externalStrategy, payload)
+	} else {
+		cmd := exec.CommandContext(ctx, "sh", "-c", externalStrategy)
+		cmd.Stdin = bytes.NewReader(payload)
+		cmd.Stderr = os.Stderr
+		answer, err = cmd.Output()
+	}
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(answer, &decision); err != nil {
+		err = errors.New("invalid decision: " + err.Error() + `. Expected: {"nodes": ["<node>", ...], "done": false}`)
+	}
+	return
+}
+
+func postStrategyWebhook(ctx context.Context, url string, payload []byte) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if config.Env.StrategyWebhookToken != "" {
+		request.Header.Set("Authorization", "Bearer "+config.Env.StrategyWebhookToken)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		return nil, errors.New("the webhook answered " + response.Status)
+	}
+	return io.ReadAll(response.Body)
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"text/template"
+	"time"
+
+	"rooster/pkg/config"
+
+	"go.uber.org/zap"
+)
+
+// Payload of a GitHub issue. Jira, or any other tracker, can be fed through a custom template
+const defaultFailureTemplate = `{"title": {{json .Title}}, "body": {{json .Details}}}`
+
+// FailureReport describes a failed rollout. It is the data of the webhook template
+type FailureReport struct {
+	Title        string
+	Details      string
+	Initiator    string
+	Project      string
+	ManifestPath string
+	TargetLabel  string
+	CanaryLabel  string
+	Namespace    string
+	// Reason code of the failure, e.g. ReadinessTimeout or TestFailure
+	Reason string
+	// The deployment was reverted, and whether the revert succeeded
+	Reverted        bool
+	RevertSucceeded bool
+	// Backups of the resources, and files created by Rooster
+	BackupDirectory string
+	FailedAt        string
+	// Phase of each node of the rollout, as a table
+	NodeStatus string
+	// Log of the last test run, and its last lines
+	TestLog     string
+	TestLogTail string
+}
+
+// ReportFailure sends the failure report to the webhook, so the incident gets a ticket. Nothing is sent when no webhook is set
+func ReportFailure(logger *zap.Logger, options config.RoosterOptions, reverted bool, revertSucceeded bool) {
+	if config.Env.FailureWebhookUrl == "" {
+		return
+	}
+	report := FailureReport{
+		Initiator:       determineInitiator(),
+		Project:         options.Project,
+		ManifestPath:    options.ManifestPath,
+		TargetLabel:     options.TargetLabel,
+		CanaryLabel:     options.CanaryLabel,
+		Namespace:       options.Namespace,
+		Reason:          lastFailureReason,
+		Reverted:        reverted,
+		RevertSucceeded: revertSucceeded,
+		BackupDirectory: config.Env.BackupDirectory,
+		FailedAt:        time.Now().UTC().Format(time.RFC3339),
+	}
+	report.Title = "Rooster rollout failed: " + options.ManifestPath
+	if report.Reason == pauseExpiredReason {
+		report.Title = "Rooster rollout paused for longer than allowed: " + options.ManifestPath
+	}
+	report.Details = "Reason: " + report.Reason +
+		"\nInitiator: " + report.Initiator +
+		"\nProject: " + report.Project +
+		"\nManifest path: " + report.ManifestPath +
+		"\nTarget label: " + report.TargetLabel +
+		"\nCanary label: " + report.CanaryLabel +
+		"\nReverted: " + strconv.FormatBool(reverted) + ", revert succeeded: " + strconv.FormatBool(revertSucceeded) +
+		"\nBackup directory: " + report.BackupDirectory +
+		"\nFailed at: " + report.FailedAt
+	report.NodeStatus = lastNodeStatus
+	if report.NodeStatus != "" {
+		report.Details += "\n\n" + report.NodeStatus
+	}
+	report.TestLog, report.TestLogTail = lastTestLogTail()
+	if report.TestLog != "" {
+		report.Details += "\nTest log: " + report.TestLog + "\n\n" + report.TestLogTail
+	}
+	payload, err := renderFailureReport(config.Env.FailureWebhookTemplate, report)
+	if err != nil {
+		logger.Error("Could not render the failure report: " + err.Error())
+		return
+	}
+	if err = postWebhook(config.Env.FailureWebhookUrl, config.Env.FailureWebhookToken, payload); err != nil {
+		logger.Error("Could not send the failure report: " + err.Error())
+		return
+	}
+	logger.Info("Failure report sent")
+}
+
+func renderFailureReport(templateFile string, report FailureReport) ([]byte, error) {
+	text := defaultFailureTemplate
+	if templateFile != "" {
+		content, err := os.ReadFile(templateFile)
+		if err != nil {
+			return nil, err
+		}
+		text = string(content)
+	}
+	functions := template.FuncMap{
+		// Quotes & escapes a value, to be embedded in a JSON payload
+		"json": func(value interface{}) (string, error) {
+			encoded, err := json.Marshal(value)
+			return string(encoded), err
+		},
+	}
+	tmpl, err := template.New("failure").Funcs(functions).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	payload := new(bytes.Buffer)
+	if err = tmpl.Execute(payload, report); err != nil {
+		return nil, err
+	}
+	return payload.Bytes(), nil
+}
+
+// postWebhook posts a JSON payload, authenticated by the bearer token when set
+func postWebhook(url string, token string, payload []byte) error {
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		return errors.New("the webhook answered " + response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// GitHub Actions workflow commands, printed on the standard output
+	githubFindingsFormat = "github"
+	// SARIF 2.1.0 log, written to the findings file
+	sarifFindingsFormat = "sarif"
+	defaultSarifFile    = "rooster.sarif"
+)
+
+// finding is an issue detected while validating the rollout
+type finding struct {
+	// error or warning
+	level   string
+	file    string
+	line    int
+	message string
+}
+
+type findingsReport struct {
+	format   string
+	file     string
+	findings []finding
+}
+
+func newFindingsReport(format string, file string) (*findingsReport, error) {
+	switch format {
+	case "", githubFindingsFormat:
+	case sarifFindingsFormat:
+		if file == "" {
+			file = defaultSarifFile
+		}
+	default:
+		return nil, errors.New("unknown findings format: " + format + ". Expected " + githubFindingsFormat + " or " + sarifFindingsFormat)
+	}
+	return &findingsReport{format: format, file: file}, nil
+}
+
+func (r *findingsReport) addError(err error) {
+	f := finding{level: "error", message: err.Error()}
+	manifestError := &ManifestError{}
+	if errors.As(err, &manifestError) {
+		f.file = manifestError.File
+		f.line = manifestError.Line
+		f.message = manifestError.Err.Error()
+	}
+	r.findings = append(r.findings, f)
+}
+
+func (r *findingsReport) addWarning(message string) {
+	r.findings = append(r.findings, finding{level: "warning", message: message})
+}
+
+func (r *findingsReport) addFileWarning(file string, message string) {
+	r.findings = append(r.findings, finding{level: "warning", file: file, message: message})
+}
+
+// addResults reports the warnings & the failures of the preflight validators
+func (r *findingsReport) addResults(results []PreflightResult) {
+	for _, result := range results {
+		for _, message := range result.Messages {
+			level := "warning"
+			if message.Status == PreflightFail {
+				level = "error"
+			}
+			r.findings = append(r.findings, finding{level: level, file: message.File, line: message.Line, message: message.Text})
+		}
+	}
+}
+
+func (r *findingsReport) write() error {
+	switch r.format {
+	case githubFindingsFormat:
+		for _, f := range r.findings {
+			fmt.Println(f.githubCommand())
+		}
+	case sarifFindingsFormat:
+		return r.writeSarif()
+	}
+	return nil
+}
+
+func (f finding) githubCommand() string {
+	properties := []string{}
+	if f.file != "" {
+		properties = append(properties, "file="+f.file)
+	}
+	if f.line > 0 {
+		properties = append(properties, "line="+strconv.Itoa(f.line))
+	}
+	// Workflow command messages are single line
+	message := strings.ReplaceAll(f.message, "\n", "%0A")
+	return "::" + f.level + " " + strings.Join(properties, ",") + "::" + message
+}
+
+func (r *findingsReport) writeSarif() error {
+	results := []map[string]interface{}{}
+	for _, f := range r.findings {
+		result := map[string]interface{}{
+			"ruleId":  "rooster/preflight",
+			"level":   f.level,
+			"message": map[string]string{"text": f.message},
+		}
+		if f.file != "" {
+			location := map[string]interface{}{"artifactLocation": map[string]string{"uri": f.file}}
+			if f.line > 0 {
+				location["region"] = map[string]int{"startLine": f.line}
+			}
+			result["locations"] = []map[string]interface{}{{"physicalLocation": location}}
+		}
+		results = append(results, result)
+	}
+	log := map[string]interface{}{
+		"version": "2.1.0",
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"runs": []map[string]interface{}{{
+			"tool":    map[string]interface{}{"driver": map[string]string{"name": "rooster"}},
+			"results": results,
+		}},
+	}
+	content, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.file, content, 0644)
+}
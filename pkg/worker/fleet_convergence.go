@@ -0,0 +1,97 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"errors"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// FleetUpdate is a rollout bringing a project of a cluster to its desired version
+type FleetUpdate struct {
+	Cluster FleetCluster
+	Project string
+	// Canary label of the desired version: the canary label key of the project, and the version
+	CanaryLabel  string
+	ManifestPath string
+	// Nodes run the desired version already: the rollout is promoted, rather than started
+	Promote bool
+}
+
+// PlanConvergence lists the rollouts bringing the projects of the clusters to the versions of their environment.
+// Only the projects with a source in the environment of the cluster can be rolled out. clusterName: only this cluster, when set
+func PlanConvergence(logger *zap.Logger, fleet Fleet, clusterName string) (updates []FleetUpdate) {
+	for _, cluster := range fleet.Clusters {
+		if clusterName != "" && cluster.Name != clusterName {
+			continue
+		}
+		kubernetesClient, err := UseFleetCluster(cluster)
+		if err != nil {
+			logger.Warn("Skipping cluster " + cluster.Name + ": " + err.Error())
+			continue
+		}
+		entries, err := clusterComplianceEntries(kubernetesClient, cluster.Name, fleet.DesiredVersions(cluster))
+		if err != nil {
+			logger.Warn("Skipping cluster " + cluster.Name + ": " + err.Error())
+			continue
+		}
+		for _, entry := range entries {
+			if entry.Status != laggingStatus && entry.Status != rollingStatus {
+				continue
+			}
+			defaults, err := GetProjectDefaults(kubernetesClient, entry.Project)
+			if err != nil {
+				logger.Warn("Skipping project " + entry.Project + " of cluster " + cluster.Name + ": " + err.Error())
+				continue
+			}
+			canaryLabelKey, _, _ := strings.Cut(defaults["canary-label"], "=")
+			update, err := PlanFleetUpdate(fleet, cluster, entry, canaryLabelKey)
+			if err != nil {
+				logger.Warn(err.Error() + ". Skipping")
+				continue
+			}
+			if update != nil {
+				updates = append(updates, *update)
+			}
+		}
+	}
+	return
+}
+
+// PlanFleetUpdate returns the rollout bringing the project of the cluster to the version of its environment, nil when
+// the project runs it already. A rollout in progress is promoted. No cluster is needed
+func PlanFleetUpdate(fleet Fleet, cluster FleetCluster, entry FleetReportEntry, canaryLabelKey string) (*FleetUpdate, error) {
+	if entry.Status != laggingStatus && entry.Status != rollingStatus {
+		return nil, nil
+	}
+	release, found := fleet.Projects[entry.Project][cluster.Environment]
+	if !found || release.Source == "" {
+		return nil, errors.New("project " + entry.Project + " lags behind in cluster " + cluster.Name + ", but has no source in environment " + cluster.Environment)
+	}
+	if canaryLabelKey == "" {
+		return nil, errors.New("project " + entry.Project + " has no canary label in cluster " + cluster.Name)
+	}
+	return &FleetUpdate{
+		Cluster:      cluster,
+		Project:      entry.Project,
+		CanaryLabel:  canaryLabelKey + "=" + release.Version,
+		ManifestPath: release.Source,
+		Promote:      entry.Status == rollingStatus,
+	}, nil
+}
@@ -0,0 +1,273 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"rooster/pkg/config"
+	"rooster/pkg/utils"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const fleetReportKind = "FleetReport"
+
+// Compliance of a project in a cluster
+const (
+	compliantStatus   = "compliant"
+	rollingStatus     = "rolling"
+	laggingStatus     = "lagging"
+	missingStatus     = "missing"
+	undeclaredStatus  = "undeclared"
+	unknownStatus     = "unknown"
+	unreachableStatus = "unreachable"
+)
+
+// Fleet lists the clusters a report covers, and the version each project should run
+type Fleet struct {
+	Clusters []FleetCluster `yaml:"clusters"`
+	// Desired version of each project, i.e. the value of its canary label, in every cluster
+	Desired map[string]string `yaml:"desired"`
+	// Desired version of each project, and the manifests it is rolled out from, per environment. Takes precedence over Desired
+	Projects map[string]map[string]FleetRelease `yaml:"projects"`
+}
+
+type FleetCluster struct {
+	Name        string `yaml:"name"`
+	Environment string `yaml:"environment"`
+	Kubeconfig  string `yaml:"kubeconfig"`
+	Context     string `yaml:"context"`
+}
+
+// FleetRelease is a version of a project, and the manifests it is rolled out from
+type FleetRelease struct {
+	Version string `yaml:"version"`
+	Source  string `yaml:"source"`
+}
+
+// DesiredVersions returns the version each project should run in the cluster
+func (f Fleet) DesiredVersions(cluster FleetCluster) map[string]string {
+	desired := map[string]string{}
+	for project, version := range f.Desired {
+		desired[project] = version
+	}
+	for project, environments := range f.Projects {
+		if release, found := environments[cluster.Environment]; found {
+			desired[project] = release.Version
+		}
+	}
+	return desired
+}
+
+// UseFleetCluster makes the clients & the kubectl commands target the cluster. Both are given the kubeconfig explicitly,
+// so that a cluster without kubeconfig never runs kubectl against the one of the previous cluster
+func UseFleetCluster(cluster FleetCluster) (*utils.K8sClient, error) {
+	kubeconfig := cluster.Kubeconfig
+	if kubeconfig == "" {
+		kubeconfig = utils.DefaultKubeconfig()
+	}
+	utils.SetKubeconfig(kubeconfig)
+	utils.SetKubeContext(cluster.Context)
+	return utils.New(kubeconfig)
+}
+
+// LoadFleet reads the fleet file. All the clusters are checked: the problems are reported together
+func LoadFleet(file string) (fleet Fleet, err error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return
+	}
+	if err = yaml.Unmarshal(content, &fleet); err != nil {
+		return
+	}
+	if len(fleet.Clusters) == 0 {
+		return fleet, errors.New("no cluster is listed in " + file)
+	}
+	var problems []string
+	names := map[string]bool{}
+	for i, cluster := range fleet.Clusters {
+		switch {
+		case cluster.Name == "":
+			problems = append(problems, "cluster #"+strconv.Itoa(i+1)+" has no name")
+		case names[cluster.Name]:
+			problems = append(problems, "cluster "+cluster.Name+" is listed twice")
+		}
+		names[cluster.Name] = true
+	}
+	if len(problems) > 0 {
+		err = errors.New("invalid fleet " + file + ":\n" + strings.Join(problems, "\n"))
+	}
+	return
+}
+
+// FleetReport is the matrix of the versions the projects run, cluster by cluster
+type FleetReport struct {
+	APIVersion  string             `json:"apiVersion" yaml:"apiVersion"`
+	Kind        string             `json:"kind" yaml:"kind"`
+	GeneratedAt string             `json:"generatedAt" yaml:"generatedAt"`
+	Entries     []FleetReportEntry `json:"entries" yaml:"entries"`
+}
+
+type FleetReportEntry struct {
+	Project string `json:"project" yaml:"project"`
+	Cluster string `json:"cluster" yaml:"cluster"`
+	// Target nodes running each version. Nodes without the canary label key run the version Rooster took over from
+	Versions map[string]int `json:"versions,omitempty" yaml:"versions,omitempty"`
+	// Last time a node of the project was patched, as told by the rollout annotations
+	LastRollout string `json:"lastRollout,omitempty" yaml:"lastRollout,omitempty"`
+	Desired     string `json:"desired,omitempty" yaml:"desired,omitempty"`
+	Status      string `json:"status" yaml:"status"`
+	Error       string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Lagging lists the entries running behind the desired version
+func (r FleetReport) Lagging() (entries []FleetReportEntry) {
+	for _, entry := range r.Entries {
+		if entry.Status == laggingStatus || entry.Status == rollingStatus || entry.Status == missingStatus {
+			entries = append(entries, entry)
+		}
+	}
+	return
+}
+
+// FleetComplianceReport reads the projects of every cluster of the fleet, and compares the versions they run with the desired ones
+func FleetComplianceReport(logger *zap.Logger, fleet Fleet) FleetReport {
+	report := FleetReport{APIVersion: inventoryAPIVersion, Kind: fleetReportKind, GeneratedAt: time.Now().UTC().Format(time.RFC3339)}
+	for _, cluster := range fleet.Clusters {
+		logger.Info("Reading the projects of cluster " + cluster.Name)
+		kubernetesClient, err := UseFleetCluster(cluster)
+		if err == nil {
+			var entries []FleetReportEntry
+			entries, err = clusterComplianceEntries(kubernetesClient, cluster.Name, fleet.DesiredVersions(cluster))
+			report.Entries = append(report.Entries, entries...)
+		}
+		if err != nil {
+			logger.Warn("Could not read the projects of cluster " + cluster.Name + ": " + err.Error())
+			report.Entries = append(report.Entries, FleetReportEntry{Cluster: cluster.Name, Status: unreachableStatus, Error: err.Error()})
+		}
+	}
+	sort.SliceStable(report.Entries, func(i, j int) bool {
+		return report.Entries[i].Project < report.Entries[j].Project
+	})
+	return report
+}
+
+func clusterComplianceEntries(kubernetesClient *utils.K8sClient, cluster string, desired map[string]string) (entries []FleetReportEntry, err error) {
+	ctx := context.TODO()
+	configMaps, err := kubernetesClient.GetClient().CoreV1().ConfigMaps(config.Env.ProjectNamespace).List(ctx, meta_v1.ListOptions{})
+	if err != nil {
+		return
+	}
+	found := map[string]bool{}
+	for _, configMap := range configMaps.Items {
+		if !strings.HasPrefix(configMap.Name, projectConfigMapPrefix) {
+			continue
+		}
+		project := strings.TrimPrefix(configMap.Name, projectConfigMapPrefix)
+		found[project] = true
+		entry := FleetReportEntry{Project: project, Cluster: cluster, Desired: desired[project], Status: unknownStatus}
+		canaryLabelKey, _, _ := strings.Cut(configMap.Data["canary-label"], "=")
+		if canaryLabelKey == "" {
+			entry.Error = "the project has no canary label"
+			entries = append(entries, entry)
+			continue
+		}
+		nodes, listErr := kubernetesClient.GetClient().CoreV1().Nodes().List(ctx, meta_v1.ListOptions{LabelSelector: configMap.Data["target-label"]})
+		if listErr != nil {
+			entry.Error = listErr.Error()
+			entries = append(entries, entry)
+			continue
+		}
+		entries = append(entries, ProjectComplianceEntry(project, cluster, nodes.Items, canaryLabelKey, entry.Desired))
+	}
+	// Projects expected in every cluster
+	for project, version := range desired {
+		if !found[project] {
+			entries = append(entries, FleetReportEntry{Project: project, Cluster: cluster, Desired: version, Status: missingStatus})
+		}
+	}
+	return
+}
+
+// ProjectComplianceEntry compares the versions the target nodes of the project run with the desired one. No cluster is needed
+func ProjectComplianceEntry(project string, cluster string, nodes []core_v1.Node, canaryLabelKey string, desired string) FleetReportEntry {
+	entry := FleetReportEntry{Project: project, Cluster: cluster, Desired: desired}
+	entry.Versions = nodeVersions(nodes, canaryLabelKey)
+	for _, node := range nodes {
+		if transition := node.Annotations[rolloutLastTransitionAnnotation]; node.Annotations[rolloutProjectAnnotation] == project && transition > entry.LastRollout {
+			entry.LastRollout = transition
+		}
+	}
+	entry.Status = complianceStatus(entry.Versions, entry.Desired)
+	return entry
+}
+
+func complianceStatus(versions map[string]int, desired string) string {
+	if desired == "" {
+		return undeclaredStatus
+	}
+	switch {
+	case versions[desired] == 0:
+		return laggingStatus
+	case len(versions) > 1:
+		return rollingStatus
+	}
+	return compliantStatus
+}
+
+// Marshal encodes the report as a table, in YAML or in JSON
+func (r FleetReport) Marshal(format string) ([]byte, error) {
+	switch format {
+	case "", "table":
+		buffer := &bytes.Buffer{}
+		writer := tabwriter.NewWriter(buffer, 0, 4, 2, ' ', 0)
+		writer.Write([]byte("PROJECT\tCLUSTER\tVERSIONS\tLAST ROLLOUT\tDESIRED\tSTATUS\n"))
+		for _, entry := range r.Entries {
+			versions := []string{}
+			for version, count := range entry.Versions {
+				versions = append(versions, version+": "+strconv.Itoa(count))
+			}
+			sort.Strings(versions)
+			status := entry.Status
+			if entry.Status == laggingStatus || entry.Status == rollingStatus || entry.Status == missingStatus {
+				// Stand out from the compliant rows
+				status = strings.ToUpper(status)
+			}
+			writer.Write([]byte(entry.Project + "\t" + entry.Cluster + "\t" + strings.Join(versions, ", ") + "\t" + entry.LastRollout + "\t" + entry.Desired + "\t" + status + "\n"))
+		}
+		err := writer.Flush()
+		return buffer.Bytes(), err
+	case "yaml":
+		return yaml.Marshal(r)
+	case "json":
+		return json.MarshalIndent(r, "", "  ")
+	}
+	return nil, errors.New("unknown output format: " + format + ". Expected table, yaml or json")
+}
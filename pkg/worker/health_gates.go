@@ -0,0 +1,114 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"rooster/pkg/config"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Placeholder of the health gates, replaced with the name of each node of the batch
+const healthGateNodePlaceholder = "{node}"
+
+// Timeout of a single health request
+const healthRequestTimeout = 5 * time.Second
+
+// checkHealthGatesSyntax makes sure the gates are API server paths or HTTP(S) URLs, before anything is patched
+func checkHealthGatesSyntax(gates []string) error {
+	for _, gate := range gates {
+		if strings.HasPrefix(gate, "/") {
+			continue
+		}
+		endpoint, err := url.Parse(strings.ReplaceAll(gate, healthGateNodePlaceholder, "node"))
+		if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			return errors.New("invalid health gate " + gate + ". Expected: an API server path, e.g. /api/v1/nodes/{node}:10250/proxy/healthz, or an HTTP(S) URL")
+		}
+	}
+	return nil
+}
+
+// healthGateEndpoints expands the gates over the nodes of the batch. Gates without the node placeholder are checked once
+func healthGateEndpoints(gates []string, nodes []core_v1.Node) (endpoints []string) {
+	for _, gate := range gates {
+		if !strings.Contains(gate, healthGateNodePlaceholder) {
+			endpoints = append(endpoints, gate)
+			continue
+		}
+		for _, node := range nodes {
+			endpoints = append(endpoints, strings.ReplaceAll(gate, healthGateNodePlaceholder, node.Name))
+		}
+	}
+	return
+}
+
+// checkHealthGates polls the endpoints until they all answer with a 2xx status, or the timeout expires
+func (c Clients) checkHealthGates(logger *zap.Logger, gates []string, nodes []core_v1.Node) error {
+	failures := []string{}
+	for _, endpoint := range healthGateEndpoints(gates, nodes) {
+		var lastErr error
+		err := wait.PollImmediate(config.Env.HealthGateInterval, config.Env.HealthGateTimeout, func() (bool, error) {
+			lastErr = c.checkHealthEndpoint(endpoint)
+			return lastErr == nil, nil
+		})
+		if err != nil {
+			if lastErr != nil {
+				err = lastErr
+			}
+			failures = append(failures, endpoint+": "+err.Error())
+			continue
+		}
+		logger.Info("Health gate passed: " + endpoint)
+	}
+	if len(failures) > 0 {
+		return errors.New("the health gates failed after " + config.Env.HealthGateTimeout.String() + ": " + strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// checkHealthEndpoint requests the endpoint once. API server paths are requested with the credentials of Rooster
+func (c Clients) checkHealthEndpoint(endpoint string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), healthRequestTimeout)
+	defer cancel()
+	if strings.HasPrefix(endpoint, "/") {
+		_, err := c.K8sClient.GetClient().CoreV1().RESTClient().Get().AbsPath(endpoint).DoRaw(ctx)
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return errors.New("unhealthy: HTTP " + strconv.Itoa(response.StatusCode))
+	}
+	return nil
+}
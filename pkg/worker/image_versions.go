@@ -0,0 +1,115 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"errors"
+	"strings"
+
+	"rooster/pkg/config"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Sources of the version, i.e. the value of the canary label
+const (
+	versionFromImage = "image"
+	// Length of the digest kept in the version: a label value is limited to 63 characters
+	digestVersionLength = 12
+)
+
+// ApplyVersionFrom sets the value of the canary label to the version derived as --version-from tells. No cluster is needed.
+// image: the tag, or the digest, of the first container of the primary workload, i.e. the first DaemonSet of the rendered manifests
+func ApplyVersionFrom(logger *zap.Logger, options *config.RoosterOptions) error {
+	if options.VersionFrom == "" {
+		return nil
+	}
+	if options.VersionFrom != versionFromImage {
+		return errors.New("unknown --version-from source: " + options.VersionFrom + ". Expected " + versionFromImage)
+	}
+	key, value, _ := strings.Cut(options.CanaryLabel, "=")
+	if key == "" {
+		return errors.New("--version-from requires the key of the canary label: --canary-label <key>")
+	}
+	manifestPath, cleanup, err := renderManifests(logger, *options)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+	workload, image, err := primaryWorkloadImage(manifestPath)
+	if err != nil {
+		return err
+	}
+	version, err := ImageVersion(image)
+	if err != nil {
+		return errors.New("no version can be derived from DaemonSet " + workload + ": " + err.Error())
+	}
+	if value != "" && value != version {
+		logger.Warn("The canary label " + options.CanaryLabel + " does not match the image of DaemonSet " + workload + ". Using version " + version)
+	}
+	options.CanaryLabel = key + "=" + version
+	logger.Info("Version " + version + " derived from the image " + image + " of DaemonSet " + workload)
+	return nil
+}
+
+// primaryWorkloadImage returns the first DaemonSet of the manifests, in file order, and the image of its first container
+func primaryWorkloadImage(manifestPath string) (workload string, image string, err error) {
+	files, err := listManifestFiles(manifestPath)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		daemonSets, err := readDaemonSets(file)
+		if err != nil {
+			return "", "", err
+		}
+		for _, daemonSet := range daemonSets {
+			containers := daemonSet.Spec.Template.Spec.Containers
+			if len(containers) == 0 {
+				return "", "", errors.New(file + ": DaemonSet " + daemonSet.Name + " has no container")
+			}
+			return daemonSet.Name, containers[0].Image, nil
+		}
+	}
+	return "", "", errors.New("no DaemonSet is found in " + manifestPath + " to derive the version from")
+}
+
+// ImageVersion returns the version an image pins: its tag, or else the first characters of its digest, e.g. sha256-0123456789ab.
+// latest, and images pinning no version, are rejected. No cluster is needed
+func ImageVersion(image string) (string, error) {
+	reference, digest, _ := strings.Cut(image, "@")
+	version := ""
+	// The colon of a registry port is followed by a path, not by a tag
+	if separator := strings.LastIndex(reference, ":"); separator >= 0 && !strings.Contains(reference[separator+1:], "/") {
+		version = reference[separator+1:]
+	}
+	if version == "" && digest != "" {
+		algorithm, hash, found := strings.Cut(digest, ":")
+		if !found || algorithm == "" || len(hash) < digestVersionLength {
+			return "", errors.New("invalid digest of image " + image)
+		}
+		version = algorithm + "-" + hash[:digestVersionLength]
+	}
+	if version == "" || version == "latest" {
+		return "", errors.New("image " + image + " pins no version. Tag it, or refer to it by digest")
+	}
+	if problems := validation.IsValidLabelValue(version); len(problems) > 0 {
+		return "", errors.New("version " + version + " of image " + image + " is not a valid label value: " + strings.Join(problems, ", "))
+	}
+	return version, nil
+}
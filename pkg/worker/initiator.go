@@ -0,0 +1,67 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"os"
+	"os/user"
+	"time"
+
+	"rooster/pkg/config"
+	"rooster/pkg/utils"
+
+	"go.uber.org/zap"
+)
+
+const (
+	initiatorAnnotation  = "rooster/initiator"
+	deployedAtAnnotation = "rooster/deployed-at"
+)
+
+// determineInitiator tells who started the rollout: an explicit identity, a CI job, or the OS user
+func determineInitiator() string {
+	if config.Env.Initiator != "" {
+		return config.Env.Initiator
+	}
+	// GitHub Actions
+	if runID := os.Getenv("GITHUB_RUN_ID"); runID != "" {
+		return os.Getenv("GITHUB_SERVER_URL") + "/" + os.Getenv("GITHUB_REPOSITORY") + "/actions/runs/" + runID
+	}
+	// GitLab CI, Jenkins
+	for _, jobURL := range []string{"CI_JOB_URL", "BUILD_URL"} {
+		if url := os.Getenv(jobURL); url != "" {
+			return url
+		}
+	}
+	if currentUser, err := user.Current(); err == nil {
+		return currentUser.Username
+	}
+	return "unknown"
+}
+
+// recordInitiator annotates the deployed resources, so they tell who rolled them out, and when
+func recordInitiator(logger *zap.Logger, targetResources map[string]string, initiator string) {
+	deployedAt := time.Now().UTC().Format(time.RFC3339)
+	for kindName, namespace := range targetResources {
+		kind := getAttribute(kindName, 0)
+		name := getAttribute(kindName, 1)
+		cmd, err := utils.Kubectl(namespace, "annotate --overwrite", kind, name, "'"+initiatorAnnotation+"="+initiator+"'", deployedAtAnnotation+"="+deployedAt)
+		if err != nil {
+			logger.Warn("Could not record the initiator on " + kind + " " + name + ": " + cmd)
+		}
+	}
+}
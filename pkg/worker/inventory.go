@@ -0,0 +1,222 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"rooster/pkg/config"
+	"rooster/pkg/utils"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	inventoryAPIVersion = "rooster/v1"
+	inventoryKind       = "Inventory"
+)
+
+// Inventory is everything Rooster knows about a project. It is exported as a single document
+type Inventory struct {
+	APIVersion string `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string `json:"kind" yaml:"kind"`
+	ExportedAt string `json:"exportedAt" yaml:"exportedAt"`
+	Project    string `json:"project,omitempty" yaml:"project,omitempty"`
+	// Option values stored in the project ConfigMap
+	ProjectDefaults map[string]string `json:"projectDefaults,omitempty" yaml:"projectDefaults,omitempty"`
+	// Effective configuration
+	Config    []InventorySetting  `json:"config" yaml:"config"`
+	Resources []InventoryResource `json:"resources" yaml:"resources"`
+	Nodes     InventoryNodes      `json:"nodes" yaml:"nodes"`
+	Backups   InventoryBackups    `json:"backups" yaml:"backups"`
+}
+
+type InventorySetting struct {
+	Name   string `json:"name" yaml:"name"`
+	Value  string `json:"value" yaml:"value"`
+	Source string `json:"source" yaml:"source"`
+}
+
+// InventoryResource is a resource of the manifests. Live is left empty when the resource is not deployed
+type InventoryResource struct {
+	Kind      string                 `json:"kind" yaml:"kind"`
+	Name      string                 `json:"name" yaml:"name"`
+	Namespace string                 `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Live      map[string]interface{} `json:"live,omitempty" yaml:"live,omitempty"`
+}
+
+type InventoryNodes struct {
+	TargetLabel string   `json:"targetLabel" yaml:"targetLabel"`
+	CanaryLabel string   `json:"canaryLabel" yaml:"canaryLabel"`
+	Target      []string `json:"target" yaml:"target"`
+	// Target nodes running the manifests, i.e carrying the canary label
+	Canary []string `json:"canary" yaml:"canary"`
+}
+
+type InventoryBackups struct {
+	Directory string            `json:"directory" yaml:"directory"`
+	Files     []InventoryBackup `json:"files" yaml:"files"`
+	// Namespaces created by the last deployment. Deleted when it is reverted
+	CreatedNamespaces []string `json:"createdNamespaces,omitempty" yaml:"createdNamespaces,omitempty"`
+}
+
+type InventoryBackup struct {
+	File      string `json:"file" yaml:"file"`
+	Kind      string `json:"kind" yaml:"kind"`
+	Name      string `json:"name" yaml:"name"`
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Redacted  bool   `json:"redacted,omitempty" yaml:"redacted,omitempty"`
+}
+
+// ExportInventory gathers the inventory of the project. Secret data is left out
+func ExportInventory(kubernetesClient *utils.K8sClient, logger *zap.Logger, options config.RoosterOptions, settings []config.Setting) (inventory Inventory, err error) {
+	clients := Clients{}
+	clients.K8sClient = *kubernetesClient
+	inventory = Inventory{
+		APIVersion: inventoryAPIVersion,
+		Kind:       inventoryKind,
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		Project:    options.Project,
+	}
+	if options.Project != "" {
+		inventory.ProjectDefaults, err = GetProjectDefaults(kubernetesClient, options.Project)
+		if err != nil {
+			return
+		}
+	}
+	for _, setting := range settings {
+		inventory.Config = append(inventory.Config, InventorySetting{Name: setting.Name, Value: setting.Value, Source: string(setting.Source)})
+	}
+	if options.ManifestPath == "" {
+		err = errors.New("missing manifest path")
+		return
+	}
+	targetResources, err := ReadManifestFiles(logger, options.ManifestPath, options.Namespace)
+	if err != nil {
+		return
+	}
+	inventory.Resources = clients.inventoryResources(logger, targetResources)
+	inventory.Nodes, err = clients.inventoryNodes(options.TargetLabel, options.CanaryLabel)
+	if err != nil {
+		return
+	}
+	inventory.Backups, err = inventoryBackups(config.Env.BackupDirectory)
+	return
+}
+
+// Marshal encodes the inventory in YAML or JSON
+func (i Inventory) Marshal(format string) ([]byte, error) {
+	switch format {
+	case "", "yaml":
+		return yaml.Marshal(i)
+	case "json":
+		return json.MarshalIndent(i, "", "  ")
+	}
+	return nil, errors.New("unknown output format: " + format + ". Expected yaml or json")
+}
+
+func (c Clients) inventoryResources(logger *zap.Logger, targetResources map[string]string) (resources []InventoryResource) {
+	for kindName, namespace := range targetResources {
+		resource := InventoryResource{Kind: getAttribute(kindName, 0), Name: getAttribute(kindName, 1), Namespace: namespace}
+		live, err := c.getResource(resource.Kind, resource.Name, namespace)
+		if err != nil {
+			logger.Warn("Could not get " + resource.Kind + " " + resource.Name + ": " + err.Error())
+		}
+		if live != nil {
+			resource.Live = live.Object
+			if resource.Kind == "Secret" {
+				delete(resource.Live, "data")
+				delete(resource.Live, "stringData")
+			}
+			if metadata, ok := resource.Live["metadata"].(map[string]interface{}); ok {
+				delete(metadata, "managedFields")
+				// The last applied configuration may hold a copy of the secret data
+				if annotations, ok := metadata["annotations"].(map[string]interface{}); ok && resource.Kind == "Secret" {
+					delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+				}
+			}
+		}
+		resources = append(resources, resource)
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].Kind+"/"+resources[i].Name < resources[j].Kind+"/"+resources[j].Name
+	})
+	return
+}
+
+func (c Clients) inventoryNodes(targetLabel string, canaryLabel string) (nodes InventoryNodes, err error) {
+	nodes = InventoryNodes{TargetLabel: targetLabel, CanaryLabel: canaryLabel, Target: []string{}, Canary: []string{}}
+	if targetLabel == "" {
+		return
+	}
+	nodeList, err := c.K8sClient.GetClient().CoreV1().Nodes().List(context.TODO(), meta_v1.ListOptions{LabelSelector: targetLabel})
+	if err != nil {
+		return
+	}
+	canaryKey, canaryValue, _ := strings.Cut(canaryLabel, "=")
+	for _, node := range nodeList.Items {
+		nodes.Target = append(nodes.Target, node.Name)
+		if value, found := node.Labels[canaryKey]; canaryLabel != "" && found && value == canaryValue {
+			nodes.Canary = append(nodes.Canary, node.Name)
+		}
+	}
+	sort.Strings(nodes.Target)
+	sort.Strings(nodes.Canary)
+	return
+}
+
+func inventoryBackups(backupDirectory string) (backups InventoryBackups, err error) {
+	backups = InventoryBackups{Directory: backupDirectory, Files: []InventoryBackup{}}
+	if !checkDirectoryExistence(backupDirectory) {
+		return
+	}
+	files, err := listManifestFiles(backupDirectory)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return backups, err
+		}
+		resource := basicK8sConfiguration{}
+		if err = yaml.Unmarshal(content, &resource); err != nil {
+			return backups, err
+		}
+		backups.Files = append(backups.Files, InventoryBackup{
+			File:      filepath.Base(file),
+			Kind:      resource.Kind,
+			Name:      resource.Metadata.Name,
+			Namespace: resource.Metadata.Namespace,
+			Redacted:  resource.Metadata.Annotations[redactedAnnotation] == "true",
+		})
+	}
+	content, err := os.ReadFile(filepath.Join(backupDirectory, createdNamespacesFile))
+	if err == nil {
+		backups.CreatedNamespaces = strings.Fields(string(content))
+	}
+	return backups, nil
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"rooster/pkg/config"
+	"rooster/pkg/utils"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ReadInventory reads an inventory exported in YAML or JSON
+func ReadInventory(file string) (inventory Inventory, err error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return
+	}
+	// JSON documents are YAML documents too
+	if err = yaml.Unmarshal(content, &inventory); err != nil {
+		return
+	}
+	if inventory.APIVersion != inventoryAPIVersion || inventory.Kind != inventoryKind {
+		err = errors.New(file + " is not a Rooster inventory. Expected apiVersion " + inventoryAPIVersion + " and kind " + inventoryKind)
+	}
+	return
+}
+
+// ImportInventory rebuilds what Rooster knows about a project on a new cluster: the project ConfigMap, the index of the backups,
+// and optionally the canary label of the nodes
+func ImportInventory(kubernetesClient *utils.K8sClient, logger *zap.Logger, inventory Inventory, labelNodes bool, dryRun bool) bool {
+	clients := Clients{}
+	clients.K8sClient = *kubernetesClient
+	if err := clients.importProjectDefaults(logger, inventory, dryRun); err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	if err := importBackupIndex(logger, inventory.Backups, dryRun); err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	if !labelNodes {
+		return true
+	}
+	if err := clients.importCanaryLabels(logger, inventory.Nodes, dryRun); err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	return true
+}
+
+func (c Clients) importProjectDefaults(logger *zap.Logger, inventory Inventory, dryRun bool) error {
+	if inventory.Project == "" || len(inventory.ProjectDefaults) == 0 {
+		return nil
+	}
+	cm := config.Env.ProjectNamespace + "/" + projectConfigMapPrefix + inventory.Project
+	err := InitializeProject(&c.K8sClient, inventory.Project, inventory.ProjectDefaults, dryRun)
+	if k8s_errors.IsAlreadyExists(err) {
+		logger.Warn("ConfigMap " + cm + " already exists. It was left untouched")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	logger.Info("Created ConfigMap " + cm)
+	return nil
+}
+
+// importBackupIndex records the namespaces created by the last deployment, and reports the backups missing from the backup directory
+func importBackupIndex(logger *zap.Logger, backups InventoryBackups, dryRun bool) error {
+	backupDirectory := config.Env.BackupDirectory
+	for _, backup := range backups.Files {
+		if !checkDirectoryExistence(filepath.Join(backupDirectory, backup.File)) {
+			logger.Warn("Backup " + backup.File + " (" + backup.Kind + " " + backup.Name + ") is missing from " + backupDirectory + ". Copy it over from " + backups.Directory)
+		}
+	}
+	if len(backups.CreatedNamespaces) == 0 || dryRun {
+		return nil
+	}
+	logger.Info("Recording the created namespaces: " + strings.Join(backups.CreatedNamespaces, ", "))
+	return recordCreatedNamespaces(backupDirectory, backups.CreatedNamespaces)
+}
+
+// importCanaryLabels puts the canary label back on the nodes that carried it. Nodes that no longer exist are reported
+func (c Clients) importCanaryLabels(logger *zap.Logger, nodes InventoryNodes, dryRun bool) error {
+	if nodes.CanaryLabel == "" || len(nodes.Canary) == 0 {
+		return nil
+	}
+	canaryLabelKey, canaryLabelValue, found := strings.Cut(nodes.CanaryLabel, "=")
+	if !found {
+		return errors.New("invalid canary label " + nodes.CanaryLabel + ". Expected key=value")
+	}
+	// add sets the label whether the node carries it or not. "/" is escaped in JSON pointers
+	payload := []patchStringValue{{
+		Op:    "add",
+		Path:  "/metadata/labels/" + strings.ReplaceAll(strings.ReplaceAll(canaryLabelKey, "~", "~0"), "/", "~1"),
+		Value: canaryLabelValue,
+	}}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	customPatchOptions := meta_v1.PatchOptions{}
+	if dryRun {
+		customPatchOptions.DryRun = append(customPatchOptions.DryRun, "All")
+	}
+	for _, nodeName := range nodes.Canary {
+		_, err = c.K8sClient.GetClient().CoreV1().Nodes().Patch(context.TODO(), nodeName, types.JSONPatchType, data, customPatchOptions)
+		if k8s_errors.IsNotFound(err) {
+			logger.Warn("Node " + nodeName + " no longer exists. Its canary label was not restored")
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		logger.Info("Labeled node " + nodeName + " with " + nodes.CanaryLabel)
+	}
+	return nil
+}
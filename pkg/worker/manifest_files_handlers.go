@@ -20,6 +20,9 @@ import (
 	"errors"
 	"io"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"rooster/pkg/config"
 	"rooster/pkg/utils"
@@ -28,75 +31,161 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-func readmanifestFiles(logger *zap.Logger, manifestPath string, indicatedNamespace string) (objectReference map[string]string) {
+const (
+	// Set on the backups whose secret data was stripped. They cannot be re-applied
+	redactedAnnotation = "rooster/redacted"
+)
+
+// ManifestError locates the manifest document that could not be read
+type ManifestError struct {
+	File string
+	// Position of the document in the file, starting at 1
+	Document int
+	// Line the document starts at. 0 when unknown
+	Line int
+	Err  error
+}
+
+func (e *ManifestError) Error() string {
+	return e.File + ": document " + strconv.Itoa(e.Document) + ": " + e.Err.Error()
+}
+
+func (e *ManifestError) Unwrap() error {
+	return e.Err
+}
+
+// ReadManifestFiles lists the resources defined in the manifest files of the indicated directory
+func ReadManifestFiles(logger *zap.Logger, manifestPath string, indicatedNamespace string) (objectReference map[string]string, err error) {
 	// map of kind,name: namespace ---- Service,kube-dns-upstream:kube-system
 	objectReference = make(map[string]string)
 	// navigate to the indicated file
-	files, err := os.ReadDir(manifestPath)
+	files, err := listManifestFiles(manifestPath)
 	if err != nil {
-		logger.Error(err.Error())
+		return
 	}
+	// kind,name: file defining the resource
+	definitions := make(map[string]string)
 	for _, file := range files {
+		logger.Info("Reading file: " + file)
+		if err = readManifestFile(file, indicatedNamespace, objectReference, definitions); err != nil {
+			return
+		}
+	}
+	return objectReference, nil
+}
+
+func readManifestFile(file string, indicatedNamespace string, objectReference map[string]string, definitions map[string]string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	d := yaml.NewDecoder(f)
+	// Documents are separated by "---". Fields Rooster does not need are ignored
+	for document := 1; ; document++ {
+		node := yaml.Node{}
+		err := d.Decode(&node)
+		// break the loop in case of EOF
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return &ManifestError{File: file, Document: document, Err: err}
+		}
+		line := node.Line
+		if len(node.Content) > 0 {
+			line = node.Content[0].Line
+		}
 		data := basicK8sConfiguration{}
-		logger.Info("Reading file: " + file.Name())
-		f, err := os.Open(manifestPath + file.Name())
+		if err = node.Decode(&data); err != nil {
+			return &ManifestError{File: file, Document: document, Line: line, Err: err}
+		}
+		// Empty documents, comments only for instance
+		if data.Kind == "" && data.Metadata.Name == "" {
+			continue
+		}
+		if data.Kind == "" || data.Metadata.Name == "" {
+			return &ManifestError{File: file, Document: document, Line: line, Err: errors.New("kind and metadata.name are required")}
+		}
+		ns, err := determineNamespace(data.Metadata.Namespace, indicatedNamespace)
 		if err != nil {
-			logger.Error(err.Error())
+			return &ManifestError{File: file, Document: document, Line: line, Err: err}
 		}
-		d := yaml.NewDecoder(f)
-		for {
-			// pass a config reference to data
-			err := d.Decode(&data)
-			if data.Metadata.Name == "" {
-				continue
-			}
-			// break the loop in case of EOF
-			if errors.Is(err, io.EOF) {
-				break
-			}
-			if err != nil {
-				logger.Panic(err.Error())
-			}
-			kind := data.Kind
-			name := data.Metadata.Name
-			namespace := data.Metadata.Namespace
-			ns, err := determineNamespace(namespace, indicatedNamespace)
-			if err != nil {
-				logger.Panic(err.Error())
+		// The same resource defined twice makes the backup and rollback ambiguous
+		key := data.Kind + "," + data.Metadata.Name
+		if definedIn, found := definitions[key]; found {
+			err = errors.New(data.Kind + " " + data.Metadata.Name + " is defined in both " + definedIn + " and " + file)
+			return &ManifestError{File: file, Document: document, Line: line, Err: err}
+		}
+		definitions[key] = file
+		objectReference[key] = ns
+	}
+}
+
+func listManifestFiles(manifestPath string) (manifestFiles []string, err error) {
+	files, err := os.ReadDir(manifestPath)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		// Same extensions as the ones kubectl apply picks up
+		switch filepath.Ext(file.Name()) {
+		case ".yaml", ".yml", ".json":
+			if !file.IsDir() {
+				manifestFiles = append(manifestFiles, filepath.Join(manifestPath, file.Name()))
 			}
-			objectReference[kind+","+name] = ns
 		}
 	}
-	return objectReference
+	return
 }
 
-func backupResources(logger *zap.Logger, targetResources map[string]string) (OpComplete bool, backupDir string) {
+func backupResources(logger *zap.Logger, targetResources map[string]string, redactSecrets bool) (OpComplete bool, backupDir string) {
 	backupDir = config.Env.BackupDirectory
 	if backupDir == "" {
 		return
 	}
-	if err := os.Mkdir(backupDir, os.ModePerm); err != nil {
+	OpComplete = backupResourcesTo(logger, backupDir, targetResources, redactSecrets, false)
+	return
+}
+
+// backupResourcesTo writes the live resources to the directory. With ignoreNotFound, the resources that are not deployed are skipped
+func backupResourcesTo(logger *zap.Logger, backupDir string, targetResources map[string]string, redactSecrets bool, ignoreNotFound bool) bool {
+	if err := os.MkdirAll(backupDir, os.ModePerm); err != nil {
 		if !errors.Is(err, os.ErrExist) {
 			logger.Error(err.Error())
-			return
+			return false
 		}
 		logger.Warn(err.Error())
 	}
 	logger.Info("Created backup directory at " + backupDir)
+	getCommand := "get"
+	if ignoreNotFound {
+		getCommand += " --ignore-not-found"
+	}
 	for kindName, namespace := range targetResources {
 		kind := getAttribute(kindName, 0)
 		name := getAttribute(kindName, 1)
-		fileName := backupDir + "/" + kind + "_" + name + ".yaml"
+		fileName := backupFileName(backupDir, kind, name)
 
-		cmd, err := utils.Kubectl(namespace, "get", kind, name, "-oyaml>"+fileName)
+		cmd, err := utils.Kubectl(namespace, getCommand, kind, name, "-oyaml>'"+fileName+"'")
 		if err != nil {
 			logger.Error(cmd)
-			return
+			return false
+		}
+		if info, err := os.Stat(fileName); err == nil && info.Size() == 0 {
+			// Not deployed
+			os.Remove(fileName)
+			continue
+		}
+		if kind == "Secret" && redactSecrets {
+			if err = redactSecretBackup(fileName); err != nil {
+				logger.Error(err.Error())
+				return false
+			}
 		}
 	}
-	OpComplete = true
 	logger.Info("Resource backup complete.")
-	return
+	return true
 }
 
 func checkDirectoryExistence(path string) (exists bool) {
@@ -105,3 +194,90 @@ func checkDirectoryExistence(path string) (exists bool) {
 	}
 	return
 }
+
+func backupFileName(backupDir string, kind string, name string) string {
+	return filepath.Join(backupDir, kind+"_"+name+".yaml")
+}
+
+// resourceOfBackupFile is the reverse of backupFileName. Kinds hold no underscore
+func resourceOfBackupFile(backupFile string) (kind string, name string) {
+	kind, name, _ = strings.Cut(strings.TrimSuffix(filepath.Base(backupFile), filepath.Ext(backupFile)), "_")
+	return
+}
+
+func sanitizeBackupFile(backupFile string) (sanitizedFile string, namespace string, err error) {
+	content, err := os.ReadFile(backupFile)
+	if err != nil {
+		return
+	}
+	resource := make(map[string]interface{})
+	if err = yaml.Unmarshal(content, &resource); err != nil {
+		return
+	}
+	// Drop the fields populated by the API server. They would be rejected, or conflict with the live object
+	delete(resource, "status")
+	if metadata, ok := resource["metadata"].(map[string]interface{}); ok {
+		for _, field := range []string{"creationTimestamp", "generation", "managedFields", "resourceVersion", "selfLink", "uid"} {
+			delete(metadata, field)
+		}
+		namespace, _ = metadata["namespace"].(string)
+	}
+	if namespace == "" {
+		namespace = targetNamespace
+	}
+	content, err = yaml.Marshal(resource)
+	if err != nil {
+		return
+	}
+	f, err := os.CreateTemp("", "rooster_restore_*.yaml")
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_, err = f.Write(content)
+	sanitizedFile = f.Name()
+	return
+}
+
+func redactSecretBackup(backupFile string) error {
+	content, err := os.ReadFile(backupFile)
+	if err != nil {
+		return err
+	}
+	secret := make(map[string]interface{})
+	if err = yaml.Unmarshal(content, &secret); err != nil {
+		return err
+	}
+	delete(secret, "data")
+	delete(secret, "stringData")
+	metadata, _ := secret["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+		secret["metadata"] = metadata
+	}
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	if annotations == nil {
+		annotations = make(map[string]interface{})
+		metadata["annotations"] = annotations
+	}
+	// The last applied configuration holds a copy of the data
+	delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+	annotations[redactedAnnotation] = "true"
+	content, err = yaml.Marshal(secret)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(backupFile, content, 0600)
+}
+
+func isRedactedBackup(backupFile string) bool {
+	content, err := os.ReadFile(backupFile)
+	if err != nil {
+		return false
+	}
+	resource := basicK8sConfiguration{}
+	if err = yaml.Unmarshal(content, &resource); err != nil {
+		return false
+	}
+	return resource.Metadata.Annotations[redactedAnnotation] == "true"
+}
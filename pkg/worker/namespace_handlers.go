@@ -0,0 +1,120 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// Namespaces created by Rooster during the last deployment. Deleted when the deployment is reverted
+	createdNamespacesFile = "created_namespaces.txt"
+)
+
+func (c Clients) createMissingNamespaces(logger *zap.Logger, targetResources map[string]string, namespaceLabels string, namespaceAnnotations string) (createdNamespaces []string, err error) {
+	ctx := context.TODO()
+	nsLabels, err := labels.ConvertSelectorToLabelsMap(namespaceLabels)
+	if err != nil {
+		return
+	}
+	nsAnnotations, err := labels.ConvertSelectorToLabelsMap(namespaceAnnotations)
+	if err != nil {
+		return
+	}
+	missingNamespaces, err := c.missingNamespaces(targetResources)
+	if err != nil {
+		return
+	}
+	for _, namespace := range missingNamespaces {
+		logger.Info("Creating namespace " + namespace)
+		ns := &core_v1.Namespace{}
+		ns.Name = namespace
+		ns.Labels = nsLabels
+		ns.Annotations = nsAnnotations
+		_, err = c.K8sClient.GetClient().CoreV1().Namespaces().Create(ctx, ns, meta_v1.CreateOptions{})
+		if err != nil {
+			return
+		}
+		createdNamespaces = append(createdNamespaces, namespace)
+	}
+	return createdNamespaces, nil
+}
+
+// missingNamespaces lists the namespaces of the resources that do not exist yet
+func (c Clients) missingNamespaces(targetResources map[string]string) (missingNamespaces []string, err error) {
+	for _, namespace := range getNamespaces(targetResources) {
+		_, err = c.K8sClient.GetClient().CoreV1().Namespaces().Get(context.TODO(), namespace, meta_v1.GetOptions{})
+		if err == nil {
+			continue
+		}
+		if !k8s_errors.IsNotFound(err) {
+			return
+		}
+		missingNamespaces = append(missingNamespaces, namespace)
+	}
+	return missingNamespaces, nil
+}
+
+func getNamespaces(targetResources map[string]string) (namespaces []string) {
+	found := make(map[string]bool)
+	for _, namespace := range targetResources {
+		if namespace != "" && !found[namespace] {
+			found[namespace] = true
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	sort.Strings(namespaces)
+	return
+}
+
+func recordCreatedNamespaces(backupDir string, createdNamespaces []string) error {
+	if err := os.MkdirAll(backupDir, os.ModePerm); err != nil {
+		return err
+	}
+	content := strings.Join(createdNamespaces, "\n")
+	return os.WriteFile(filepath.Join(backupDir, createdNamespacesFile), []byte(content), 0644)
+}
+
+func (c Clients) deleteCreatedNamespaces(logger *zap.Logger, backupDir string) error {
+	ctx := context.TODO()
+	content, err := os.ReadFile(filepath.Join(backupDir, createdNamespacesFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, namespace := range strings.Fields(string(content)) {
+		logger.Info("Deleting namespace " + namespace)
+		err = c.K8sClient.GetClient().CoreV1().Namespaces().Delete(ctx, namespace, meta_v1.DeleteOptions{})
+		if err != nil && !k8s_errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return os.Remove(filepath.Join(backupDir, createdNamespacesFile))
+}
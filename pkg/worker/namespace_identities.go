@@ -0,0 +1,104 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	contextIdentity        = "context"
+	serviceAccountIdentity = "serviceaccount"
+)
+
+// namespaceIdentity is the identity the resources of a namespace are applied with: a kubeconfig context, or an impersonated service account
+type namespaceIdentity struct {
+	kind string
+	// context name, or <namespace>/<name> of the service account
+	name string
+}
+
+// namespaceIdentities maps namespaces to the identity their resources are applied with. Other namespaces use the default identity
+type namespaceIdentities struct {
+	identities map[string]namespaceIdentity
+	// Namespace of the resources that do not indicate one
+	indicatedNamespace string
+}
+
+// parseNamespaceIdentities reads namespace=kind:name pairs. E.g: monitoring=serviceaccount:monitoring/deployer,logging=context:ops-admin
+func parseNamespaceIdentities(mapping string, indicatedNamespace string) (*namespaceIdentities, error) {
+	identities := &namespaceIdentities{identities: make(map[string]namespaceIdentity), indicatedNamespace: indicatedNamespace}
+	if mapping == "" {
+		return identities, nil
+	}
+	for _, pair := range strings.Split(mapping, ",") {
+		namespace, identity, found := strings.Cut(strings.TrimSpace(pair), "=")
+		kind, name, valid := strings.Cut(identity, ":")
+		if !found || !valid || namespace == "" || name == "" {
+			return nil, errors.New("invalid namespace identity " + pair + ". Expected namespace=context:<name> or namespace=serviceaccount:<namespace>/<name>")
+		}
+		switch kind {
+		case contextIdentity:
+		case serviceAccountIdentity:
+			if len(strings.Split(name, "/")) != 2 {
+				return nil, errors.New("invalid service account " + name + ". Expected <namespace>/<name>")
+			}
+		default:
+			return nil, errors.New("unknown identity kind " + kind + ". Expected " + contextIdentity + " or " + serviceAccountIdentity)
+		}
+		identities.identities[namespace] = namespaceIdentity{kind: kind, name: name}
+	}
+	return identities, nil
+}
+
+func (i namespaceIdentity) kubectlFlags() string {
+	if i.kind == contextIdentity {
+		return " --context '" + i.name + "'"
+	}
+	return " --as=system:serviceaccount:" + strings.Replace(i.name, "/", ":", 1)
+}
+
+// kubectlFlags returns the flags applying the resources of the file with the identity of their namespace
+func (n *namespaceIdentities) kubectlFlags(file string) (string, error) {
+	if n == nil || len(n.identities) == 0 {
+		return "", nil
+	}
+	resources := make(map[string]string)
+	if err := readManifestFile(file, n.indicatedNamespace, resources, make(map[string]string)); err != nil {
+		return "", err
+	}
+	flags := make(map[string]bool)
+	for _, namespace := range resources {
+		if namespace == "" {
+			namespace = targetNamespace
+		}
+		identity, found := n.identities[namespace]
+		if !found {
+			flags[""] = true
+			continue
+		}
+		flags[identity.kubectlFlags()] = true
+	}
+	if len(flags) > 1 {
+		return "", errors.New(file + " defines resources of namespaces applied with different identities: " + strings.Join(getNamespaces(resources), ", ") + ". Split the file by namespace")
+	}
+	for flag := range flags {
+		return flag, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"rooster/pkg/config"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Label of the probe pods, so that leftovers can be found
+const networkProbeLabel = "rooster/network-probe"
+
+// networkProbeScript resolves the API server service through the cluster DNS, then reaches the probe URL when set
+func networkProbeScript() string {
+	script := "nslookup kubernetes.default"
+	if config.Env.NetworkProbeUrl != "" {
+		script += " && wget -q -T 5 -O /dev/null '" + config.Env.NetworkProbeUrl + "'"
+	}
+	return script
+}
+
+// probeNodeNetworks runs a short-lived pod on each node, checking the pod network & the DNS work there.
+// A ready CNI DaemonSet does not prove the dataplane works
+func (c Clients) probeNodeNetworks(logger *zap.Logger, nodes []core_v1.Node) error {
+	failures := []string{}
+	for _, node := range nodes {
+		if node.Labels[osLabel] == "windows" {
+			logger.Info("Skipping the network probe of Windows node " + node.Name)
+			continue
+		}
+		if err := c.probeNodeNetwork(logger, node.Name); err != nil {
+			failures = append(failures, node.Name+": "+err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		return errors.New("the network probes failed on " + strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+func (c Clients) probeNodeNetwork(logger *zap.Logger, nodeName string) error {
+	ctx := context.TODO()
+	pods := c.K8sClient.GetClient().CoreV1().Pods(config.Env.NetworkProbeNamespace)
+	deadline := int64(config.Env.NetworkProbeTimeout.Seconds())
+	probe := &core_v1.Pod{
+		ObjectMeta: meta_v1.ObjectMeta{
+			GenerateName: "rooster-network-probe-",
+			Labels:       map[string]string{networkProbeLabel: "true"},
+		},
+		Spec: core_v1.PodSpec{
+			// Bypass the scheduler: the probe must run on this node
+			NodeName:              nodeName,
+			RestartPolicy:         core_v1.RestartPolicyNever,
+			ActiveDeadlineSeconds: &deadline,
+			Tolerations:           []core_v1.Toleration{{Operator: core_v1.TolerationOpExists}},
+			Containers: []core_v1.Container{{
+				Name:    "probe",
+				Image:   config.Env.NetworkProbeImage,
+				Command: []string{"sh", "-c", networkProbeScript()},
+			}},
+		},
+	}
+	probe, err := pods.Create(ctx, probe, meta_v1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := pods.Delete(ctx, probe.Name, meta_v1.DeleteOptions{}); err != nil {
+			logger.Warn("Could not delete the network probe " + probe.Name + ": " + err.Error())
+		}
+	}()
+	phase := core_v1.PodPending
+	err = wait.PollImmediate(2*time.Second, config.Env.NetworkProbeTimeout+10*time.Second, func() (bool, error) {
+		livePod, err := pods.Get(ctx, probe.Name, meta_v1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		phase = livePod.Status.Phase
+		return phase == core_v1.PodSucceeded || phase == core_v1.PodFailed, nil
+	})
+	if err != nil {
+		return errors.New("the probe did not complete (phase: " + string(phase) + "): " + err.Error())
+	}
+	if phase == core_v1.PodFailed {
+		logs, _ := pods.GetLogs(probe.Name, &core_v1.PodLogOptions{}).DoRaw(ctx)
+		return errors.New("the probe failed: " + strings.TrimSpace(string(logs)))
+	}
+	logger.Info("The network of node " + nodeName + " works")
+	return nil
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"rooster/pkg/config"
+	"rooster/pkg/utils"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+// Rollout state of the managed nodes, read by the node-local agents
+const (
+	rolloutProjectAnnotation        = "rooster/project"
+	rolloutVersionAnnotation        = "rooster/version"
+	rolloutBatchAnnotation          = "rooster/batch"
+	rolloutLastTransitionAnnotation = "rooster/last-transition"
+)
+
+// setRolloutAnnotations records the rollout on the nodes of a batch, the canary batch being 0
+func setRolloutAnnotations(logger *zap.Logger, nodes []core_v1.Node, options config.RoosterOptions, batch int) {
+	_, version, _ := strings.Cut(options.CanaryLabel, "=")
+	annotations := []string{
+		rolloutVersionAnnotation + "=" + version,
+		rolloutBatchAnnotation + "=" + strconv.Itoa(batch),
+		rolloutLastTransitionAnnotation + "=" + time.Now().UTC().Format(time.RFC3339),
+	}
+	if options.Project != "" {
+		annotations = append(annotations, rolloutProjectAnnotation+"="+options.Project)
+	}
+	for _, node := range nodes {
+		cmd, err := utils.Kubectl("", "annotate --overwrite node "+node.Name+" "+strings.Join(annotations, " "))
+		if err != nil {
+			logger.Warn("Could not annotate node " + node.Name + " with the rollout state: " + cmd)
+		}
+	}
+}
+
+// clearRolloutAnnotations removes the rollout state from the nodes, once their canary label is removed
+func clearRolloutAnnotations(logger *zap.Logger, nodes []core_v1.Node) {
+	keys := []string{rolloutProjectAnnotation, rolloutVersionAnnotation, rolloutBatchAnnotation, rolloutLastTransitionAnnotation}
+	for _, node := range nodes {
+		cmd, err := utils.Kubectl("", "annotate node "+node.Name+" "+strings.Join(keys, "- ")+"-")
+		if err != nil {
+			logger.Warn("Could not clear the rollout state of node " + node.Name + ": " + cmd)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+	core_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+const (
+	// Non-conforming nodes are left out of the batch
+	skipNonConformingNodes = "skip"
+	// Non-conforming nodes abort the rollout
+	failOnNonConformingNodes = "fail"
+)
+
+// nodeConformance lists the prerequisites a node must meet before being patched
+type nodeConformance struct {
+	Policy                   string   `yaml:"policy"`
+	MinKernelVersion         string   `yaml:"minKernelVersion"`
+	MinContainerdVersion     string   `yaml:"minContainerdVersion"`
+	RequiredLabels           []string `yaml:"requiredLabels"`
+	ForbiddenTaints          []string `yaml:"forbiddenTaints"`
+	RejectDiskPressuredNodes bool     `yaml:"rejectDiskPressuredNodes"`
+}
+
+func loadNodeConformance(conformanceFile string) (conformance *nodeConformance, err error) {
+	if conformanceFile == "" {
+		return
+	}
+	content, err := os.ReadFile(conformanceFile)
+	if err != nil {
+		return
+	}
+	conformance = &nodeConformance{}
+	if err = yaml.Unmarshal(content, conformance); err != nil {
+		return
+	}
+	switch conformance.Policy {
+	case "":
+		conformance.Policy = failOnNonConformingNodes
+	case skipNonConformingNodes, failOnNonConformingNodes:
+	default:
+		err = errors.New("invalid node conformance policy: " + conformance.Policy + ". Expected " + skipNonConformingNodes + " or " + failOnNonConformingNodes)
+	}
+	return
+}
+
+func (nc *nodeConformance) filterNodes(logger *zap.Logger, nodes []core_v1.Node) (conformingNodes []core_v1.Node, err error) {
+	if nc == nil {
+		return nodes, nil
+	}
+	for _, node := range nodes {
+		reason := nc.check(node)
+		if reason == "" {
+			conformingNodes = append(conformingNodes, node)
+			continue
+		}
+		if nc.Policy == failOnNonConformingNodes {
+			err = errors.New("node " + node.Name + " does not meet the prerequisites: " + reason)
+			return
+		}
+		logger.Warn("Skipping node " + node.Name + ": " + reason)
+	}
+	return
+}
+
+// filterCanaryBatch filters the canary batch. Unlike the other batches, it must keep a node: with an empty canary batch,
+// the nodes already carrying the canary label would be taken for surplus, and unlabeled
+func (nc *nodeConformance) filterCanaryBatch(logger *zap.Logger, nodes []core_v1.Node) (conformingNodes []core_v1.Node, err error) {
+	conformingNodes, err = nc.filterNodes(logger, nodes)
+	if err == nil && len(nodes) > 0 && len(conformingNodes) == 0 {
+		err = errors.New("none of the " + strconv.Itoa(len(nodes)) + " nodes of the canary batch meets the prerequisites")
+	}
+	return
+}
+
+// FilterConformingNodes returns the nodes meeting the prerequisites of the conformance file, following its policy. No cluster is needed
+func FilterConformingNodes(logger *zap.Logger, conformanceFile string, nodes []core_v1.Node) ([]core_v1.Node, error) {
+	conformance, err := loadNodeConformance(conformanceFile)
+	if err != nil {
+		return nil, err
+	}
+	return conformance.filterNodes(logger, nodes)
+}
+
+// FilterCanaryBatch returns the nodes of the canary batch meeting the prerequisites of the conformance file. No cluster is needed
+func FilterCanaryBatch(logger *zap.Logger, conformanceFile string, nodes []core_v1.Node) ([]core_v1.Node, error) {
+	conformance, err := loadNodeConformance(conformanceFile)
+	if err != nil {
+		return nil, err
+	}
+	return conformance.filterCanaryBatch(logger, nodes)
+}
+
+func (nc *nodeConformance) check(node core_v1.Node) (reason string) {
+	nodeInfo := node.Status.NodeInfo
+	if nc.MinKernelVersion != "" && !isVersionAtLeast(nodeInfo.KernelVersion, nc.MinKernelVersion) {
+		return "kernel version " + nodeInfo.KernelVersion + " is older than " + nc.MinKernelVersion
+	}
+	if nc.MinContainerdVersion != "" {
+		runtimeVersion := nodeInfo.ContainerRuntimeVersion
+		if !strings.HasPrefix(runtimeVersion, "containerd://") || !isVersionAtLeast(strings.TrimPrefix(runtimeVersion, "containerd://"), nc.MinContainerdVersion) {
+			return "container runtime " + runtimeVersion + " is older than containerd " + nc.MinContainerdVersion
+		}
+	}
+	for _, requiredLabel := range nc.RequiredLabels {
+		selector, err := labels.Parse(requiredLabel)
+		if err != nil {
+			return err.Error()
+		}
+		if !selector.Matches(labels.Set(node.Labels)) {
+			return "missing label " + requiredLabel
+		}
+	}
+	for _, taint := range node.Spec.Taints {
+		for _, forbiddenTaint := range nc.ForbiddenTaints {
+			if taint.Key == forbiddenTaint {
+				return "forbidden taint " + taint.Key
+			}
+		}
+	}
+	if nc.RejectDiskPressuredNodes {
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == core_v1.NodeDiskPressure && condition.Status == core_v1.ConditionTrue {
+				return "disk pressure"
+			}
+		}
+	}
+	return
+}
+
+func isVersionAtLeast(actual string, minimum string) bool {
+	actualVersion, err := version.ParseGeneric(actual)
+	if err != nil {
+		return false
+	}
+	minimumVersion, err := version.ParseGeneric(minimum)
+	if err != nil {
+		return false
+	}
+	return actualVersion.AtLeast(minimumVersion)
+}
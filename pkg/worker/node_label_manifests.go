@@ -0,0 +1,99 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+
+	"rooster/pkg/config"
+	"rooster/pkg/utils"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// nodeLabelManifest is a partial Node, holding the labels managed by Rooster only. Applied server-side, it leaves the other fields alone
+type nodeLabelManifest struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name   string            `yaml:"name"`
+		Labels map[string]string `yaml:"labels"`
+	} `yaml:"metadata"`
+}
+
+// NodeLabelManifests describes the canary label state of the nodes once the batches up to lastBatch are patched, as Node manifests.
+// Teams applying every change through GitOps commit them, rather than having Rooster patch the nodes. lastBatch < 0: all the batches
+func NodeLabelManifests(kubernetesClient *utils.K8sClient, logger *zap.Logger, options config.RoosterOptions, lastBatch int) (manifests []byte, err error) {
+	// Client settings
+	clients := Clients{}
+	clients.K8sClient = *kubernetesClient
+	canaryLabelKey, canaryLabelValue, found := strings.Cut(options.CanaryLabel, "=")
+	if !found || canaryLabelKey == "" {
+		return nil, errors.New("invalid canary label " + options.CanaryLabel + ". Expected key=value")
+	}
+	canary, profile, err := resolveRampProfile(options)
+	if err != nil {
+		return
+	}
+	customOptions := meta_v1.ListOptions{}
+	customOptions.LabelSelector = options.TargetLabel
+	targetNodes := clients.getTargetNodes(logger, options.TargetLabel, customOptions)
+	targetNodes.Items, _ = skipNodesUnderMaintenance(logger, targetNodes.Items)
+	if err = clients.orderTargetNodes(logger, targetNodes.Items, options); err != nil {
+		return
+	}
+	batches := planBatches(targetNodes.Items, canary, profile)
+	if lastBatch >= len(batches) {
+		return nil, errors.New("batch " + strconv.Itoa(lastBatch) + " does not exist. The rollout has " + strconv.Itoa(len(batches)) + " batches, the canary batch being 0")
+	}
+	if lastBatch < 0 {
+		lastBatch = len(batches) - 1
+	}
+	// Nodes that do not meet the prerequisites are left out, as in a rollout
+	conformance, err := loadNodeConformance(config.Env.NodeConformanceFile)
+	if err != nil {
+		return
+	}
+	output := new(bytes.Buffer)
+	for i, batch := range batches[:lastBatch+1] {
+		batch, err = conformance.filterNodes(logger, batch)
+		if err != nil {
+			return nil, err
+		}
+		title := "Canary batch"
+		if i > 0 {
+			title = "Increment " + strconv.Itoa(i)
+		}
+		for _, node := range batch {
+			manifest := nodeLabelManifest{APIVersion: "v1", Kind: "Node"}
+			manifest.Metadata.Name = node.Name
+			manifest.Metadata.Labels = map[string]string{canaryLabelKey: canaryLabelValue}
+			content, err := yaml.Marshal(manifest)
+			if err != nil {
+				return nil, err
+			}
+			output.WriteString("---\n# " + title + "\n")
+			output.Write(content)
+		}
+	}
+	return output.Bytes(), nil
+}
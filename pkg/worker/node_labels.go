@@ -0,0 +1,85 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"rooster/pkg/config"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	core_v1_apply "k8s.io/client-go/applyconfigurations/core/v1"
+)
+
+// The API server refuses the field managers longer than 128 characters
+const maxFieldManagerLength = 128
+
+// ApplyCanaryLabel sets the canary label of a node in a single server-side apply. Rooster owns the label afterwards,
+// even when it was set by another field manager before
+func (c Clients) ApplyCanaryLabel(ctx context.Context, nodeName string, key string, value string, dryRun bool) error {
+	node := core_v1_apply.Node(nodeName).WithLabels(map[string]string{key: value})
+	applyOptions := meta_v1.ApplyOptions{FieldManager: labelFieldManager(key), Force: true}
+	if dryRun {
+		applyOptions.DryRun = []string{"All"}
+	}
+	_, err := c.K8sClient.GetClient().CoreV1().Nodes().Apply(ctx, node, applyOptions)
+	return err
+}
+
+// labelFieldManager returns the field manager owning a label key. Server-side apply deletes the fields a manager owned
+// and left out of its last apply: with one manager per key, the canary labels of the projects sharing a node stay apart
+func labelFieldManager(key string) string {
+	manager := config.Env.FieldManager + "/" + key
+	if len(manager) <= maxFieldManagerLength {
+		return manager
+	}
+	// Long keys are hashed
+	hash := sha256.Sum256([]byte(key))
+	suffix := "/" + hex.EncodeToString(hash[:])[:16]
+	prefix := config.Env.FieldManager
+	if len(prefix)+len(suffix) > maxFieldManagerLength {
+		prefix = prefix[:maxFieldManagerLength-len(suffix)]
+	}
+	return prefix + suffix
+}
+
+// waitForLabelRemoval makes sure the nodes no longer carry the label, then leaves the scheduler time to react
+func (c Clients) waitForLabelRemoval(logger *zap.Logger, nodes []core_v1.Node, key string) error {
+	for _, node := range nodes {
+		err := wait.PollImmediate(time.Second, config.Env.LabelCheckTimeout, func() (bool, error) {
+			liveNode, err := c.K8sClient.GetClient().CoreV1().Nodes().Get(context.TODO(), node.Name, meta_v1.GetOptions{})
+			if err != nil {
+				logger.Warn(err.Error())
+				return false, nil
+			}
+			_, labeled := liveNode.Labels[key]
+			return !labeled, nil
+		})
+		if err != nil {
+			return errors.New("node " + node.Name + " still carries the label " + key + " after " + config.Env.LabelCheckTimeout.String() + ". Was it set again by a controller?")
+		}
+	}
+	waitForResources(config.Env.LabelSettleTime)
+	return nil
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"strings"
+
+	"rooster/pkg/config"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+// maintenanceMarker tells the node is under maintenance, or about to disappear
+func maintenanceMarker(node core_v1.Node) string {
+	for _, marker := range strings.Split(config.Env.MaintenanceMarkers, ",") {
+		key, value, hasValue := strings.Cut(strings.TrimSpace(marker), "=")
+		if key == "" {
+			continue
+		}
+		if found, ok := node.Labels[key]; ok && (!hasValue || found == value) {
+			return "label " + marker
+		}
+		if found, ok := node.Annotations[key]; ok && (!hasValue || found == value) {
+			return "annotation " + marker
+		}
+		for _, taint := range node.Spec.Taints {
+			if taint.Key == key && (!hasValue || taint.Value == value) {
+				return "taint " + marker
+			}
+		}
+	}
+	return ""
+}
+
+// skipNodesUnderMaintenance leaves out the nodes carrying a maintenance marker, rather than wasting batch slots on them.
+// The names of the skipped nodes are returned, along with their marker
+func skipNodesUnderMaintenance(logger *zap.Logger, nodes []core_v1.Node) (available []core_v1.Node, skipped []string) {
+	available = make([]core_v1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if marker := maintenanceMarker(node); marker != "" {
+			logger.Warn("Skipping node " + node.Name + ": under maintenance (" + marker + ")")
+			skipped = append(skipped, node.Name+" ("+marker+")")
+			continue
+		}
+		available = append(available, node)
+	}
+	return
+}
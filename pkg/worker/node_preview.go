@@ -0,0 +1,108 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"rooster/pkg/config"
+	"rooster/pkg/utils"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PreviewNodes prints the node sets a rollout would work with. Nothing is changed in the cluster
+func PreviewNodes(kubernetesClient *utils.K8sClient, logger *zap.Logger, options config.RoosterOptions) bool {
+	// Client settings
+	clients := Clients{}
+	clients.K8sClient = *kubernetesClient
+	canary, profile, err := resolveRampProfile(options)
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	customOptions := meta_v1.ListOptions{}
+	customOptions.LabelSelector = options.TargetLabel
+	targetNodes := clients.getTargetNodes(logger, options.TargetLabel, customOptions)
+	targetNodes.Items, _ = skipNodesUnderMaintenance(logger, targetNodes.Items)
+	if err = clients.orderTargetNodes(logger, targetNodes.Items, options); err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	printNodes("Target nodes ("+options.TargetLabel+")", targetNodes.Items)
+	if options.CanaryLabel != "" {
+		canaryLabelKey := strings.Split(options.CanaryLabel, "=")[0]
+		printNodes("Nodes carrying the canary label ("+options.CanaryLabel+")", clients.ensureCanaryLabelPropagation(logger, canaryLabelKey, options.CanaryLabel))
+	}
+	printBatches(planBatches(targetNodes.Items, canary, profile), len(targetNodes.Items))
+	return true
+}
+
+func printBatches(batches [][]core_v1.Node, totalNodes int) {
+	patchedNodes := 0
+	for i, batch := range batches {
+		patchedNodes += len(batch)
+		title := "Canary batch"
+		if i > 0 {
+			title = "Increment " + strconv.Itoa(i)
+		}
+		coverage := 0
+		if totalNodes > 0 {
+			coverage = patchedNodes * 100 / totalNodes
+		}
+		fmt.Println(title + " (coverage: " + strconv.Itoa(coverage) + "%): " + strconv.Itoa(len(batch)) + zoneBreakdown(batch))
+		for _, node := range batch {
+			fmt.Println("  - " + node.Name)
+		}
+	}
+}
+
+func zoneBreakdown(nodes []core_v1.Node) string {
+	zones := []string{}
+	nodesPerZone := make(map[string]int)
+	for _, node := range nodes {
+		zone, found := node.Labels[zoneLabel]
+		if !found {
+			continue
+		}
+		if nodesPerZone[zone] == 0 {
+			zones = append(zones, zone)
+		}
+		nodesPerZone[zone]++
+	}
+	if len(zones) == 0 {
+		return ""
+	}
+	sort.Strings(zones)
+	breakdown := []string{}
+	for _, zone := range zones {
+		breakdown = append(breakdown, zone+": "+strconv.Itoa(nodesPerZone[zone]))
+	}
+	return " [" + strings.Join(breakdown, ", ") + "]"
+}
+
+func printNodes(title string, nodes []core_v1.Node) {
+	fmt.Println(title + ": " + strconv.Itoa(len(nodes)))
+	for _, node := range nodes {
+		fmt.Println("  - " + node.Name)
+	}
+}
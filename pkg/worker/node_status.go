@@ -0,0 +1,287 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"rooster/pkg/config"
+	"rooster/pkg/utils"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Phases of a node, from its batch being planned to its batch being verified
+const (
+	nodePendingPhase      = "pending"
+	nodeLabeledPhase      = "labeled"
+	nodePodRecreatedPhase = "pod-recreated"
+	nodeReadyPhase        = "ready"
+	nodeVerifiedPhase     = "verified"
+	nodeFailedPhase       = "failed"
+)
+
+// Pause between two checks of the batch barrier
+const batchBarrierInterval = 5 * time.Second
+
+type nodeStatus struct {
+	batch  int
+	phase  string
+	reason string
+	// The node failed, and was given a second chance at the end of the rollout
+	retried bool
+}
+
+// nodeStatusTable follows the phase of the target nodes, batch after batch
+type nodeStatusTable struct {
+	nodes    []string
+	statuses map[string]*nodeStatus
+}
+
+// Node status table of the last rollout, sent along with the failure report
+var lastNodeStatus string
+
+func newNodeStatusTable(batches [][]core_v1.Node) *nodeStatusTable {
+	table := &nodeStatusTable{statuses: make(map[string]*nodeStatus)}
+	for i, batch := range batches {
+		table.set(batch, i, nodePendingPhase)
+	}
+	return table
+}
+
+// set moves the nodes of the batch to the phase. The failed nodes stay failed
+func (t *nodeStatusTable) set(nodes []core_v1.Node, batch int, phase string) {
+	for _, node := range nodes {
+		status, found := t.statuses[node.Name]
+		if !found {
+			status = &nodeStatus{}
+			t.statuses[node.Name] = status
+			t.nodes = append(t.nodes, node.Name)
+		}
+		if status.phase == nodeFailedPhase {
+			continue
+		}
+		status.batch = batch
+		status.phase = phase
+	}
+	lastNodeStatus = t.render()
+}
+
+func (t *nodeStatusTable) fail(node string, reason string) {
+	if status, found := t.statuses[node]; found {
+		status.phase = nodeFailedPhase
+		status.reason = reason
+	}
+	lastNodeStatus = t.render()
+}
+
+// retry puts the failed node back to the labeled phase, for a second & last attempt
+func (t *nodeStatusTable) retry(node string) {
+	if status, found := t.statuses[node]; found {
+		status.phase = nodeLabeledPhase
+		status.reason = ""
+		status.retried = true
+	}
+}
+
+// retriableNodes lists the failed nodes that were not retried yet
+func (t *nodeStatusTable) retriableNodes() (retriable []string) {
+	for _, node := range t.failedNodes() {
+		if !t.statuses[node].retried {
+			retriable = append(retriable, node)
+		}
+	}
+	return
+}
+
+func (t *nodeStatusTable) failedNodes() (failed []string) {
+	for _, node := range t.nodes {
+		if t.statuses[node].phase == nodeFailedPhase {
+			failed = append(failed, node)
+		}
+	}
+	return
+}
+
+func (t *nodeStatusTable) render() string {
+	buffer := &bytes.Buffer{}
+	w := tabwriter.NewWriter(buffer, 0, 0, 2, ' ', 0)
+	w.Write([]byte("NODE\tBATCH\tPHASE\tREASON\n"))
+	for _, node := range t.nodes {
+		status := t.statuses[node]
+		reason := status.reason
+		if status.retried {
+			reason = strings.TrimSuffix("retried. "+reason, " ")
+		}
+		w.Write([]byte(node + "\t" + strconv.Itoa(status.batch) + "\t" + status.phase + "\t" + reason + "\n"))
+	}
+	w.Flush()
+	return buffer.String()
+}
+
+// awaitBatchNodes is the completion barrier of a batch: it waits until each node runs a ready pod of every DaemonSet of the manifests.
+// The nodes still not ready after BATCH_BARRIER_TIMEOUT are failed. The ready nodes are returned
+func (c Clients) awaitBatchNodes(logger *zap.Logger, table *nodeStatusTable, targetResources map[string]string, batch int, nodes []core_v1.Node, labeledAt time.Time) (readyNodes []core_v1.Node) {
+	daemonSets := []unstructured.Unstructured{}
+	_, resources := c.queryResources(logger, utils.Get, targetResources, queryOptions{ignoreNotFound: true})
+	for _, resource := range resources {
+		if resource.GetKind() == "DaemonSet" {
+			daemonSets = append(daemonSets, resource)
+		}
+	}
+	pending := nodes
+	deadline := time.Now().Add(config.Env.BatchBarrierTimeout)
+	for {
+		stillPending := []core_v1.Node{}
+		for _, node := range pending {
+			phase, reason := c.nodePhase(daemonSets, node, labeledAt)
+			table.set([]core_v1.Node{node}, batch, phase)
+			if phase == nodeReadyPhase {
+				readyNodes = append(readyNodes, node)
+				continue
+			}
+			if time.Now().After(deadline) {
+				logger.Warn("Node " + node.Name + " did not get ready: " + reason)
+				table.fail(node.Name, reason)
+				continue
+			}
+			stillPending = append(stillPending, node)
+		}
+		if len(stillPending) == 0 {
+			break
+		}
+		pending = stillPending
+		waitForResources(batchBarrierInterval)
+	}
+	logger.Info("Node status:\n" + table.render())
+	return
+}
+
+// nodePhase tells how far the node went: labeled, its pods recreated since, or ready. The reason tells what is missing
+func (c Clients) nodePhase(daemonSets []unstructured.Unstructured, node core_v1.Node, labeledAt time.Time) (phase string, reason string) {
+	recreated, ready := true, true
+	var missing []string
+	for _, daemonSet := range daemonSets {
+		pods, err := c.daemonSetPodsOnNode(daemonSet, node)
+		if err != nil {
+			return nodeLabeledPhase, err.Error()
+		}
+		if !hasPodCreatedSince(pods, labeledAt) {
+			recreated = false
+		}
+		if !hasReadyPod(pods) {
+			ready = false
+			missing = append(missing, daemonSet.GetName())
+		}
+	}
+	switch {
+	case ready:
+		return nodeReadyPhase, ""
+	case recreated:
+		return nodePodRecreatedPhase, "no ready pod of " + strings.Join(missing, ", ")
+	default:
+		return nodeLabeledPhase, "no pod of " + strings.Join(missing, ", ") + " created since the node was labeled"
+	}
+}
+
+func hasPodCreatedSince(pods []core_v1.Pod, since time.Time) bool {
+	for _, pod := range pods {
+		// Creation times are rounded down to the second
+		if pod.DeletionTimestamp == nil && !pod.CreationTimestamp.Before(&meta_v1.Time{Time: since.Truncate(time.Second)}) {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutNodes returns the nodes, except the named ones
+func withoutNodes(nodes []core_v1.Node, names []string) (kept []core_v1.Node) {
+	excluded := make(map[string]bool, len(names))
+	for _, name := range names {
+		excluded[name] = true
+	}
+	for _, node := range nodes {
+		if !excluded[node.Name] {
+			kept = append(kept, node)
+		}
+	}
+	return
+}
+
+// checkNodeFailures fails the rollout once more nodes failed than tolerated
+func checkNodeFailures(table *nodeStatusTable, maxNodeFailures int) error {
+	failed := table.failedNodes()
+	if len(failed) > maxNodeFailures {
+		return errors.New(strconv.Itoa(len(failed)) + " nodes did not get ready (" + strings.Join(failed, ", ") + "), " + strconv.Itoa(maxNodeFailures) + " tolerated")
+	}
+	return nil
+}
+
+// retryFailedNodes gives the failed nodes a second & last chance, once the last batch is patched: the pods of the DaemonSets
+// are recreated on them, and they go through the barrier once more. The nodes that recover are returned
+func (c Clients) retryFailedNodes(logger *zap.Logger, table *nodeStatusTable, targetResources map[string]string) (recovered []core_v1.Node) {
+	failed := table.retriableNodes()
+	if len(failed) == 0 {
+		return
+	}
+	logger.Info("Retrying the nodes that failed: " + strings.Join(failed, ", "))
+	_, resources := c.queryResources(logger, utils.Get, targetResources, queryOptions{ignoreNotFound: true})
+	retriedAt := time.Now()
+	batches := make(map[int][]core_v1.Node)
+	for _, name := range failed {
+		node := core_v1.Node{ObjectMeta: meta_v1.ObjectMeta{Name: name}}
+		for _, resource := range resources {
+			if resource.GetKind() != "DaemonSet" {
+				continue
+			}
+			if err := c.recreateDaemonSetPods(resource, node); err != nil {
+				logger.Warn("Could not recreate the pods of DaemonSet " + resource.GetName() + " on node " + name + ": " + err.Error())
+			}
+		}
+		table.retry(name)
+		batch := table.statuses[name].batch
+		batches[batch] = append(batches[batch], node)
+	}
+	for batch, nodes := range batches {
+		recovered = append(recovered, c.awaitBatchNodes(logger, table, targetResources, batch, nodes, retriedAt)...)
+	}
+	logger.Info(strconv.Itoa(len(recovered)) + "/" + strconv.Itoa(len(failed)) + " failed nodes recovered. Node status:\n" + table.render())
+	return
+}
+
+// recreateDaemonSetPods deletes the pods of the DaemonSet on the node. The DaemonSet controller creates them again
+func (c Clients) recreateDaemonSetPods(daemonSet unstructured.Unstructured, node core_v1.Node) error {
+	pods, err := c.daemonSetPodsOnNode(daemonSet, node)
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods {
+		if err = c.K8sClient.GetClient().CoreV1().Pods(pod.Namespace).Delete(context.TODO(), pod.Name, meta_v1.DeleteOptions{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
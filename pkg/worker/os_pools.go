@@ -0,0 +1,119 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"rooster/pkg/config"
+
+	"go.uber.org/zap"
+)
+
+// Label the kubelet sets on the nodes, with their operating system
+const osLabel = "kubernetes.io/os"
+
+// Operating systems whose manifests can be set apart, in a subdirectory of the manifest path named after them
+var supportedOS = []string{"linux", "windows"}
+
+// OSPools lists the operating systems the manifests have a variant for. None: the manifests are the same for all nodes
+func OSPools(manifestPath string) (pools []string) {
+	for _, nodeOS := range supportedOS {
+		if info, err := os.Stat(filepath.Join(manifestPath, nodeOS)); err == nil && info.IsDir() {
+			pools = append(pools, nodeOS)
+		}
+	}
+	return
+}
+
+// OSPoolOptions narrows the rollout to the nodes of the operating system, and to its manifests.
+// The manifests shared by all pools, at the root of the manifest path, are deployed along with the variant.
+// The returned function deletes the manifests rendered for the pool
+func OSPoolOptions(logger *zap.Logger, options config.RoosterOptions, nodeOS string) (poolOptions config.RoosterOptions, cleanup func(), err error) {
+	cleanup = func() {}
+	poolOptions = options
+	renderedPath, err := os.MkdirTemp("", "rooster_"+nodeOS+"_*")
+	if err != nil {
+		return
+	}
+	cleanup = func() { os.RemoveAll(renderedPath) }
+	sharedFiles, err := listManifestFiles(options.ManifestPath)
+	if err != nil {
+		return
+	}
+	variantFiles, err := listManifestFiles(filepath.Join(options.ManifestPath, nodeOS))
+	if err != nil {
+		return
+	}
+	for _, file := range append(sharedFiles, variantFiles...) {
+		// A variant file replaces the shared file of the same name
+		if err = copyFile(file, filepath.Join(renderedPath, filepath.Base(file))); err != nil {
+			return poolOptions, cleanup, err
+		}
+	}
+	// Overlays are looked for in the manifest path
+	overlays := filepath.Join(options.ManifestPath, "overlays")
+	if checkDirectoryExistence(overlays) {
+		absoluteOverlays, err := filepath.Abs(overlays)
+		if err != nil {
+			return poolOptions, cleanup, err
+		}
+		if err = os.Symlink(absoluteOverlays, filepath.Join(renderedPath, "overlays")); err != nil {
+			return poolOptions, cleanup, err
+		}
+	}
+	// The DaemonSets of a variant must not run on the nodes of the other pools, once these carry the canary label
+	for _, file := range variantFiles {
+		daemonSets, err := readDaemonSets(file)
+		if err != nil {
+			return poolOptions, cleanup, err
+		}
+		for _, daemonSet := range daemonSets {
+			if !isScheduledByLabel(daemonSet.Spec.Template.Spec, osLabel, nodeOS) {
+				return poolOptions, cleanup, errors.New(file + ": DaemonSet " + daemonSet.Name + " does not select the " + osLabel + "=" + nodeOS + " nodes. Add it to its node selector")
+			}
+		}
+	}
+	poolOptions.ManifestPath = renderedPath
+	poolOptions.TargetLabel = osLabel + "=" + nodeOS
+	if options.TargetLabel != "" {
+		poolOptions.TargetLabel = options.TargetLabel + "," + poolOptions.TargetLabel
+	}
+	logger.Info("Rolling out the " + nodeOS + " manifests to the nodes matching " + poolOptions.TargetLabel)
+	return
+}
+
+// copyFile copies the file without reading it into memory as a whole
+func copyFile(source string, destination string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(destination, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
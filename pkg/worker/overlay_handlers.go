@@ -0,0 +1,193 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"rooster/pkg/utils"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// OverlayPatch is either a strategic merge patch (a partial resource),
+// or a JSON6902 patch (a target and a list of operations)
+type OverlayPatch struct {
+	File string
+	// Target of the patch
+	Kind string
+	Name string
+	// strategic or json
+	PatchType string
+	content   []byte
+	applied   bool
+}
+
+// RenderOverlay merges the patches of <manifest-path>/overlays/<overlay> onto the base manifests.
+// The resulting manifests are written in a temporary directory, whose path is returned. Patches are applied by kubectl, locally
+func RenderOverlay(logger *zap.Logger, manifestPath string, overlay string) (renderedPath string, err error) {
+	overlayPath := filepath.Join(manifestPath, "overlays", overlay)
+	if exists := checkDirectoryExistence(overlayPath); !exists {
+		err = errors.New(overlayPath + ": No such file or directory")
+		return
+	}
+	patches, err := ReadOverlayPatches(overlayPath)
+	if err != nil {
+		return
+	}
+	baseFiles, err := listManifestFiles(manifestPath)
+	if err != nil {
+		return
+	}
+	renderedPath, err = os.MkdirTemp("", "rooster_overlay_"+overlay+"_*")
+	if err != nil {
+		return
+	}
+	for _, baseFile := range baseFiles {
+		documents, err := decodeDocuments(baseFile)
+		if err != nil {
+			return "", err
+		}
+		for _, document := range documents {
+			kind, _ := document["kind"].(string)
+			metadata, _ := document["metadata"].(map[string]interface{})
+			name, _ := metadata["name"].(string)
+			if kind == "" || name == "" {
+				continue
+			}
+			renderedFile := filepath.Join(renderedPath, kind+"_"+name+".yaml")
+			content, err := yaml.Marshal(document)
+			if err != nil {
+				return "", err
+			}
+			if err = os.WriteFile(renderedFile, content, 0644); err != nil {
+				return "", err
+			}
+			for _, patch := range patches {
+				if patch.Kind != kind || patch.Name != name {
+					continue
+				}
+				logger.Info("Patching " + kind + " " + name + " with " + patch.File)
+				if err = patch.apply(renderedFile); err != nil {
+					return "", err
+				}
+			}
+		}
+	}
+	for _, patch := range patches {
+		if !patch.applied {
+			err = errors.New(patch.File + ": " + patch.Kind + " " + patch.Name + " was not found in the base manifests")
+			return
+		}
+	}
+	return
+}
+
+// ReadOverlayPatches reads the patches of the overlay directory, and their targets. No cluster is needed
+func ReadOverlayPatches(overlayPath string) (patches []*OverlayPatch, err error) {
+	files, err := listManifestFiles(overlayPath)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		documents, err := decodeDocuments(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, document := range documents {
+			patch := &OverlayPatch{File: file}
+			if target, isJSON6902 := document["target"].(map[string]interface{}); isJSON6902 {
+				patch.PatchType = "json"
+				patch.Kind, _ = target["kind"].(string)
+				patch.Name, _ = target["name"].(string)
+				patch.content, err = json.Marshal(document["patch"])
+			} else {
+				patch.PatchType = "strategic"
+				patch.Kind, _ = document["kind"].(string)
+				metadata, _ := document["metadata"].(map[string]interface{})
+				patch.Name, _ = metadata["name"].(string)
+				patch.content, err = json.Marshal(document)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if patch.Kind == "" || patch.Name == "" {
+				return nil, errors.New(file + ": the patch target kind and name are required")
+			}
+			patches = append(patches, patch)
+		}
+	}
+	return
+}
+
+func (p *OverlayPatch) apply(renderedFile string) error {
+	patchFile, err := os.CreateTemp("", "rooster_patch_*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(patchFile.Name())
+	defer patchFile.Close()
+	if _, err = patchFile.Write(p.content); err != nil {
+		return err
+	}
+	// Patch the local file only. Nothing is sent to the cluster
+	cmd, err := utils.Kubectl("", "patch --local --type "+p.PatchType+" --patch-file '"+patchFile.Name()+"' -o yaml", renderedFile)
+	if err != nil {
+		return errors.New(p.File + ": " + cmd)
+	}
+	p.applied = true
+	return os.WriteFile(renderedFile, []byte(cmd), 0644)
+}
+
+func decodeDocuments(file string) (documents []map[string]interface{}, err error) {
+	err = streamDocuments(file, func(document map[string]interface{}) error {
+		documents = append(documents, document)
+		return nil
+	})
+	return
+}
+
+// streamDocuments decodes the documents of the file one at a time, and hands them over to handle. Empty documents are skipped
+func streamDocuments(file string, handle func(document map[string]interface{}) error) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	d := yaml.NewDecoder(f)
+	for document := 1; ; document++ {
+		data := make(map[string]interface{})
+		err = d.Decode(&data)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return &ManifestError{File: file, Document: document, Err: err}
+		}
+		if len(data) == 0 {
+			continue
+		}
+		if err = handle(data); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"rooster/pkg/config"
+	"rooster/pkg/utils"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// Set on the canary batch of a rollout stopped by --canary-only, when --max-pause is set. Removed by the promotion, or the revert
+	pauseDeadlineAnnotation = "rooster/pause-deadline"
+	pausePolicyAnnotation   = "rooster/pause-policy"
+	pauseExpiredEvent       = "pause_expired"
+)
+
+// Policies of --on-max-pause: what happens to a rollout paused for longer than --max-pause
+const (
+	rollbackOnMaxPause = "rollback"
+	completeOnMaxPause = "complete"
+)
+
+func checkMaxPausePolicy(policy string) error {
+	if policy != rollbackOnMaxPause && policy != completeOnMaxPause {
+		return errors.New("unknown --on-max-pause policy: " + policy + ". Expected " + rollbackOnMaxPause + " or " + completeOnMaxPause)
+	}
+	return nil
+}
+
+// pauseOutcome describes what the policy does to the rollout
+func pauseOutcome(policy string) string {
+	if policy == completeOnMaxPause {
+		return "completed"
+	}
+	return "rolled back"
+}
+
+// setPauseDeadline records until when the rollout may stay paused after its canary batch, and what happens next
+func setPauseDeadline(logger *zap.Logger, nodes []core_v1.Node, maxPause time.Duration, policy string) {
+	deadline := time.Now().UTC().Add(maxPause).Format(time.RFC3339)
+	for _, node := range nodes {
+		cmd, err := utils.Kubectl("", "annotate --overwrite node "+node.Name+" "+pauseDeadlineAnnotation+"="+deadline+" "+pausePolicyAnnotation+"="+policy)
+		if err != nil {
+			logger.Warn("Could not set the pause deadline of node " + node.Name + ": " + cmd)
+		}
+	}
+}
+
+// clearPauseDeadline removes the pause deadline from the nodes carrying one: the rollout is no longer paused
+func clearPauseDeadline(logger *zap.Logger, nodes []core_v1.Node) {
+	for _, node := range nodes {
+		if node.Annotations[pauseDeadlineAnnotation] == "" {
+			continue
+		}
+		cmd, err := utils.Kubectl("", "annotate node "+node.Name+" "+pauseDeadlineAnnotation+"- "+pausePolicyAnnotation+"-")
+		if err != nil {
+			logger.Warn("Could not clear the pause deadline of node " + node.Name + ": " + cmd)
+		}
+	}
+}
+
+// Progress of a promotion, as told by the versions of the target nodes
+const (
+	promotionNeeded   = "needed"
+	promotionComplete = "complete"
+	// Only the nodes under maintenance do not run the version
+	promotionWaitingForMaintenance = "waiting-for-maintenance"
+)
+
+// promotionProgress tells whether target nodes are left to patch, and whether only the nodes under maintenance are
+func (c Clients) promotionProgress(logger *zap.Logger, options config.RoosterOptions) string {
+	customOptions := meta_v1.ListOptions{}
+	customOptions.LabelSelector = options.TargetLabel
+	targetNodes := c.getTargetNodes(logger, options.TargetLabel, customOptions)
+	if len(targetNodes.Items) == 0 {
+		return promotionNeeded
+	}
+	_, remaining := splitPromotedNodes(targetNodes.Items, options.CanaryLabel)
+	if len(remaining) == 0 {
+		return promotionComplete
+	}
+	if available, _ := skipNodesUnderMaintenance(zap.NewNop(), remaining); len(available) == 0 {
+		return promotionWaitingForMaintenance
+	}
+	return promotionNeeded
+}
+
+// pauseDeadline returns the earliest deadline set on the nodes, and its policy. found is false when the rollout has no deadline
+func pauseDeadline(nodes []core_v1.Node) (deadline time.Time, policy string, found bool) {
+	for _, node := range nodes {
+		nodeDeadline, err := time.Parse(time.RFC3339, node.Annotations[pauseDeadlineAnnotation])
+		if err != nil {
+			continue
+		}
+		if !found || nodeDeadline.Before(deadline) {
+			deadline, policy, found = nodeDeadline, node.Annotations[pausePolicyAnnotation], true
+		}
+	}
+	return
+}
+
+// EnforcePauseDeadline is the dead man's switch of the rollouts stopped after their canary batch: once the pause deadline
+// of the canary batch is over, the rollout is rolled back or completed, following the policy recorded with the deadline.
+// Meant to be run on a schedule, with the options of the rollout
+func EnforcePauseDeadline(kubernetesClient *utils.K8sClient, logger *zap.Logger, options config.RoosterOptions) (succeeded bool) {
+	clients := Clients{}
+	clients.K8sClient = *kubernetesClient
+	canaryLabelKey := strings.Split(options.CanaryLabel, "=")[0]
+	canaryNodes := clients.ensureCanaryLabelPropagation(logger, canaryLabelKey, options.CanaryLabel)
+	deadline, policy, found := pauseDeadline(canaryNodes)
+	if !found {
+		logger.Info("No paused rollout: no node carrying the canary label " + options.CanaryLabel + " has a pause deadline")
+		return true
+	}
+	if time.Now().Before(deadline) {
+		logger.Info("The rollout is paused until " + deadline.Format(time.RFC3339) + ". It is then " + pauseOutcome(policy))
+		return true
+	}
+	if err := checkMaxPausePolicy(policy); err != nil {
+		logger.Error(pausePolicyAnnotation + ": " + err.Error())
+		return false
+	}
+	if policy == completeOnMaxPause && clients.promotionProgress(logger, options) == promotionWaitingForMaintenance {
+		// The deadline is kept: the next run completes the rollout once they are back
+		logger.Info("The rollout is paused past its deadline, but only the nodes under maintenance are left to patch. Waiting for them")
+		return true
+	}
+	logger.Warn("The rollout has been paused since its canary batch for longer than allowed: the deadline was " + deadline.Format(time.RFC3339) + ". Applying the " + policy + " policy")
+	events, err := newEventRecorder(logger, options.EventsFile, determineInitiator(), options.ManifestPath, options.CanaryLabel)
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	events.record(rolloutEvent{Type: pauseExpiredEvent, Nodes: nodeNames(canaryNodes), Message: policy, DryRun: options.DryRun})
+	events.close()
+	if options.DryRun {
+		logger.Info("As dry as it gets")
+		return true
+	}
+	if policy == completeOnMaxPause {
+		var pending bool
+		succeeded, pending = promoteRollout(kubernetesClient, logger, options)
+		if pending {
+			logger.Info("Only the nodes under maintenance are left to patch. The pause deadline is kept")
+			return true
+		}
+		// Notified like a rolled back rollout. Nobody is there to decide on a revert when the promotion failed
+		if succeeded {
+			lastFailureReason = pauseExpiredReason
+		}
+		ReportFailure(logger, options, false, false)
+		return
+	}
+	// Notified like a failed rollout
+	lastFailureReason = pauseExpiredReason
+	succeeded = RevertDeployment(kubernetesClient, logger, options)
+	ReportFailure(logger, options, true, succeeded)
+	return
+}
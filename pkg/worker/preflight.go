@@ -0,0 +1,378 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"rooster/pkg/config"
+	"rooster/pkg/utils"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Outcomes of the preflight validators
+const (
+	PreflightPass = "pass"
+	PreflightWarn = "warn"
+	PreflightFail = "fail"
+)
+
+// PreflightResult is the outcome of a preflight validator
+type PreflightResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// Reason code of the rollout, when the validator failed
+	Reason   string             `json:"reason,omitempty"`
+	Messages []PreflightMessage `json:"messages,omitempty"`
+}
+
+// PreflightMessage is a warning, or the failure, of a validator. File & Line: manifest at fault, when known
+type PreflightMessage struct {
+	Status string `json:"status"`
+	Text   string `json:"text"`
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+}
+
+func (r *PreflightResult) warn(file string, text string) {
+	r.Messages = append(r.Messages, PreflightMessage{Status: PreflightWarn, Text: text, File: file})
+	if r.Status == PreflightPass {
+		r.Status = PreflightWarn
+	}
+}
+
+func (r *PreflightResult) fail(err error) {
+	message := PreflightMessage{Status: PreflightFail, Text: err.Error()}
+	manifestError := &ManifestError{}
+	if errors.As(err, &manifestError) {
+		message.File = manifestError.File
+		message.Line = manifestError.Line
+		message.Text = manifestError.Err.Error()
+	}
+	r.Messages = append(r.Messages, message)
+	r.Status = PreflightFail
+}
+
+// preflight is what the validators gathered on the way, for the validators that follow and for the rollout
+type preflight struct {
+	clients   Clients
+	logger    *zap.Logger
+	options   config.RoosterOptions
+	initiator string
+
+	targetResources map[string]string
+	tenant          *tenantScope
+	canary          int
+	profile         rampProfile
+	identities      *namespaceIdentities
+	successCriteria *successCriteria
+	testSuites      []testSuite
+	devicePlugin    bool
+	// Target nodes, but the ones under maintenance
+	targetNodes core_v1.NodeList
+	// Nodes carrying the canary label already
+	existingCanary bool
+	// Promotion of a canary batch, which carries the canary label by design
+	promotion bool
+}
+
+// preflightValidator checks one aspect of the rollout. reason: reason code of the rollout when it fails
+type preflightValidator struct {
+	name     string
+	reason   string
+	validate func(p *preflight, result *PreflightResult)
+}
+
+// Validators of the preflight, in order. A validator may rely on what the previous ones gathered
+var preflightValidators = []preflightValidator{
+	{name: "cluster-capabilities", validate: validateClusterCapabilities},
+	{name: "manifests", validate: validateManifests},
+	{name: "tenant-resources", validate: validateTenantResources},
+	{name: "rollout-options", validate: validateRolloutOptions},
+	{name: "canary-scheduling", validate: validateCanaryScheduling},
+	{name: "unmanaged-pods", validate: validateUnmanagedPods},
+	{name: "target-nodes", validate: validateTargetNodes},
+	{name: "version-skew", reason: skewViolationReason, validate: validateVersionSkew},
+	{name: "taint-tolerations", reason: untoleratedTaintReason, validate: validateTaintTolerations},
+	{name: "existing-canary", validate: validateExistingCanary},
+}
+
+// Preflight runs the preflight validators against the manifests of the options, once rendered. Nothing is changed in the cluster
+func Preflight(kubernetesClient *utils.K8sClient, logger *zap.Logger, options config.RoosterOptions) []PreflightResult {
+	manifestPath, cleanup, err := renderManifests(logger, options)
+	defer cleanup()
+	if err != nil {
+		result := PreflightResult{Name: "manifests", Status: PreflightPass}
+		result.fail(err)
+		return []PreflightResult{result}
+	}
+	options.ManifestPath = manifestPath
+	clients := Clients{K8sClient: *kubernetesClient}
+	_, results := clients.runPreflight(logger, options, determineInitiator(), false)
+	return results
+}
+
+// runPreflight runs the validators in order. The first failure stops the pipeline: the validators left are not run
+func (c Clients) runPreflight(logger *zap.Logger, options config.RoosterOptions, initiator string, promotion bool) (*preflight, []PreflightResult) {
+	p := &preflight{clients: c, logger: logger, options: options, initiator: initiator, promotion: promotion}
+	results := make([]PreflightResult, 0, len(preflightValidators))
+	for _, validator := range preflightValidators {
+		result := PreflightResult{Name: validator.name, Status: PreflightPass}
+		validator.validate(p, &result)
+		for _, message := range result.Messages {
+			if message.Status == PreflightFail {
+				logger.Error("Preflight " + validator.name + ": " + message.Text)
+			} else {
+				logger.Warn("Preflight " + validator.name + ": " + message.Text)
+			}
+		}
+		results = append(results, result)
+		if result.Status == PreflightFail {
+			results[len(results)-1].Reason = validator.reason
+			break
+		}
+		logger.Info("Preflight " + validator.name + ": " + result.Status)
+	}
+	return p, results
+}
+
+// renderAndValidate renders the manifests of the options, and runs the preflight against them, its results going to the findings.
+// The preflight returned points to the rendered manifests, which cleanup removes. It is nil when the rollout cannot go ahead, for the reason returned.
+// promotion: the canary batch is promoted, rather than rolled out
+func (c Clients) renderAndValidate(logger *zap.Logger, options config.RoosterOptions, initiator string, promotion bool, findings *findingsReport) (p *preflight, cleanup func(), reason string) {
+	manifestPath, cleanup, err := renderManifests(logger, options)
+	if err != nil {
+		findings.addError(err)
+		logger.Error(err.Error())
+		return nil, cleanup, preflightFailedReason
+	}
+	options.ManifestPath = manifestPath
+	p, results := c.runPreflight(logger, options, initiator, promotion)
+	findings.addResults(results)
+	if failed := failedPreflight(results); failed != nil {
+		if failed.Reason != "" {
+			return nil, cleanup, failed.Reason
+		}
+		return nil, cleanup, preflightFailedReason
+	}
+	return p, cleanup, ""
+}
+
+// failedPreflight returns the failed result, if any
+func failedPreflight(results []PreflightResult) *PreflightResult {
+	for i := range results {
+		if results[i].Status == PreflightFail {
+			return &results[i]
+		}
+	}
+	return nil
+}
+
+// renderManifests merges the overlay, and the configuration hashes, into a copy of the manifests. cleanup removes the copies
+func renderManifests(logger *zap.Logger, options config.RoosterOptions) (manifestPath string, cleanup func(), err error) {
+	var rendered []string
+	cleanup = func() {
+		for _, path := range rendered {
+			os.RemoveAll(path)
+		}
+	}
+	manifestPath = options.ManifestPath
+	// Environment specific patches
+	if options.Overlay != "" {
+		renderedPath, err := RenderOverlay(logger, manifestPath, options.Overlay)
+		if err != nil {
+			return manifestPath, cleanup, err
+		}
+		rendered = append(rendered, renderedPath)
+		manifestPath = renderedPath
+	}
+	// Configuration changes restart the pods that use it, like any change of their spec
+	hashedPath, err := renderConfigHashes(logger, manifestPath)
+	if err != nil {
+		return
+	}
+	if hashedPath != "" {
+		rendered = append(rendered, hashedPath)
+		manifestPath = hashedPath
+	}
+	return
+}
+
+// The cluster must serve what the rollout relies on
+func validateClusterCapabilities(p *preflight, result *PreflightResult) {
+	warnings, err := p.clients.checkClusterCapabilities(p.logger)
+	for _, warning := range warnings {
+		result.warn("", warning)
+	}
+	if err != nil {
+		result.fail(err)
+	}
+}
+
+func validateManifests(p *preflight, result *PreflightResult) {
+	targetResources, err := ReadManifestFiles(p.logger, p.options.ManifestPath, p.options.Namespace)
+	if err != nil {
+		result.fail(err)
+		return
+	}
+	p.targetResources = targetResources
+}
+
+// Tenants only deploy to their namespaces
+func validateTenantResources(p *preflight, result *PreflightResult) {
+	tenant, err := checkTenantPolicy(p.logger, p.initiator)
+	if err == nil && tenant != nil {
+		err = tenant.checkResources(p.targetResources)
+	}
+	if err != nil {
+		result.fail(err)
+		return
+	}
+	p.tenant = tenant
+}
+
+// How to deploy: the options describing the batches, the judgement & the tests
+func validateRolloutOptions(p *preflight, result *PreflightResult) {
+	var err error
+	options := p.options
+	if p.canary, p.profile, err = resolveRampProfile(options); err != nil {
+		result.fail(err)
+		return
+	}
+	if p.identities, err = parseNamespaceIdentities(options.NamespaceIdentities, options.Namespace); err != nil {
+		result.fail(err)
+		return
+	}
+	if p.successCriteria, err = compileSuccessCriteria(options.SuccessCriteria); err != nil {
+		result.fail(err)
+		return
+	}
+	if p.testSuites, err = parseTestSuites(options); err != nil {
+		result.fail(err)
+		return
+	}
+	if err = checkHealthGatesSyntax(options.HealthGates); err != nil {
+		result.fail(err)
+		return
+	}
+	if options.NotifyTenants && config.Env.TenantWebhookUrl == "" {
+		result.fail(errors.New("--notify-tenants requires the TENANT_WEBHOOK_URL environment variable"))
+		return
+	}
+	switch options.OnExistingCanary {
+	case "", abortOnExistingCanary, continueOnExistingCanary:
+	default:
+		result.fail(errors.New("unknown --on-existing-canary policy: " + options.OnExistingCanary + ". Expected " + abortOnExistingCanary + " or " + continueOnExistingCanary))
+		return
+	}
+	if options.MaxPause > 0 {
+		if err = checkMaxPausePolicy(options.OnMaxPause); err != nil {
+			result.fail(err)
+			return
+		}
+		if options.CanaryHold > options.MaxPause {
+			result.fail(errors.New("the canary hold (" + options.CanaryHold.String() + ") is longer than --max-pause (" + options.MaxPause.String() + ")"))
+			return
+		}
+		if !options.CanaryOnly && options.CanaryHold == 0 {
+			result.warn("", "--max-pause only applies to the rollouts paused after their canary batch, with --canary-only or --canary-hold")
+		}
+	}
+	// Device plugins are checked to advertise the devices again, batch after batch
+	if p.devicePlugin, err = hasDevicePlugin(options.ManifestPath); err != nil {
+		result.fail(err)
+	}
+}
+
+// Labeling the nodes is a no-op for the DaemonSets the canary label does not control
+func validateCanaryScheduling(p *preflight, result *PreflightResult) {
+	uncontrolled, err := checkCanaryScheduling(p.options.ManifestPath, p.options.CanaryLabel)
+	if err != nil {
+		result.fail(err)
+		return
+	}
+	for _, daemonSet := range uncontrolled {
+		result.warn(daemonSet.file, "DaemonSet "+daemonSet.name+" does not require the canary label "+p.options.CanaryLabel+" (nodeSelector or required node affinity). Its pods are not scheduled by the rollout")
+	}
+}
+
+// Pods already running on nodes the canary label does not select make the readiness results meaningless
+func validateUnmanagedPods(p *preflight, result *PreflightResult) {
+	unmanagedPods, err := p.clients.findUnmanagedPods(p.logger, p.targetResources, p.options.CanaryLabel)
+	if err != nil {
+		result.fail(err)
+		return
+	}
+	if len(unmanagedPods) > 0 {
+		result.fail(errors.New("pods of the DaemonSets already run on nodes without the canary label " + p.options.CanaryLabel + ": " + strings.Join(unmanagedPods, ", ") + ". Check the selectors of the live DaemonSets. Aborting"))
+	}
+}
+
+// Where to deploy: the target nodes, but the ones under maintenance
+func validateTargetNodes(p *preflight, result *PreflightResult) {
+	customOptions := meta_v1.ListOptions{}
+	customOptions.LabelSelector = p.options.TargetLabel
+	p.targetNodes = p.clients.getTargetNodes(p.logger, p.options.TargetLabel, customOptions)
+	var skippedNodes []string
+	p.targetNodes.Items, skippedNodes = skipNodesUnderMaintenance(p.logger, p.targetNodes.Items)
+	if len(skippedNodes) > 0 {
+		result.warn("", "Nodes under maintenance are left out of the rollout: "+strings.Join(skippedNodes, ", "))
+	}
+	if p.tenant != nil {
+		if err := p.tenant.checkNodes(p.targetNodes.Items); err != nil {
+			result.fail(err)
+		}
+	}
+}
+
+// The version rolled out must not make the fleet run too many versions
+func validateVersionSkew(p *preflight, result *PreflightResult) {
+	if violations := findSkewViolations(p.logger, p.options, p.targetNodes.Items, true); len(violations) > 0 {
+		result.fail(errors.New("version skew policy violated: " + strings.Join(violations, "; ")))
+	}
+}
+
+// Pods of the DaemonSets are never scheduled on the nodes whose taints they do not tolerate
+func validateTaintTolerations(p *preflight, result *PreflightResult) {
+	untolerated, err := findUntoleratedTaints(p.options.ManifestPath, p.targetNodes.Items)
+	if err != nil {
+		result.fail(err)
+		return
+	}
+	if len(untolerated) > 0 {
+		result.fail(errors.New("the DaemonSets would not be scheduled on tainted target nodes: " + strings.Join(untolerated, "; ") + ". Add the tolerations, e.g. with an overlay, or leave these nodes out of the target label"))
+	}
+}
+
+// Nodes carrying the canary label already are a warning, but for a promotion. Whether the rollout goes ahead is decided by confirmExistingCanary
+func validateExistingCanary(p *preflight, result *PreflightResult) {
+	if p.promotion {
+		return
+	}
+	customOptions := meta_v1.ListOptions{}
+	customOptions.LabelSelector = p.options.CanaryLabel
+	nodes := p.clients.getTargetNodes(p.logger, p.options.CanaryLabel, customOptions)
+	if len(nodes.Items) > 0 {
+		p.existingCanary = true
+		result.warn("", "Nodes already carry the canary label "+p.options.CanaryLabel+": "+describeNodes(nodeNames(nodes.Items)))
+	}
+}
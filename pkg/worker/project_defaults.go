@@ -0,0 +1,69 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"context"
+
+	"rooster/pkg/config"
+	"rooster/pkg/utils"
+
+	core_v1 "k8s.io/api/core/v1"
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	projectConfigMapPrefix = "rooster-project-"
+)
+
+// ProjectNotInitializedError is returned when the ConfigMap of the project does not exist yet
+type ProjectNotInitializedError struct {
+	Project   string
+	ConfigMap string
+}
+
+func (e *ProjectNotInitializedError) Error() string {
+	return "project " + e.Project + " is not initialized: ConfigMap " + e.ConfigMap + " not found. Run with --initialize to create it from the indicated options"
+}
+
+// GetProjectDefaults returns the option values stored in the project ConfigMap, keyed by option name
+func GetProjectDefaults(kubernetesClient *utils.K8sClient, project string) (defaults map[string]string, err error) {
+	ctx := context.TODO()
+	cm, err := kubernetesClient.GetClient().CoreV1().ConfigMaps(config.Env.ProjectNamespace).Get(ctx, projectConfigMapPrefix+project, meta_v1.GetOptions{})
+	if k8s_errors.IsNotFound(err) {
+		return nil, &ProjectNotInitializedError{Project: project, ConfigMap: config.Env.ProjectNamespace + "/" + projectConfigMapPrefix + project}
+	}
+	if err != nil {
+		return
+	}
+	return cm.Data, nil
+}
+
+// InitializeProject creates the project ConfigMap, holding the given option values
+func InitializeProject(kubernetesClient *utils.K8sClient, project string, defaults map[string]string, dryRun bool) error {
+	cm := &core_v1.ConfigMap{}
+	cm.Name = projectConfigMapPrefix + project
+	cm.Namespace = config.Env.ProjectNamespace
+	cm.Data = defaults
+	createOptions := meta_v1.CreateOptions{}
+	if dryRun {
+		createOptions.DryRun = append(createOptions.DryRun, "All")
+	}
+	_, err := kubernetesClient.GetClient().CoreV1().ConfigMaps(cm.Namespace).Create(context.TODO(), cm, createOptions)
+	return err
+}
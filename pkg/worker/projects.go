@@ -0,0 +1,208 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"rooster/pkg/config"
+	"rooster/pkg/utils"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// RenameProject moves the state of a project to a new name: its ConfigMap, and the project annotation of its nodes.
+// The new ConfigMap is created first, so that a failed rename leaves the old project untouched
+func RenameProject(kubernetesClient *utils.K8sClient, logger *zap.Logger, oldName string, newName string, dryRun bool) bool {
+	clients := Clients{}
+	clients.K8sClient = *kubernetesClient
+	ctx := context.TODO()
+	for _, message := range validation.IsDNS1123Subdomain(projectConfigMapPrefix + newName) {
+		logger.Error("Invalid project name " + newName + ": " + message)
+		return false
+	}
+	configMaps := kubernetesClient.GetClient().CoreV1().ConfigMaps(config.Env.ProjectNamespace)
+	oldConfigMap, err := configMaps.Get(ctx, projectConfigMapPrefix+oldName, meta_v1.GetOptions{})
+	if k8s_errors.IsNotFound(err) {
+		logger.Error("Project " + oldName + " not found: ConfigMap " + config.Env.ProjectNamespace + "/" + projectConfigMapPrefix + oldName + " does not exist")
+		return false
+	}
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	nodes, err := clients.projectNodes(oldName)
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	logger.Info("Renaming project " + oldName + " to " + newName + ". Annotated nodes: " + strconv.Itoa(len(nodes)))
+	if dryRun {
+		logger.Info("As dry as it gets")
+		return true
+	}
+	newConfigMap := &core_v1.ConfigMap{}
+	newConfigMap.Name = projectConfigMapPrefix + newName
+	newConfigMap.Namespace = config.Env.ProjectNamespace
+	newConfigMap.Labels = oldConfigMap.Labels
+	newConfigMap.Annotations = oldConfigMap.Annotations
+	newConfigMap.Data = oldConfigMap.Data
+	if _, err = configMaps.Create(ctx, newConfigMap, meta_v1.CreateOptions{}); err != nil {
+		if k8s_errors.IsAlreadyExists(err) {
+			err = errors.New("project " + newName + " already exists. Delete it, or pick another name")
+		}
+		logger.Error(err.Error())
+		return false
+	}
+	for i, node := range nodes {
+		cmd, err := utils.Kubectl("", "annotate --overwrite node "+node.Name+" "+rolloutProjectAnnotation+"="+newName)
+		if err == nil {
+			continue
+		}
+		logger.Error("Could not annotate node " + node.Name + ": " + cmd + ". Restoring the old name")
+		for _, annotatedNode := range nodes[:i] {
+			if cmd, err := utils.Kubectl("", "annotate --overwrite node "+annotatedNode.Name+" "+rolloutProjectAnnotation+"="+oldName); err != nil {
+				logger.Warn("Could not restore the project annotation of node " + annotatedNode.Name + ": " + cmd)
+			}
+		}
+		if err := configMaps.Delete(ctx, newConfigMap.Name, meta_v1.DeleteOptions{}); err != nil {
+			logger.Warn("Could not delete the ConfigMap " + newConfigMap.Name + ": " + err.Error())
+		}
+		return false
+	}
+	if err = configMaps.Delete(ctx, oldConfigMap.Name, meta_v1.DeleteOptions{}); err != nil {
+		logger.Error("Project " + newName + " is created, but the ConfigMap of " + oldName + " could not be deleted: " + err.Error())
+		return false
+	}
+	logger.Info("Project " + oldName + " renamed to " + newName)
+	return true
+}
+
+// projectNodes returns the nodes annotated with the project
+func (c Clients) projectNodes(project string) (nodes []core_v1.Node, err error) {
+	nodeList, err := c.K8sClient.GetClient().CoreV1().Nodes().List(context.TODO(), meta_v1.ListOptions{})
+	if err != nil {
+		return
+	}
+	for _, node := range nodeList.Items {
+		if node.Annotations[rolloutProjectAnnotation] == project {
+			nodes = append(nodes, node)
+		}
+	}
+	return
+}
+
+// ProjectDeletion tells what is removed along with the ConfigMap of the project
+type ProjectDeletion struct {
+	// Manifests of the managed resources. Defaults to the manifest path of the project
+	ManifestPath    string
+	DeleteResources bool
+	PruneBackups    bool
+	DryRun          bool
+}
+
+// DeleteProject offboards a project: the canary label & the annotations of its nodes, optionally its resources & their backups,
+// and its ConfigMap, removed last so that a failed deletion can be run again
+func DeleteProject(kubernetesClient *utils.K8sClient, logger *zap.Logger, project string, deletion ProjectDeletion) bool {
+	clients := Clients{}
+	clients.K8sClient = *kubernetesClient
+	defaults, err := GetProjectDefaults(kubernetesClient, project)
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	canaryLabel := defaults["canary-label"]
+	canaryNodes := []core_v1.Node{}
+	if canaryLabel != "" {
+		canaryLabelKey := strings.Split(canaryLabel, "=")[0]
+		canaryNodes = clients.ensureCanaryLabelPropagation(logger, canaryLabelKey, canaryLabel)
+	}
+	annotatedNodes, err := clients.projectNodes(project)
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	targetResources := map[string]string{}
+	if deletion.DeleteResources || deletion.PruneBackups {
+		manifestPath := deletion.ManifestPath
+		if manifestPath == "" {
+			manifestPath = defaults["manifest-path"]
+		}
+		if manifestPath == "" {
+			logger.Error("Project " + project + " has no manifest path. Indicate the manifests of its resources with --manifest-path")
+			return false
+		}
+		targetResources, err = ReadManifestFiles(logger, manifestPath, defaults["namespace"])
+		if err != nil {
+			logger.Error(err.Error())
+			return false
+		}
+	}
+	logger.Info("Deleting project " + project + ". Nodes with the canary label " + canaryLabel + ": " + strconv.Itoa(len(canaryNodes)) + ". Annotated nodes: " + strconv.Itoa(len(annotatedNodes)))
+	if deletion.DeleteResources {
+		for kindName, namespace := range targetResources {
+			logger.Info("Resource to delete: " + kindName + " (namespace: " + namespace + ")")
+		}
+	}
+	if deletion.DryRun {
+		logger.Info("As dry as it gets")
+		return true
+	}
+	if deletion.DeleteResources {
+		// The resources & the canary labels can be restored with rooster undo
+		if _, err = snapshotResources(logger, deletionOperation, targetResources, false, canaryLabel, canaryNodes); err != nil {
+			logger.Error(err.Error())
+			return false
+		}
+	}
+	for _, node := range canaryNodes {
+		if _, err = clients.removeLabelFromNode(logger, node, canaryLabel, strings.Split(canaryLabel, "=")[0]); err != nil {
+			logger.Error("Could not remove the canary label from node " + node.Name + ": " + err.Error())
+			return false
+		}
+	}
+	clearRolloutAnnotations(logger, annotatedNodes)
+	if deletion.DeleteResources {
+		if err = clients.deletePreviousSettings(logger, targetResources, queryOptions{ignoreNotFound: true}); err != nil {
+			logger.Error(err.Error())
+			return false
+		}
+	}
+	if deletion.PruneBackups {
+		for kindName := range targetResources {
+			backupFile := backupFileName(config.Env.BackupDirectory, getAttribute(kindName, 0), getAttribute(kindName, 1))
+			if err = os.Remove(backupFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+				logger.Warn("Could not prune the backup " + backupFile + ": " + err.Error())
+			}
+		}
+	}
+	err = kubernetesClient.GetClient().CoreV1().ConfigMaps(config.Env.ProjectNamespace).Delete(context.TODO(), projectConfigMapPrefix+project, meta_v1.DeleteOptions{})
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	logger.Info("Project " + project + " deleted")
+	return true
+}
@@ -0,0 +1,324 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"rooster/pkg/config"
+	"rooster/pkg/utils"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PromoteRollout completes a rollout stopped after its canary batch (--canary-only): the canary batch is verified again,
+// then the remaining target nodes are patched, increment after increment. A promotion waiting for the nodes under maintenance succeeds
+func PromoteRollout(kubernetesClient *utils.K8sClient, logger *zap.Logger, options config.RoosterOptions) bool {
+	succeeded, _ := promoteRollout(kubernetesClient, logger, options)
+	return succeeded
+}
+
+// promoteRollout promotes the rollout. pending tells the promotion waits for the nodes under maintenance, the only ones
+// left to patch: the rollout is not complete, and keeps its pause deadline
+func promoteRollout(kubernetesClient *utils.K8sClient, logger *zap.Logger, options config.RoosterOptions) (succeeded bool, pending bool) {
+	// Client settings
+	clients := Clients{}
+	clients.K8sClient = *kubernetesClient
+	initiator := determineInitiator()
+	logger.Info("Promotion initiated by " + initiator)
+	events, err := newEventRecorder(logger, options.EventsFile, initiator, options.ManifestPath, options.CanaryLabel)
+	if err != nil {
+		logger.Error(err.Error())
+		return false, false
+	}
+	defer events.close()
+	events.record(rolloutEvent{Type: promotionStartedEvent, DryRun: options.DryRun})
+	reason := preflightFailedReason
+	defer func() {
+		if pending {
+			events.record(rolloutEvent{Type: promotionPendingEvent, DryRun: options.DryRun})
+			return
+		}
+		if succeeded {
+			events.record(rolloutEvent{Type: rolloutCompletedEvent, DryRun: options.DryRun})
+			return
+		}
+		lastFailureReason = reason
+		events.record(rolloutEvent{Type: rolloutFailedEvent, Reason: reason, DryRun: options.DryRun})
+	}()
+	if options.ExternalStrategy != "" {
+		logger.Error("rooster promote follows the planned increments. Run the rollout without --canary-only to use an external strategy")
+		return false, false
+	}
+	// Nothing to render nor to check when no node is left to patch
+	switch clients.promotionProgress(logger, options) {
+	case promotionComplete:
+		logger.Info("All the target nodes run " + options.CanaryLabel + ". Nothing to promote")
+		if !options.DryRun {
+			clearPauseDeadline(logger, clients.ensureCanaryLabelPropagation(logger, strings.Split(options.CanaryLabel, "=")[0], options.CanaryLabel))
+		}
+		return true, false
+	case promotionWaitingForMaintenance:
+		logger.Info("Only the nodes under maintenance are left to patch. The rollout is not complete until they run " + options.CanaryLabel)
+		return true, true
+	}
+	// Preflight findings, in a machine readable format
+	findings, err := newFindingsReport(options.FindingsFormat, options.FindingsFile)
+	if err != nil {
+		logger.Error(err.Error())
+		return false, false
+	}
+	defer func() {
+		if err := findings.write(); err != nil {
+			logger.Error(err.Error())
+		}
+	}()
+	// The manifests are rendered & checked like the ones of the canary batch
+	preflight, cleanup, preflightReason := clients.renderAndValidate(logger, options, initiator, true, findings)
+	defer cleanup()
+	if preflight == nil {
+		reason = preflightReason
+		return false, false
+	}
+	// Backed up along with the version, once rolled out
+	sourceManifests := options.ManifestPath
+	options.ManifestPath = preflight.options.ManifestPath
+	targetResources := preflight.targetResources
+	canary, profile := preflight.canary, preflight.profile
+	successCriteria := preflight.successCriteria
+	testSuites := preflight.testSuites
+	devicePlugin := preflight.devicePlugin
+	canaryLabelKey := strings.Split(options.CanaryLabel, "=")[0]
+	canaryNodes := clients.ensureCanaryLabelPropagation(logger, canaryLabelKey, options.CanaryLabel)
+	if len(canaryNodes) == 0 {
+		logger.Error("No node carries the canary label " + options.CanaryLabel + ". Run the canary batch first, with --canary-only")
+		return false, false
+	}
+	batches, err := clients.planPromotion(logger, options, canary, profile)
+	if err != nil {
+		logger.Error(err.Error())
+		return false, false
+	}
+	if len(batches) == 0 {
+		// The nodes left to patch went under maintenance since the promotion started
+		logger.Info("Only the nodes under maintenance are left to patch. The rollout is not complete until they run " + options.CanaryLabel)
+		return true, true
+	}
+	if options.DryRun {
+		fmt.Println("Canary batch: " + strconv.Itoa(len(canaryNodes)) + " nodes, already patched")
+		printBatches(append([][]core_v1.Node{{}}, batches...), len(canaryNodes)+len(nodesOf(batches)))
+		logger.Info("As dry as it gets")
+		return true, false
+	}
+	// The canary batch may have degraded since it was rolled out
+	if len(options.HealthGates) > 0 {
+		if err = clients.checkHealthGates(logger, options.HealthGates, canaryNodes); err != nil {
+			reason = healthGateFailedReason
+			logger.Error(err.Error())
+			logger.Warn("The canary batch is not healthy. Promotion aborted")
+			return false, false
+		}
+	}
+	testsRun, err := clients.testBatch(logger, options, testSuites, 0, canaryNodes, false, events)
+	testsPassed := err == nil
+	if err != nil {
+		logger.Error(err.Error())
+		logger.Warn("Tests have failed.")
+		reason = testFailureReason
+		if successCriteria == nil {
+			return false, false
+		}
+	}
+	patchedNodeList := canaryNodes
+	if met := clients.judgeBatch(logger, successCriteria, targetResources, patchedNodeList, testsRun, testsPassed); !met {
+		reason = judgementReason(successCriteria)
+		logger.Warn("The canary batch is not healthy. Promotion aborted")
+		return false, false
+	}
+	conformance, err := loadNodeConformance(config.Env.NodeConformanceFile)
+	if err != nil {
+		logger.Error(err.Error())
+		return false, false
+	}
+	totalNodes := len(canaryNodes) + len(nodesOf(batches))
+	statuses := newNodeStatusTable(append([][]core_v1.Node{canaryNodes}, batches...))
+	statuses.set(canaryNodes, 0, nodeVerifiedPhase)
+	// Nodes carrying the canary label, the failed ones included
+	labeledNodes := len(canaryNodes)
+	for i, batch := range batches {
+		if profile.soak > 0 && i > 0 {
+			logger.Info("Soaking for " + profile.soak.String() + " before the next increment")
+			waitForResources(profile.soak)
+			if met := clients.judgeBatch(logger, successCriteria, targetResources, patchedNodeList, testsRun, testsPassed); !met {
+				reason = judgementReason(successCriteria)
+				return false, false
+			}
+		}
+		batch, err = conformance.filterNodes(logger, batch)
+		if err != nil {
+			reason = nodeConformanceReason
+			logger.Error(err.Error())
+			return false, false
+		}
+		if options.NotifyTenants {
+			clients.notifyTenants(logger, i+1, batch, initiator)
+		}
+		coverage := (labeledNodes + len(batch)) * 100 / totalNodes
+		logger.Info("Patching remaining nodes... Coverage: " + strconv.Itoa(coverage) + "%")
+		labeledAt := time.Now()
+		if patchComplete := clients.patchTargetNodes(logger, batch, options.CanaryLabel, float64(labeledNodes), false); !patchComplete {
+			reason = patchFailedReason
+			logger.Warn("Issues encountered while patching nodes. Aborting...")
+			return false, false
+		}
+		labeledNodes += len(batch)
+		if options.CanaryLabelTTL > 0 {
+			setCanaryLabelExpiry(logger, batch, options.CanaryLabelTTL)
+		}
+		if options.AnnotateNodes {
+			setRolloutAnnotations(logger, batch, options, i+1)
+		}
+		events.recordBatch(batchPatchedEvent, i+1, batch, coverage)
+		statuses.set(batch, i+1, nodeLabeledPhase)
+		batch = clients.awaitBatchNodes(logger, statuses, targetResources, i+1, batch, labeledAt)
+		// The failed nodes are retried after the last batch. Until then, they count against --max-node-failures
+		if err := checkNodeFailures(statuses, options.MaxNodeFailures); err != nil {
+			reason = readinessTimeoutReason
+			logger.Error(err.Error())
+			return false, false
+		}
+		patchedNodeList = append(patchedNodeList, batch...)
+		if devicePlugin {
+			if err = clients.verifyDeviceResources(logger, batch); err != nil {
+				reason = deviceResourcesReason
+				logger.Error(err.Error())
+				return false, false
+			}
+		}
+		if options.NetworkProbe {
+			if err = clients.probeNodeNetworks(logger, batch); err != nil {
+				reason = networkProbeReason
+				logger.Error(err.Error())
+				return false, false
+			}
+		}
+		if len(options.HealthGates) > 0 {
+			if err = clients.checkHealthGates(logger, options.HealthGates, batch); err != nil {
+				reason = healthGateFailedReason
+				logger.Error(err.Error())
+				return false, false
+			}
+		}
+		batchTestsRun, err := clients.testBatch(logger, options, testSuites, i+1, batch, i == len(batches)-1, events)
+		if batchTestsRun {
+			testsRun, testsPassed = true, err == nil
+		}
+		if err != nil {
+			logger.Error(err.Error())
+			logger.Warn("Tests have failed.")
+			reason = testFailureReason
+			if successCriteria == nil {
+				return false, false
+			}
+		}
+		if met := clients.judgeBatch(logger, successCriteria, targetResources, patchedNodeList, testsRun, testsPassed); !met {
+			reason = judgementReason(successCriteria)
+			return false, false
+		}
+		events.recordBatch(batchVerifiedEvent, i+1, batch, coverage)
+		statuses.set(batch, i+1, nodeVerifiedPhase)
+	}
+	if recovered := clients.retryFailedNodes(logger, statuses, targetResources); len(recovered) > 0 {
+		patchedNodeList = append(patchedNodeList, recovered...)
+		events.record(rolloutEvent{Type: nodesRecoveredEvent, Nodes: nodeNames(recovered)})
+	}
+	if options.CanaryLabelTTL > 0 {
+		clearCanaryLabelExpiry(logger, patchedNodeList)
+	}
+	clearPauseDeadline(logger, canaryNodes)
+	recordVersionBackup(logger, options, sourceManifests, targetResources)
+	logger.Info("The rollout was promoted to all the target nodes.")
+	return true, false
+}
+
+// planPromotion splits the target nodes not running the version of the canary label into the increments of the profile.
+// The coverage of the increments accounts for the nodes of the canary batch
+func (c Clients) planPromotion(logger *zap.Logger, options config.RoosterOptions, canary int, profile rampProfile) (batches [][]core_v1.Node, err error) {
+	customOptions := meta_v1.ListOptions{}
+	customOptions.LabelSelector = options.TargetLabel
+	targetNodes := c.getTargetNodes(logger, options.TargetLabel, customOptions)
+	targetNodes.Items, _ = skipNodesUnderMaintenance(logger, targetNodes.Items)
+	promoted, remaining := splitPromotedNodes(targetNodes.Items, options.CanaryLabel)
+	if options.OrderByRisk {
+		risks, err := c.scoreNodes(remaining)
+		if err != nil {
+			return nil, err
+		}
+		orderNodesByRisk(remaining, risks)
+	}
+	return promotionBatches(promoted, remaining, options.CanaryLabel, canary, profile), nil
+}
+
+// PlanPromotionBatches plans the increments of rooster promote over the nodes, in their order. No cluster is needed
+func PlanPromotionBatches(nodes []core_v1.Node, options config.RoosterOptions) (batches [][]core_v1.Node, err error) {
+	canary, profile, err := resolveRampProfile(options)
+	if err != nil {
+		return
+	}
+	promoted, remaining := splitPromotedNodes(nodes, options.CanaryLabel)
+	return promotionBatches(promoted, remaining, options.CanaryLabel, canary, profile), nil
+}
+
+// splitPromotedNodes tells apart the nodes running the version of the canary label from the others.
+// The value of the canary label is the version: nodes carrying its key with another value still run a previous version
+func splitPromotedNodes(nodes []core_v1.Node, canaryLabel string) (promoted []core_v1.Node, remaining []core_v1.Node) {
+	for _, node := range nodes {
+		if runsVersion(node, canaryLabel) {
+			promoted = append(promoted, node)
+			continue
+		}
+		remaining = append(remaining, node)
+	}
+	return
+}
+
+// promotionBatches plans the increments over the whole fleet, the promoted nodes first, and keeps the nodes left to patch
+func promotionBatches(promoted []core_v1.Node, remaining []core_v1.Node, canaryLabel string, canary int, profile rampProfile) (batches [][]core_v1.Node) {
+	for _, batch := range planBatches(append(promoted, remaining...), canary, profile) {
+		unpatched := []core_v1.Node{}
+		for _, node := range batch {
+			if !runsVersion(node, canaryLabel) {
+				unpatched = append(unpatched, node)
+			}
+		}
+		if len(unpatched) > 0 {
+			batches = append(batches, unpatched)
+		}
+	}
+	return
+}
+
+func runsVersion(node core_v1.Node, canaryLabel string) bool {
+	key, value, _ := strings.Cut(canaryLabel, "=")
+	version, found := node.Labels[key]
+	return found && version == value
+}
@@ -17,11 +17,13 @@ limitations under the License.
 package worker
 
 import (
+	"errors"
 	"strings"
 
 	"rooster/pkg/utils"
 
 	"go.uber.org/zap"
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
@@ -34,24 +36,29 @@ func getAttribute(d string, i int) (attribute string) {
 	return
 }
 
-func (c Clients) queryResources(logger *zap.Logger, verb utils.Verb, targetResources map[string]string, dryRun bool) (allExist bool, resources []unstructured.Unstructured) {
+// queryOptions tune the queries run against the target resources
+type queryOptions struct {
+	dryRun bool
+	// Missing resources are skipped, whatever the verb. Otherwise they make the query fail
+	ignoreNotFound bool
+}
+
+func (c Clients) queryResources(logger *zap.Logger, verb utils.Verb, targetResources map[string]string, options queryOptions) (allExist bool, resources []unstructured.Unstructured) {
 	resources = []unstructured.Unstructured{}
 	allExist = true
 	for kindName, namespace := range targetResources {
 		kind := getAttribute(kindName, 0)
 		name := getAttribute(kindName, 1)
+		var err error
 		switch verb {
 		case utils.Get:
-			resource, err := c.getResource(kind, name, namespace)
-			if resource != nil {
+			var resource *unstructured.Unstructured
+			resource, err = c.getResource(kind, name, namespace)
+			if resource != nil && err == nil {
 				resources = append(resources, *resource)
 			}
-			if err != nil {
-				logger.Warn(err.Error())
-				allExist = false
-			}
 		case utils.Delete:
-			c.deleteResource(kind, name, namespace, dryRun)
+			_, err = c.deleteResource(kind, name, namespace, options.dryRun)
 		case utils.Update:
 			logger.Warn("Update not defined yet...")
 		case utils.Create:
@@ -60,11 +67,24 @@ func (c Clients) queryResources(logger *zap.Logger, verb utils.Verb, targetResou
 			logger.Error("Verb is unknown")
 			return
 		}
-
+		if err == nil {
+			continue
+		}
+		if isNotFound(err) && options.ignoreNotFound {
+			logger.Info(kind + " " + name + " was not found. Skipping it")
+			continue
+		}
+		logger.Warn(err.Error())
+		allExist = false
 	}
 	return
 }
 
+// isNotFound covers the errors of the API clients, and the ones of kubectl
+func isNotFound(err error) bool {
+	return k8s_errors.IsNotFound(err) || strings.Contains(err.Error(), "(NotFound)")
+}
+
 func (c Clients) getResource(kind string, name string, namespace string) (resource *unstructured.Unstructured, err error) {
 	switch kind {
 	case "Service":
@@ -75,10 +95,24 @@ func (c Clients) getResource(kind string, name string, namespace string) (resour
 		resource, err = utils.GetConfigMap(c.K8sClient, namespace, name)
 	case "ServiceAccount":
 		resource, err = utils.GetServiceAccount(c.K8sClient, namespace, name)
+	default:
+		resource, err = getResourceWithKubectl(kind, name, namespace)
 	}
 	return
 }
 
+func getResourceWithKubectl(kind string, name string, namespace string) (resource *unstructured.Unstructured, err error) {
+	// kubectl resolves the API version of kinds unknown to Rooster, custom resources included
+	cmd, err := utils.Kubectl(namespace, "get", kind, name, "-ojson")
+	if err != nil {
+		err = errors.New(cmd)
+		return
+	}
+	resource = &unstructured.Unstructured{}
+	err = resource.UnmarshalJSON([]byte(cmd))
+	return
+}
+
 func (c Clients) deleteResource(kind string, name string, namespace string, dryRun bool) (opComplete bool, err error) {
 	customDeleteOptions := meta_v1.DeleteOptions{}
 	if dryRun {
@@ -93,6 +127,20 @@ func (c Clients) deleteResource(kind string, name string, namespace string, dryR
 		opComplete, err = utils.DeleteConfigMap(c.K8sClient, namespace, name, customDeleteOptions)
 	case "ServiceAccount":
 		opComplete, err = utils.DeleteServiceAccount(c.K8sClient, namespace, name, customDeleteOptions)
+	default:
+		opComplete, err = deleteResourceWithKubectl(kind, name, namespace, dryRun)
 	}
 	return
 }
+
+func deleteResourceWithKubectl(kind string, name string, namespace string, dryRun bool) (opComplete bool, err error) {
+	subcommand := "delete"
+	if dryRun {
+		subcommand += " --dry-run=server"
+	}
+	cmd, err := utils.Kubectl(namespace, subcommand, kind, name)
+	if err != nil {
+		return false, errors.New(cmd)
+	}
+	return true, nil
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"rooster/pkg/config"
+	"rooster/pkg/strategy"
+
+	core_v1 "k8s.io/api/core/v1"
+)
+
+// rampProfile is the strategy of the rollout, resolved for its canary batch size
+type rampProfile struct {
+	// Node coverage to reach at each increment, in percentage
+	increments []int
+	// Time to wait before each increment
+	soak time.Duration
+}
+
+// resolveRampProfile combines the strategy selected by the profile with the canary batch size & increment indicated in the options
+func resolveRampProfile(options config.RoosterOptions) (canary int, profile rampProfile, err error) {
+	rampStrategy, err := strategy.Get(options.Profile)
+	if err != nil {
+		return
+	}
+	canary = options.Canary
+	if canary == 0 {
+		canary = rampStrategy.DefaultCanary()
+	}
+	if canary < 0 || canary > 100 {
+		err = errors.New("invalid canary batch size: " + strconv.Itoa(canary) + ". Expected a percentage")
+		return
+	}
+	if options.Increment < 0 || options.Increment > 100 {
+		err = errors.New("invalid increment: " + strconv.Itoa(options.Increment) + ". Expected a percentage")
+		return
+	}
+	if options.Increment > 0 {
+		// Linear increments replace the ones of the profile
+		rampStrategy = strategy.Linear{Base: rampStrategy, Step: options.Increment}
+	}
+	profile = rampProfile{increments: rampStrategy.Increments(canary), soak: rampStrategy.Soak()}
+	return
+}
+
+// planBatches splits the nodes into the canary batch, followed by the increments of the profile
+func planBatches(nodes []core_v1.Node, canary int, profile rampProfile) [][]core_v1.Node {
+	return strategy.Plan(nodes, canary, profile.increments)
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+type readinessRules struct {
+	Rules []readinessRule `yaml:"rules"`
+}
+
+// readinessRule tells when a resource of the given group & kind is ready.
+// E.g: group: example.com, kind: Widget, jsonPath: '{.status.phase}', expected: Running
+type readinessRule struct {
+	Group    string `yaml:"group"`
+	Kind     string `yaml:"kind"`
+	JSONPath string `yaml:"jsonPath"`
+	Expected string `yaml:"expected"`
+}
+
+func loadReadinessRules(rulesFile string) (registry map[schema.GroupKind]readinessRule, err error) {
+	registry = make(map[schema.GroupKind]readinessRule)
+	if rulesFile == "" {
+		return
+	}
+	content, err := os.ReadFile(rulesFile)
+	if err != nil {
+		return
+	}
+	rules := readinessRules{}
+	if err = yaml.Unmarshal(content, &rules); err != nil {
+		return
+	}
+	for _, rule := range rules.Rules {
+		if rule.Kind == "" || rule.JSONPath == "" {
+			err = errors.New("invalid readiness rule in " + rulesFile + ": kind and jsonPath are required")
+			return
+		}
+		registry[schema.GroupKind{Group: rule.Group, Kind: rule.Kind}] = rule
+	}
+	return
+}
+
+func (r readinessRule) evaluate(object map[string]interface{}) (ready bool, err error) {
+	parser := jsonpath.New(r.Kind)
+	if err = parser.Parse(r.JSONPath); err != nil {
+		return
+	}
+	result := new(bytes.Buffer)
+	if err = parser.Execute(result, object); err != nil {
+		return
+	}
+	return strings.TrimSpace(result.String()) == r.Expected, nil
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+// Reason codes of the failed rollouts. They are recorded in the events & the failure reports, for the automation reacting to them
+const (
+	preflightFailedReason  = "PreflightFailed"
+	existingCanaryReason   = "ExistingCanary"
+	skewViolationReason    = "SkewViolation"
+	nodeConformanceReason  = "NodeNotConformant"
+	untoleratedTaintReason = "UntoleratedTaint"
+	patchFailedReason      = "PatchFailed"
+	deployFailedReason     = "DeployFailed"
+	readinessTimeoutReason = "ReadinessTimeout"
+	criteriaNotMetReason   = "CriteriaNotMet"
+	deviceResourcesReason  = "DeviceResourcesMissing"
+	networkProbeReason     = "NetworkProbeFailed"
+	healthGateFailedReason = "HealthGateFailed"
+	testFailureReason      = "TestFailure"
+	strategyFailedReason   = "StrategyFailed"
+	pauseExpiredReason     = "PauseExpired"
+)
+
+// Reason code of the last failed rollout, sent along with the failure report
+var lastFailureReason string
+
+// judgementReason tells why a batch failed its judgement: its success criteria, or the readiness of the resources when there are none
+func judgementReason(criteria *successCriteria) string {
+	if criteria == nil {
+		return readinessTimeoutReason
+	}
+	return criteriaNotMetReason
+}
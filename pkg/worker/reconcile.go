@@ -0,0 +1,110 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"rooster/pkg/config"
+	"rooster/pkg/utils"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ReconcileNodes extends the deployed version to the target nodes that joined the cluster since, batch after batch.
+// With an interval, new nodes are looked for until the process is stopped
+func ReconcileNodes(kubernetesClient *utils.K8sClient, logger *zap.Logger, options config.RoosterOptions, interval time.Duration) bool {
+	for {
+		if done := reconcileNodes(kubernetesClient, logger, options); !done || interval == 0 {
+			return done
+		}
+		logger.Info("Next reconciliation in " + interval.String())
+		time.Sleep(interval)
+	}
+}
+
+func reconcileNodes(kubernetesClient *utils.K8sClient, logger *zap.Logger, options config.RoosterOptions) bool {
+	// Client settings
+	clients := Clients{}
+	clients.K8sClient = *kubernetesClient
+	targetResources, err := ReadManifestFiles(logger, options.ManifestPath, options.Namespace)
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	canary, profile, err := resolveRampProfile(options)
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	canaryLabelKey := strings.Split(options.CanaryLabel, "=")[0]
+	labeledNodes := clients.ensureCanaryLabelPropagation(logger, canaryLabelKey, options.CanaryLabel)
+	if len(labeledNodes) == 0 {
+		logger.Info("No node carries the canary label " + options.CanaryLabel + ". Nothing to extend")
+		return true
+	}
+	customOptions := meta_v1.ListOptions{}
+	customOptions.LabelSelector = options.TargetLabel
+	targetNodes := clients.getTargetNodes(logger, options.TargetLabel, customOptions)
+	targetNodes.Items, _ = skipNodesUnderMaintenance(logger, targetNodes.Items)
+	newNodes := []core_v1.Node{}
+	for _, node := range targetNodes.Items {
+		if _, found := node.Labels[canaryLabelKey]; !found {
+			newNodes = append(newNodes, node)
+		}
+	}
+	if len(newNodes) == 0 {
+		logger.Info("All the target nodes carry the canary label")
+		return true
+	}
+	logger.Info(strconv.Itoa(len(newNodes)) + " target nodes do not carry the canary label")
+	conformance, err := loadNodeConformance(config.Env.NodeConformanceFile)
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	// The nodes labeled so far keep their label
+	patchedNodes := len(labeledNodes)
+	for _, batch := range planBatches(newNodes, canary, profile) {
+		batch, err = conformance.filterNodes(logger, batch)
+		if err != nil {
+			logger.Error(err.Error())
+			return false
+		}
+		if len(batch) == 0 {
+			continue
+		}
+		logger.Info("Extending the rollout to " + strconv.Itoa(len(batch)) + " nodes")
+		if patchComplete := clients.patchTargetNodes(logger, batch, options.CanaryLabel, float64(patchedNodes), options.DryRun); !patchComplete {
+			logger.Warn("Issues encountered while patching nodes. Aborting...")
+			return false
+		}
+		patchedNodes += len(batch)
+		if options.DryRun {
+			continue
+		}
+		if ready := clients.verifyResourcesStatus(logger, targetResources, batch); !ready {
+			return false
+		}
+	}
+	logger.Info("The rollout was extended to the new nodes")
+	return true
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Outcomes of the last attempt to roll a version out
+const (
+	inProgressOutcome = "in progress"
+	pausedOutcome     = "paused"
+	completedOutcome  = "completed"
+	failedOutcome     = "failed"
+	revertedOutcome   = "reverted"
+)
+
+// RolloutHistory holds the statistics of the versions rolled out, in the order they were first rolled out
+type RolloutHistory struct {
+	Versions []VersionStatistics `json:"versions" yaml:"versions"`
+	// Events recorded without a canary label, before it was recorded
+	Skipped int `json:"skipped,omitempty" yaml:"skipped,omitempty"`
+}
+
+// VersionStatistics sums up the rollouts of a version. Batches, failures & rollbacks are counted over all the attempts
+type VersionStatistics struct {
+	CanaryLabel string `json:"canaryLabel" yaml:"canaryLabel"`
+	Started     string `json:"started" yaml:"started"`
+	Completed   string `json:"completed,omitempty" yaml:"completed,omitempty"`
+	// From the first start to the completion, pauses included
+	Duration string `json:"duration,omitempty" yaml:"duration,omitempty"`
+	// Duration, compared with the previous version of the canary label key completed
+	DurationChange string `json:"durationChange,omitempty" yaml:"durationChange,omitempty"`
+	Attempts       int    `json:"attempts" yaml:"attempts"`
+	Batches        int    `json:"batches" yaml:"batches"`
+	Failures       int    `json:"failures" yaml:"failures"`
+	Rollbacks      int    `json:"rollbacks" yaml:"rollbacks"`
+	Outcome        string `json:"outcome" yaml:"outcome"`
+}
+
+// versionRollouts are the statistics of a version, as the events are read
+type versionRollouts struct {
+	VersionStatistics
+	started  time.Time
+	duration time.Duration
+	// The attempt in progress is a dry run: its events are left out
+	dryRun bool
+}
+
+// ReadRolloutHistory sums up the rollouts of the events file, per version. canaryLabel: key or key=value the versions are
+// filtered by. Dry runs are left out. No cluster is needed
+func ReadRolloutHistory(eventsFile string, canaryLabel string) (history RolloutHistory, err error) {
+	f, err := os.Open(eventsFile)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	versions := map[string]*versionRollouts{}
+	order := []string{}
+	decoder := json.NewDecoder(f)
+	for line := 1; ; line++ {
+		event := rolloutEvent{}
+		err = decoder.Decode(&event)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return history, errors.New(eventsFile + ": event " + strconv.Itoa(line) + ": " + err.Error())
+		}
+		if event.CanaryLabel == "" {
+			history.Skipped++
+			continue
+		}
+		if !matchesCanaryLabel(event.CanaryLabel, canaryLabel) {
+			continue
+		}
+		eventTime, err := time.Parse(time.RFC3339Nano, event.Time)
+		if err != nil {
+			return history, errors.New(eventsFile + ": event " + strconv.Itoa(line) + ": " + err.Error())
+		}
+		version, found := versions[event.CanaryLabel]
+		if !found {
+			version = &versionRollouts{VersionStatistics: VersionStatistics{CanaryLabel: event.CanaryLabel}}
+			versions[event.CanaryLabel] = version
+			order = append(order, event.CanaryLabel)
+		}
+		version.add(event, eventTime)
+	}
+	// Durations are compared with the previous version of the same key
+	previous := map[string]time.Duration{}
+	for _, canaryLabel := range order {
+		version := versions[canaryLabel]
+		if version.started.IsZero() {
+			// Dry runs only
+			continue
+		}
+		key, _, _ := strings.Cut(canaryLabel, "=")
+		if version.Completed != "" {
+			if previousDuration, found := previous[key]; found {
+				version.DurationChange = formatDurationChange(version.duration - previousDuration)
+			}
+			previous[key] = version.duration
+		}
+		history.Versions = append(history.Versions, version.VersionStatistics)
+	}
+	return history, nil
+}
+
+// add counts the event in the statistics of the version
+func (v *versionRollouts) add(event rolloutEvent, eventTime time.Time) {
+	switch event.Type {
+	case rolloutStartedEvent, promotionStartedEvent:
+		v.dryRun = event.DryRun
+		if v.dryRun {
+			return
+		}
+		if event.Type == rolloutStartedEvent {
+			v.Attempts++
+		}
+		if v.started.IsZero() {
+			v.started = eventTime
+			v.Started = eventTime.Format(time.RFC3339)
+		}
+		v.Outcome = inProgressOutcome
+		return
+	}
+	if v.dryRun || v.started.IsZero() {
+		return
+	}
+	switch event.Type {
+	case batchVerifiedEvent:
+		v.Batches++
+	case canaryCompletedEvent:
+		v.Outcome = pausedOutcome
+	case rolloutCompletedEvent:
+		v.Outcome = completedOutcome
+		v.Completed = eventTime.Format(time.RFC3339)
+		v.duration = eventTime.Sub(v.started).Round(time.Second)
+		v.Duration = v.duration.String()
+	case rolloutFailedEvent:
+		v.Failures++
+		v.Outcome = failedOutcome
+	case revertStartedEvent:
+		v.Rollbacks++
+	case revertCompletedEvent:
+		v.Outcome = revertedOutcome
+	}
+}
+
+// matchesCanaryLabel tells whether the canary label of the event is the one looked for: the same key=value, or the same key
+func matchesCanaryLabel(eventCanaryLabel string, canaryLabel string) bool {
+	if canaryLabel == "" || eventCanaryLabel == canaryLabel {
+		return true
+	}
+	key, _, _ := strings.Cut(eventCanaryLabel, "=")
+	return !strings.Contains(canaryLabel, "=") && key == canaryLabel
+}
+
+func formatDurationChange(change time.Duration) string {
+	if change < 0 {
+		return change.String()
+	}
+	return "+" + change.String()
+}
+
+// Marshal encodes the history as a table, in YAML or in JSON
+func (h RolloutHistory) Marshal(format string) ([]byte, error) {
+	switch format {
+	case "", "table":
+		buffer := &bytes.Buffer{}
+		writer := tabwriter.NewWriter(buffer, 0, 4, 2, ' ', 0)
+		writer.Write([]byte("VERSION\tSTARTED\tDURATION\tCHANGE\tATTEMPTS\tBATCHES\tFAILURES\tROLLBACKS\tOUTCOME\n"))
+		for _, version := range h.Versions {
+			writer.Write([]byte(version.CanaryLabel + "\t" + version.Started + "\t" + version.Duration + "\t" + version.DurationChange + "\t" +
+				strconv.Itoa(version.Attempts) + "\t" + strconv.Itoa(version.Batches) + "\t" + strconv.Itoa(version.Failures) + "\t" +
+				strconv.Itoa(version.Rollbacks) + "\t" + version.Outcome + "\n"))
+		}
+		err := writer.Flush()
+		return buffer.Bytes(), err
+	case "yaml":
+		return yaml.Marshal(h)
+	case "json":
+		return json.MarshalIndent(h, "", "  ")
+	}
+	return nil, errors.New("unknown output format: " + format + ". Expected table, yaml or json")
+}
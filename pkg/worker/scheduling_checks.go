@@ -0,0 +1,162 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+	apps_v1 "k8s.io/api/apps/v1"
+	core_v1 "k8s.io/api/core/v1"
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// unscheduledDaemonSet is a DaemonSet whose scheduling is not controlled by the canary label
+type unscheduledDaemonSet struct {
+	file string
+	name string
+}
+
+// checkCanaryScheduling lists the DaemonSets the canary label does not control. Labeling the nodes would not change where they run
+func checkCanaryScheduling(manifestPath string, canaryLabel string) (uncontrolled []unscheduledDaemonSet, err error) {
+	key, value, _ := strings.Cut(canaryLabel, "=")
+	files, err := listManifestFiles(manifestPath)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		daemonSets, err := readDaemonSets(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, daemonSet := range daemonSets {
+			if !isScheduledByLabel(daemonSet.Spec.Template.Spec, key, value) {
+				uncontrolled = append(uncontrolled, unscheduledDaemonSet{file: file, name: daemonSet.Name})
+			}
+		}
+	}
+	return
+}
+
+func readDaemonSets(file string) (daemonSets []apps_v1.DaemonSet, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	decoder := utilyaml.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		object := make(map[string]interface{})
+		err = decoder.Decode(&object)
+		if errors.Is(err, io.EOF) {
+			return daemonSets, nil
+		}
+		if err != nil {
+			return
+		}
+		if object["kind"] != "DaemonSet" {
+			continue
+		}
+		daemonSet := apps_v1.DaemonSet{}
+		if err = runtime.DefaultUnstructuredConverter.FromUnstructured(object, &daemonSet); err != nil {
+			return
+		}
+		daemonSets = append(daemonSets, daemonSet)
+	}
+}
+
+// isScheduledByLabel tells whether the pods can only run on the nodes carrying the label, through the node selector or the node affinity
+func isScheduledByLabel(podSpec core_v1.PodSpec, key string, value string) bool {
+	if selected, found := podSpec.NodeSelector[key]; found && selected == value {
+		return true
+	}
+	if podSpec.Affinity == nil || podSpec.Affinity.NodeAffinity == nil {
+		return false
+	}
+	required := podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if required == nil || len(required.NodeSelectorTerms) == 0 {
+		return false
+	}
+	// Terms are ORed. Each of them has to require the label
+	for _, term := range required.NodeSelectorTerms {
+		if !requiresLabel(term, key, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func requiresLabel(term core_v1.NodeSelectorTerm, key string, value string) bool {
+	for _, expression := range term.MatchExpressions {
+		if expression.Key != key {
+			continue
+		}
+		switch expression.Operator {
+		case core_v1.NodeSelectorOpExists:
+			return true
+		case core_v1.NodeSelectorOpIn:
+			return len(expression.Values) == 1 && expression.Values[0] == value
+		}
+	}
+	return false
+}
+
+// findUnmanagedPods lists the pods of the live DaemonSets running on nodes without the canary label. Format: namespace/pod on node
+func (c Clients) findUnmanagedPods(logger *zap.Logger, targetResources map[string]string, canaryLabel string) (unmanagedPods []string, err error) {
+	// No node carries the canary label before the first rollout
+	nodes, err := c.K8sClient.GetClient().CoreV1().Nodes().List(context.TODO(), meta_v1.ListOptions{LabelSelector: canaryLabel})
+	if err != nil {
+		return
+	}
+	canaryLabeledNodes := make(map[string]bool)
+	for _, node := range nodes.Items {
+		canaryLabeledNodes[node.Name] = true
+	}
+	for kindName, namespace := range targetResources {
+		if getAttribute(kindName, 0) != "DaemonSet" {
+			continue
+		}
+		logger.Info("Looking for unmanaged pods of DaemonSet " + getAttribute(kindName, 1))
+		daemonSet, err := c.getResource("DaemonSet", getAttribute(kindName, 1), namespace)
+		if k8s_errors.IsNotFound(err) {
+			// Not deployed yet
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		pods, err := c.daemonSetPods(*daemonSet, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range pods {
+			if pod.Spec.NodeName != "" && !canaryLabeledNodes[pod.Spec.NodeName] {
+				unmanagedPods = append(unmanagedPods, pod.Namespace+"/"+pod.Name+" on "+pod.Spec.NodeName)
+			}
+		}
+	}
+	sort.Strings(unmanagedPods)
+	return
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// secretProvider resolves a secret reference into its value
+type secretProvider interface {
+	resolve(reference string) (string, error)
+}
+
+// env:VARIABLE
+type envSecretProvider struct{}
+
+// file:/path/to/file
+type fileSecretProvider struct{}
+
+// k8s:namespace/secret-name/key
+type kubernetesSecretProvider struct {
+	clients Clients
+}
+
+// vault:secret/data/path#field. Reads VAULT_ADDR and VAULT_TOKEN
+type vaultSecretProvider struct{}
+
+func (c Clients) secretProviders() map[string]secretProvider {
+	return map[string]secretProvider{
+		"env":   envSecretProvider{},
+		"file":  fileSecretProvider{},
+		"k8s":   kubernetesSecretProvider{clients: c},
+		"vault": vaultSecretProvider{},
+	}
+}
+
+// resolveSecrets turns NAME=provider:reference definitions into NAME=value environment variables
+func (c Clients) resolveSecrets(secrets []string) (env []string, err error) {
+	providers := c.secretProviders()
+	for _, secret := range secrets {
+		name, source, found := strings.Cut(secret, "=")
+		if !found || name == "" {
+			return nil, errors.New("invalid secret " + name + ". Expected format: NAME=provider:reference")
+		}
+		providerName, reference, found := strings.Cut(source, ":")
+		provider, known := providers[providerName]
+		if !found || !known {
+			return nil, errors.New("invalid secret source for " + name + ". Expected one of env:, file:, k8s:, vault:")
+		}
+		value, err := provider.resolve(reference)
+		if err != nil {
+			return nil, errors.New("could not resolve secret " + name + ": " + err.Error())
+		}
+		env = append(env, name+"="+value)
+	}
+	return
+}
+
+func (envSecretProvider) resolve(reference string) (string, error) {
+	value, found := os.LookupEnv(reference)
+	if !found {
+		return "", errors.New("environment variable " + reference + " is not set")
+	}
+	return value, nil
+}
+
+func (fileSecretProvider) resolve(reference string) (string, error) {
+	content, err := os.ReadFile(reference)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(content), "\n"), nil
+}
+
+func (p kubernetesSecretProvider) resolve(reference string) (string, error) {
+	elements := strings.Split(reference, "/")
+	if len(elements) != 3 {
+		return "", errors.New("expected format: namespace/secret-name/key")
+	}
+	secret, err := p.clients.K8sClient.GetClient().CoreV1().Secrets(elements[0]).Get(context.TODO(), elements[1], meta_v1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	value, found := secret.Data[elements[2]]
+	if !found {
+		return "", errors.New("key " + elements[2] + " not found in secret " + elements[1])
+	}
+	return string(value), nil
+}
+
+func (vaultSecretProvider) resolve(reference string) (string, error) {
+	path, field, found := strings.Cut(reference, "#")
+	if !found {
+		return "", errors.New("expected format: path#field")
+	}
+	address := os.Getenv("VAULT_ADDR")
+	if address == "" {
+		return "", errors.New("VAULT_ADDR is not set")
+	}
+	request, err := http.NewRequest(http.MethodGet, strings.TrimRight(address, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", errors.New("vault responded with " + response.Status)
+	}
+	body := struct {
+		Data map[string]interface{} `json:"data"`
+	}{}
+	if err = json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	data := body.Data
+	// KV version 2 nests the secret under data.data
+	if nested, isKV2 := data["data"].(map[string]interface{}); isKV2 {
+		data = nested
+	}
+	value, found := data[field].(string)
+	if !found {
+		return "", errors.New("field " + field + " not found at " + path)
+	}
+	return value, nil
+}
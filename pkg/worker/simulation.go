@@ -0,0 +1,62 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"errors"
+	"fmt"
+
+	"rooster/pkg/config"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+const (
+	zoneLabel = "topology.kubernetes.io/zone"
+)
+
+// SimulateBatches plans the batches of a rollout over a synthetic node inventory. No cluster is needed
+func SimulateBatches(nodeCount int, zones int, options config.RoosterOptions) (batches [][]core_v1.Node, err error) {
+	if nodeCount <= 0 || zones <= 0 {
+		err = errors.New("the number of nodes and zones must be positive")
+		return
+	}
+	canary, profile, err := resolveRampProfile(options)
+	if err != nil {
+		return
+	}
+	nodes := make([]core_v1.Node, nodeCount)
+	for i := range nodes {
+		nodes[i].Name = fmt.Sprintf("node-%03d", i+1)
+		// Spread the nodes across the zones, round-robin
+		nodes[i].Labels = map[string]string{zoneLabel: fmt.Sprintf("zone-%d", i%zones+1)}
+	}
+	batches = planBatches(nodes, canary, profile)
+	return
+}
+
+// SimulateRollout prints the batch plan computed over a synthetic node inventory
+func SimulateRollout(logger *zap.Logger, nodeCount int, zones int, options config.RoosterOptions) bool {
+	batches, err := SimulateBatches(nodeCount, zones, options)
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	printBatches(batches, nodeCount)
+	return true
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"rooster/pkg/config"
+	"rooster/pkg/utils"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// Directory of the snapshots, under the backup directory. The backups of the rollout are not overwritten
+	snapshotsDirectory = "snapshots"
+	// Description of the destructive operation, next to the resources of the snapshot
+	snapshotRecordFile = "operation.json"
+	revertOperation    = "revert"
+	deletionOperation  = "project deletion"
+)
+
+// snapshotRecord describes the state a destructive operation was applied to
+type snapshotRecord struct {
+	Operation   string   `json:"operation"`
+	TakenAt     string   `json:"takenAt"`
+	Initiator   string   `json:"initiator"`
+	CanaryLabel string   `json:"canaryLabel"`
+	CanaryNodes []string `json:"canaryNodes"`
+	UndoneAt    string   `json:"undoneAt,omitempty"`
+}
+
+// snapshotResources saves the live resources & the canary labels before a destructive operation, so that it can be undone.
+// The snapshot is written in a directory of its own, whose path is returned
+func snapshotResources(logger *zap.Logger, operation string, targetResources map[string]string, redactSecrets bool, canaryLabel string, canaryNodes []core_v1.Node) (snapshotDir string, err error) {
+	if config.Env.BackupDirectory == "" {
+		return "", errors.New("no backup directory is set. The snapshot cannot be taken")
+	}
+	pruneSnapshots(logger)
+	takenAt := time.Now().UTC()
+	snapshotDir = filepath.Join(config.Env.BackupDirectory, snapshotsDirectory, takenAt.Format("20060102T150405Z"))
+	logger.Info("Taking a snapshot of the live resources")
+	if completed := backupResourcesTo(logger, snapshotDir, targetResources, redactSecrets, true); !completed {
+		return "", errors.New("the snapshot of the live resources failed. Use --no-backup to proceed without it")
+	}
+	record := snapshotRecord{Operation: operation, TakenAt: takenAt.Format(time.RFC3339), Initiator: determineInitiator(), CanaryLabel: canaryLabel}
+	for _, node := range canaryNodes {
+		record.CanaryNodes = append(record.CanaryNodes, node.Name)
+	}
+	if err = writeSnapshotRecord(snapshotDir, record); err != nil {
+		return "", err
+	}
+	logger.Info("Snapshot written to " + snapshotDir + ". Undo the " + operation + " with: rooster undo")
+	return
+}
+
+// pruneSnapshots deletes the snapshots that can no longer be undone
+func pruneSnapshots(logger *zap.Logger) {
+	snapshots, err := os.ReadDir(filepath.Join(config.Env.BackupDirectory, snapshotsDirectory))
+	if err != nil {
+		return
+	}
+	for _, snapshot := range snapshots {
+		takenAt, err := time.Parse("20060102T150405Z", snapshot.Name())
+		if err != nil || time.Since(takenAt) <= config.Env.SnapshotRetention {
+			continue
+		}
+		if err = os.RemoveAll(filepath.Join(config.Env.BackupDirectory, snapshotsDirectory, snapshot.Name())); err != nil {
+			logger.Warn("Could not delete the expired snapshot " + snapshot.Name() + ": " + err.Error())
+		}
+	}
+}
+
+func writeSnapshotRecord(snapshotDir string, record snapshotRecord) error {
+	content, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(snapshotDir, snapshotRecordFile), content, 0644)
+}
+
+// lastSnapshot finds the snapshot of the last destructive operation
+func lastSnapshot() (snapshotDir string, record snapshotRecord, err error) {
+	directory := filepath.Join(config.Env.BackupDirectory, snapshotsDirectory)
+	snapshots, err := os.ReadDir(directory)
+	if errors.Is(err, os.ErrNotExist) || len(snapshots) == 0 {
+		return "", record, errors.New("no destructive operation was recorded in " + directory)
+	}
+	if err != nil {
+		return
+	}
+	// Named after the time they were taken
+	names := []string{}
+	for _, snapshot := range snapshots {
+		if snapshot.IsDir() {
+			names = append(names, snapshot.Name())
+		}
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return "", record, errors.New("no destructive operation was recorded in " + directory)
+	}
+	snapshotDir = filepath.Join(directory, names[len(names)-1])
+	content, err := os.ReadFile(filepath.Join(snapshotDir, snapshotRecordFile))
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(content, &record)
+	return
+}
+
+// UndoLastOperation restores the resources & the canary labels saved before the last destructive operation
+func UndoLastOperation(kubernetesClient *utils.K8sClient, logger *zap.Logger, dryRun bool) bool {
+	// Client settings
+	clients := Clients{}
+	clients.K8sClient = *kubernetesClient
+	snapshotDir, record, err := lastSnapshot()
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	if record.UndoneAt != "" {
+		logger.Warn("The last " + record.Operation + ", from " + record.TakenAt + ", was undone already at " + record.UndoneAt)
+		return false
+	}
+	takenAt, err := time.Parse(time.RFC3339, record.TakenAt)
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	if age := time.Since(takenAt); age > config.Env.SnapshotRetention {
+		logger.Error("The last " + record.Operation + " is " + age.Round(time.Minute).String() + " old. Operations older than " + config.Env.SnapshotRetention.String() + " cannot be undone")
+		return false
+	}
+	logger.Info("Undoing the " + record.Operation + " of " + record.TakenAt + ", initiated by " + record.Initiator)
+	files, err := listManifestFiles(snapshotDir)
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	applyCommand := "apply"
+	if dryRun {
+		applyCommand += " --dry-run=server"
+	}
+	restoredResources := make(map[string]string)
+	for _, file := range files {
+		if isRedactedBackup(file) {
+			logger.Warn("Skipping " + file + ". Its secret data was redacted, it has to be restored manually")
+			continue
+		}
+		// Strip the server-populated fields, so the snapshot can be re-applied over the live object
+		restoreFile, namespace, err := sanitizeBackupFile(file)
+		if err != nil {
+			logger.Error(err.Error())
+			return false
+		}
+		cmd, err := utils.Kubectl(namespace, applyCommand, restoreFile)
+		os.Remove(restoreFile)
+		if err != nil {
+			logger.Error(cmd)
+			return false
+		}
+		kind, name := resourceOfBackupFile(file)
+		restoredResources[kind+","+name] = namespace
+		logger.Info("Restored " + kind + " " + name)
+	}
+	if err = clients.importCanaryLabels(logger, InventoryNodes{CanaryLabel: record.CanaryLabel, Canary: record.CanaryNodes}, dryRun); err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	if dryRun {
+		logger.Info("As dry as it gets")
+		return true
+	}
+	if ready := clients.verifyResourcesStatus(logger, restoredResources, nil); !ready {
+		return false
+	}
+	record.UndoneAt = time.Now().UTC().Format(time.RFC3339)
+	if err = writeSnapshotRecord(snapshotDir, record); err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	logger.Info("The " + record.Operation + " was undone")
+	return true
+}
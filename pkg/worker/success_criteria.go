@@ -0,0 +1,164 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/google/cel-go/cel"
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+// BatchSignals are the observations a batch is judged on
+type BatchSignals struct {
+	// Every resource is ready
+	Ready bool
+	// Share of the patched nodes running a ready pod, for each DaemonSet
+	ReadyRatio float64
+	// Container restarts of the DaemonSet pods running on the patched nodes
+	Restarts    int64
+	TestsRun    bool
+	TestsPassed bool
+}
+
+// successCriteria is a CEL expression over the batch signals. E.g: tests.passed && restarts == 0 && ready_ratio >= 0.98
+type successCriteria struct {
+	expression string
+	program    cel.Program
+}
+
+func compileSuccessCriteria(expression string) (criteria *successCriteria, err error) {
+	if expression == "" {
+		return
+	}
+	env, err := cel.NewEnv(
+		cel.Variable("ready", cel.BoolType),
+		cel.Variable("ready_ratio", cel.DoubleType),
+		cel.Variable("restarts", cel.IntType),
+		cel.Variable("tests", cel.MapType(cel.StringType, cel.BoolType)),
+	)
+	if err != nil {
+		return
+	}
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, errors.New("invalid success criteria: " + issues.Err().Error())
+	}
+	if ast.OutputType() != cel.BoolType {
+		return nil, errors.New("invalid success criteria: " + expression + " does not evaluate to a boolean")
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		return
+	}
+	return &successCriteria{expression: expression, program: program}, nil
+}
+
+func (s *successCriteria) evaluate(signals BatchSignals) (met bool, err error) {
+	result, _, err := s.program.Eval(map[string]interface{}{
+		"ready":       signals.Ready,
+		"ready_ratio": signals.ReadyRatio,
+		"restarts":    signals.Restarts,
+		"tests":       map[string]bool{"run": signals.TestsRun, "passed": signals.TestsPassed},
+	})
+	if err != nil {
+		return
+	}
+	met, _ = result.Value().(bool)
+	return
+}
+
+// EvaluateSuccessCriteria tells whether the signals of a batch meet the success criteria. Without criteria, the batch has to be ready.
+// No cluster is needed
+func EvaluateSuccessCriteria(expression string, signals BatchSignals) (met bool, err error) {
+	criteria, err := compileSuccessCriteria(expression)
+	if err != nil {
+		return
+	}
+	if criteria == nil {
+		return signals.Ready, nil
+	}
+	return criteria.evaluate(signals)
+}
+
+// judgeBatch applies the success criteria when defined. Otherwise, every resource must be ready
+func (c Clients) judgeBatch(logger *zap.Logger, criteria *successCriteria, targetResources map[string]string, nodes []core_v1.Node, testsRun bool, testsPassed bool) bool {
+	if criteria == nil {
+		return c.verifyResourcesStatus(logger, targetResources, nodes)
+	}
+	signals := c.collectBatchSignals(logger, targetResources, nodes)
+	signals.TestsRun = testsRun
+	signals.TestsPassed = testsPassed
+	logger.Info("Batch signals: ready=" + strconv.FormatBool(signals.Ready) +
+		" ready_ratio=" + strconv.FormatFloat(signals.ReadyRatio, 'f', 2, 64) +
+		" restarts=" + strconv.FormatInt(signals.Restarts, 10) +
+		" tests.run=" + strconv.FormatBool(testsRun) + " tests.passed=" + strconv.FormatBool(testsPassed))
+	met, err := criteria.evaluate(signals)
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	if !met {
+		logger.Warn("Success criteria not met: " + criteria.expression)
+	}
+	return met
+}
+
+func (c Clients) collectBatchSignals(logger *zap.Logger, targetResources map[string]string, nodes []core_v1.Node) (signals BatchSignals) {
+	statusReport := c.areResourcesReady(logger, targetResources, nodes)
+	signals.Ready = statusReport != nil
+	for _, ready := range statusReport {
+		signals.Ready = signals.Ready && ready
+	}
+	expectedPods, readyPods := 0, 0
+	for kindName, namespace := range targetResources {
+		if getAttribute(kindName, 0) != "DaemonSet" {
+			continue
+		}
+		daemonSet, err := c.getResource("DaemonSet", getAttribute(kindName, 1), namespace)
+		if err != nil {
+			logger.Warn(err.Error())
+			continue
+		}
+		for _, node := range nodes {
+			expectedPods++
+			pods, err := c.daemonSetPodsOnNode(*daemonSet, node)
+			if err != nil {
+				logger.Warn(err.Error())
+				continue
+			}
+			if hasReadyPod(pods) {
+				readyPods++
+			}
+			for _, pod := range pods {
+				for _, containerStatus := range pod.Status.ContainerStatuses {
+					signals.Restarts += int64(containerStatus.RestartCount)
+				}
+			}
+		}
+	}
+	signals.ReadyRatio = 0
+	if expectedPods == 0 && signals.Ready {
+		signals.ReadyRatio = 1
+	}
+	if expectedPods > 0 {
+		signals.ReadyRatio = float64(readyPods) / float64(expectedPods)
+	}
+	return
+}
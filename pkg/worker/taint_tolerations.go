@@ -0,0 +1,93 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	core_v1 "k8s.io/api/core/v1"
+)
+
+// Taints the DaemonSet controller tolerates on behalf of every DaemonSet
+var daemonSetTolerated = map[string]bool{
+	"node.kubernetes.io/not-ready":           true,
+	"node.kubernetes.io/unreachable":         true,
+	"node.kubernetes.io/disk-pressure":       true,
+	"node.kubernetes.io/memory-pressure":     true,
+	"node.kubernetes.io/pid-pressure":        true,
+	"node.kubernetes.io/unschedulable":       true,
+	"node.kubernetes.io/network-unavailable": true,
+}
+
+// findUntoleratedTaints lists the taints of the target nodes the DaemonSets of the manifests do not tolerate.
+// Their pods would never be scheduled on these nodes, and the rollout would time out waiting for them.
+// Format: DaemonSet <name> (<file>) does not tolerate <taint>, carried by <nodes>
+func findUntoleratedTaints(manifestPath string, nodes []core_v1.Node) (untolerated []string, err error) {
+	files, err := listManifestFiles(manifestPath)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		daemonSets, err := readDaemonSets(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, daemonSet := range daemonSets {
+			for taint, taintedNodes := range untoleratedTaints(daemonSet.Spec.Template.Spec.Tolerations, nodes) {
+				untolerated = append(untolerated, "DaemonSet "+daemonSet.Name+" ("+file+") does not tolerate "+taint+", carried by "+describeNodes(taintedNodes))
+			}
+		}
+	}
+	sort.Strings(untolerated)
+	return
+}
+
+// untoleratedTaints maps the scheduling taints the tolerations do not cover to the nodes carrying them
+func untoleratedTaints(tolerations []core_v1.Toleration, nodes []core_v1.Node) map[string][]string {
+	taints := make(map[string][]string)
+	for _, node := range nodes {
+		for i := range node.Spec.Taints {
+			taint := &node.Spec.Taints[i]
+			// PreferNoSchedule taints do not keep the pods away
+			if taint.Effect == core_v1.TaintEffectPreferNoSchedule || daemonSetTolerated[taint.Key] || tolerates(tolerations, taint) {
+				continue
+			}
+			taints[taint.ToString()] = append(taints[taint.ToString()], node.Name)
+		}
+	}
+	return taints
+}
+
+func tolerates(tolerations []core_v1.Toleration, taint *core_v1.Taint) bool {
+	for i := range tolerations {
+		if tolerations[i].ToleratesTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeNodes names the first nodes of the list, and counts the others
+func describeNodes(nodes []string) string {
+	const shown = 3
+	if len(nodes) <= shown {
+		return strings.Join(nodes, ", ")
+	}
+	return strings.Join(nodes[:shown], ", ") + " and " + strconv.Itoa(len(nodes)-shown) + " other nodes"
+}
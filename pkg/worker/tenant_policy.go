@@ -0,0 +1,161 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"strings"
+
+	"rooster/pkg/config"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+	core_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// tenantPolicy restricts the identities of the tenants to their namespaces & nodes. Identities of no tenant are not restricted
+type tenantPolicy struct {
+	Tenants []tenantScope `yaml:"tenants"`
+}
+
+// tenantScope lists the initiators of a team, and what their rollouts may touch. Patterns may end with *
+type tenantScope struct {
+	Name       string   `yaml:"name"`
+	Identities []string `yaml:"identities"`
+	Namespaces []string `yaml:"namespaces"`
+	// Label selectors. The target nodes must match one of them. None: the nodes are not restricted
+	NodeSelectors []string `yaml:"nodeSelectors"`
+}
+
+func loadTenantPolicy(policyFile string) (policy *tenantPolicy, err error) {
+	if policyFile == "" {
+		return
+	}
+	content, err := os.ReadFile(policyFile)
+	if err != nil {
+		return
+	}
+	policy = &tenantPolicy{}
+	if err = yaml.Unmarshal(content, policy); err != nil {
+		return nil, errors.New(policyFile + ": " + err.Error())
+	}
+	for _, t := range policy.Tenants {
+		if t.Name == "" || len(t.Identities) == 0 || len(t.Namespaces) == 0 {
+			return nil, errors.New(policyFile + ": every tenant needs a name, identities and namespaces")
+		}
+		for _, nodeSelector := range t.NodeSelectors {
+			if _, err = labels.Parse(nodeSelector); err != nil {
+				return nil, errors.New(policyFile + ": tenant " + t.Name + ": " + err.Error())
+			}
+		}
+	}
+	return
+}
+
+// tenantOf returns the tenant of the identity. nil: the identity is not restricted
+func (p *tenantPolicy) tenantOf(identity string) *tenantScope {
+	if p == nil {
+		return nil
+	}
+	for i, t := range p.Tenants {
+		for _, pattern := range t.Identities {
+			if matchesPattern(identity, pattern) {
+				return &p.Tenants[i]
+			}
+		}
+	}
+	return nil
+}
+
+// checkResources makes sure the resources of the manifests belong to the namespaces of the tenant. Cluster-scoped resources are refused
+func (t *tenantScope) checkResources(targetResources map[string]string) error {
+	var violations []string
+	for kindName, namespace := range targetResources {
+		resource := getAttribute(kindName, 0) + " " + getAttribute(kindName, 1)
+		if namespace == "" {
+			violations = append(violations, resource+" (no namespace)")
+			continue
+		}
+		if !t.allowsNamespace(namespace) {
+			violations = append(violations, resource+" (namespace "+namespace+")")
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	sort.Strings(violations)
+	return errors.New("tenant " + t.Name + " may not deploy " + strings.Join(violations, ", ") + ". Allowed namespaces: " + strings.Join(t.Namespaces, ", "))
+}
+
+func (t *tenantScope) allowsNamespace(namespace string) bool {
+	for _, pattern := range t.Namespaces {
+		if matchesPattern(namespace, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNodes makes sure the target nodes match one of the node selectors of the tenant
+func (t *tenantScope) checkNodes(nodes []core_v1.Node) error {
+	if len(t.NodeSelectors) == 0 {
+		return nil
+	}
+	var violations []string
+	for _, node := range nodes {
+		allowed := false
+		for _, nodeSelector := range t.NodeSelectors {
+			// Parsed when the policy is loaded
+			selector, _ := labels.Parse(nodeSelector)
+			if selector.Matches(labels.Set(node.Labels)) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			violations = append(violations, node.Name)
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return errors.New("tenant " + t.Name + " may not patch the nodes " + strings.Join(violations, ", ") + ". Allowed node selectors: " + strings.Join(t.NodeSelectors, " or "))
+}
+
+// checkTenantPolicy loads the tenant policy, and returns the tenant the initiator belongs to. nil: the initiator is not restricted
+func checkTenantPolicy(logger *zap.Logger, initiator string) (*tenantScope, error) {
+	policy, err := loadTenantPolicy(config.Env.TenantPolicyFile)
+	if err != nil {
+		return nil, err
+	}
+	t := policy.tenantOf(initiator)
+	if t != nil {
+		logger.Info(initiator + " belongs to tenant " + t.Name + ". The rollout is restricted to its namespaces & nodes")
+	}
+	return t, nil
+}
+
+// matchesPattern compares the value with the pattern. A pattern ending with * matches the values starting with the rest of it
+func matchesPattern(value string, pattern string) bool {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(value, strings.TrimSuffix(pattern, "*"))
+	}
+	return value == pattern
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"rooster/pkg/config"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Annotation of the static pods, mirrored by the kubelet
+const mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+// tenant is a namespace whose workloads run on the nodes of a batch, and may be disrupted by the rollout
+type tenant struct {
+	Namespace string   `json:"namespace"`
+	Pods      []string `json:"pods"`
+	Contacts  []string `json:"contacts,omitempty"`
+}
+
+// tenantNotification is the payload posted to the tenant webhook, before a batch is patched
+type tenantNotification struct {
+	Batch     int      `json:"batch"`
+	Initiator string   `json:"initiator"`
+	Namespace string   `json:"namespace"`
+	Contacts  []string `json:"contacts"`
+	Pods      []string `json:"pods"`
+	Nodes     []string `json:"nodes"`
+}
+
+// listTenants lists the namespaces running pods on the nodes, DaemonSets and static pods aside. Format of the pods: pod on node
+func (c Clients) listTenants(nodes []core_v1.Node) (tenants []tenant, err error) {
+	pods := make(map[string][]string)
+	for _, node := range nodes {
+		nodePods, err := c.workloadPods(node)
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range nodePods {
+			pods[pod.Namespace] = append(pods[pod.Namespace], pod.Name+" on "+node.Name)
+		}
+	}
+	for namespace, namespacePods := range pods {
+		sort.Strings(namespacePods)
+		tenants = append(tenants, tenant{Namespace: namespace, Pods: namespacePods})
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].Namespace < tenants[j].Namespace })
+	return
+}
+
+// workloadPods lists the running pods of the node that are not managed by a DaemonSet, nor static
+func (c Clients) workloadPods(node core_v1.Node) (pods []core_v1.Pod, err error) {
+	podList, err := c.K8sClient.GetClient().CoreV1().Pods("").List(context.TODO(), meta_v1.ListOptions{FieldSelector: "spec.nodeName=" + node.Name})
+	if err != nil {
+		return
+	}
+	for _, pod := range podList.Items {
+		if pod.Status.Phase == core_v1.PodSucceeded || pod.Status.Phase == core_v1.PodFailed {
+			continue
+		}
+		if isDaemonSetPod(pod) || pod.Annotations[mirrorPodAnnotation] != "" {
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	return
+}
+
+func isDaemonSetPod(pod core_v1.Pod) bool {
+	for _, owner := range pod.OwnerReferences {
+		if owner.Kind == "DaemonSet" {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveTenantContacts reads the contacts of the tenants from the annotation of their namespace. Format: comma-separated
+func (c Clients) resolveTenantContacts(logger *zap.Logger, tenants []tenant) {
+	for i := range tenants {
+		namespace, err := c.K8sClient.GetClient().CoreV1().Namespaces().Get(context.TODO(), tenants[i].Namespace, meta_v1.GetOptions{})
+		if err != nil {
+			logger.Warn("Could not read the contacts of namespace " + tenants[i].Namespace + ": " + err.Error())
+			continue
+		}
+		for _, contact := range strings.Split(namespace.Annotations[config.Env.TenantContactAnnotation], ",") {
+			if contact = strings.TrimSpace(contact); contact != "" {
+				tenants[i].Contacts = append(tenants[i].Contacts, contact)
+			}
+		}
+	}
+}
+
+func printTenants(tenants []tenant) {
+	for _, t := range tenants {
+		line := "    - " + t.Namespace + ": " + strconv.Itoa(len(t.Pods)) + " pods"
+		if len(t.Contacts) > 0 {
+			line += " (contacts: " + strings.Join(t.Contacts, ", ") + ")"
+		}
+		fmt.Println(line)
+	}
+}
+
+// notifyTenants warns the owners of the namespaces running on the batch nodes, before the batch is patched. Failures are logged, not fatal
+func (c Clients) notifyTenants(logger *zap.Logger, batch int, nodes []core_v1.Node, initiator string) {
+	if len(nodes) == 0 {
+		return
+	}
+	tenants, err := c.listTenants(nodes)
+	if err != nil {
+		logger.Warn("Could not list the tenants of batch " + strconv.Itoa(batch) + ": " + err.Error())
+		return
+	}
+	c.resolveTenantContacts(logger, tenants)
+	nodeNames := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		nodeNames = append(nodeNames, node.Name)
+	}
+	for _, t := range tenants {
+		if len(t.Contacts) == 0 {
+			logger.Info("No contact found for namespace " + t.Namespace + ". Set the " + config.Env.TenantContactAnnotation + " annotation to have its owners notified")
+			continue
+		}
+		payload, err := json.Marshal(tenantNotification{Batch: batch, Initiator: initiator, Namespace: t.Namespace, Contacts: t.Contacts, Pods: t.Pods, Nodes: nodeNames})
+		if err != nil {
+			logger.Warn(err.Error())
+			continue
+		}
+		if err = postWebhook(config.Env.TenantWebhookUrl, config.Env.TenantWebhookToken, payload); err != nil {
+			logger.Warn("Could not notify the owners of namespace " + t.Namespace + ": " + err.Error())
+			continue
+		}
+		logger.Info("Owners of namespace " + t.Namespace + " notified: " + strings.Join(t.Contacts, ", "))
+	}
+}
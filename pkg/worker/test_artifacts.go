@@ -0,0 +1,176 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"rooster/pkg/config"
+
+	"go.uber.org/zap"
+)
+
+// isRemoteTestBinary tells whether the test binary is to be downloaded: http(s)://, s3:// or oci:// reference
+func isRemoteTestBinary(testBinary string) bool {
+	for _, scheme := range []string{"http://", "https://", "s3://", "oci://"} {
+		if strings.HasPrefix(testBinary, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchTestBinary downloads the test binary, and returns the path of the executable.
+// With a checksum, the binary is verified, and cached: the next runs do not download it again
+func fetchTestBinary(logger *zap.Logger, reference string, checksum string) (executable string, err error) {
+	cacheDirectory, err := os.UserCacheDir()
+	if err != nil {
+		cacheDirectory = os.TempDir()
+	}
+	cacheDirectory = filepath.Join(cacheDirectory, "rooster", "test-binaries")
+	if err = os.MkdirAll(cacheDirectory, 0700); err != nil {
+		return
+	}
+	checksum = strings.ToLower(strings.TrimPrefix(checksum, "sha256:"))
+	if checksum != "" {
+		executable = filepath.Join(cacheDirectory, checksum)
+		if sum, err := fileChecksum(executable); err == nil && sum == checksum {
+			logger.Info("Using the cached test binary " + executable)
+			return executable, nil
+		}
+	}
+	downloadDirectory, err := os.MkdirTemp(cacheDirectory, "download_*")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(downloadDirectory)
+	logger.Info("Downloading the test binary from " + reference)
+	downloaded, err := downloadTestBinary(reference, downloadDirectory)
+	if err != nil {
+		return "", errors.New("could not download the test binary " + reference + ": " + err.Error())
+	}
+	sum, err := fileChecksum(downloaded)
+	if err != nil {
+		return
+	}
+	if checksum != "" && sum != checksum {
+		return "", errors.New("the checksum of the test binary " + reference + " is " + sum + ", not " + checksum + ". It was not run")
+	}
+	name := checksum
+	if checksum == "" {
+		logger.Warn("The test binary is not pinned. Its sha256 is " + sum + ": set --test-binary-sha256 to verify it, and reuse it from the cache")
+		name = "unpinned_" + sum
+	}
+	executable = filepath.Join(cacheDirectory, name)
+	if err = os.Rename(downloaded, executable); err != nil {
+		return
+	}
+	err = os.Chmod(executable, 0700)
+	return
+}
+
+// downloadTestBinary fetches the binary in the directory. S3 & OCI artifacts are fetched with the aws & oras CLIs
+func downloadTestBinary(reference string, directory string) (file string, err error) {
+	file = filepath.Join(directory, "test-binary")
+	switch {
+	case strings.HasPrefix(reference, "s3://"):
+		output, err := exec.Command("aws", "s3", "cp", "--only-show-errors", reference, file).CombinedOutput()
+		if err != nil {
+			return "", errors.New(strings.TrimSpace(string(output)) + " " + err.Error())
+		}
+	case strings.HasPrefix(reference, "oci://"):
+		// The artifact is expected to hold the binary only
+		output, err := exec.Command("oras", "pull", strings.TrimPrefix(reference, "oci://"), "--output", directory).CombinedOutput()
+		if err != nil {
+			return "", errors.New(strings.TrimSpace(string(output)) + " " + err.Error())
+		}
+		entries, err := os.ReadDir(directory)
+		if err != nil {
+			return "", err
+		}
+		if len(entries) != 1 || entries[0].IsDir() {
+			return "", errors.New("the OCI artifact must hold a single file")
+		}
+		file = filepath.Join(directory, entries[0].Name())
+	default:
+		client := &http.Client{Timeout: 5 * time.Minute}
+		response, err := client.Get(reference)
+		if err != nil {
+			return "", err
+		}
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			return "", errors.New("the server answered " + response.Status)
+		}
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0700)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		if _, err = io.Copy(f, response.Body); err != nil {
+			return "", err
+		}
+	}
+	return
+}
+
+func fileChecksum(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// verifyTestBinary checks the test binary against its checksum, and its cosign signature, when they are set
+func verifyTestBinary(logger *zap.Logger, executable string, checksum string, signature string) error {
+	if checksum = strings.ToLower(strings.TrimPrefix(checksum, "sha256:")); checksum != "" {
+		sum, err := fileChecksum(executable)
+		if err != nil {
+			return err
+		}
+		if sum != checksum {
+			return errors.New("the checksum of the test binary " + executable + " is " + sum + ", not " + checksum + ". It was not run")
+		}
+	}
+	if signature == "" {
+		return nil
+	}
+	if config.Env.TestBinaryPublicKey == "" {
+		return errors.New("--test-binary-signature requires the TEST_BINARY_PUBLIC_KEY environment variable")
+	}
+	output, err := exec.Command("cosign", "verify-blob", "--key", config.Env.TestBinaryPublicKey, "--signature", signature, executable).CombinedOutput()
+	if err != nil {
+		return errors.New("the signature of the test binary " + executable + " could not be verified. It was not run: " + strings.TrimSpace(string(output)))
+	}
+	logger.Info("The signature of the test binary was verified")
+	return nil
+}
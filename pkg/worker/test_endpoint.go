@@ -18,13 +18,18 @@ package worker
 
 import (
 	"errors"
+	"io"
 	"os"
 	"os/exec"
+	"strings"
+
+	"rooster/pkg/config"
 
 	"go.uber.org/zap"
 )
 
-func runTests(logger *zap.Logger, testPackage string, testBinary string) (err error) {
+func runTests(logger *zap.Logger, options config.RoosterOptions, env []string) (err error) {
+	testPackage, testBinary := options.TestPackage, options.TestBinary
 	// If the test related options were not specified, skip tests
 	if testPackage == "" && testBinary == "" {
 		logger.Info("Skipping test phase. Only basic resource checks will be performed.")
@@ -39,7 +44,12 @@ func runTests(logger *zap.Logger, testPackage string, testBinary string) (err er
 		return
 	}
 	logger.Info("Running tests...")
-	testExecutable, err := exec.LookPath("y" + testBinary)
+	var testExecutable string
+	if isRemoteTestBinary(testBinary) {
+		testExecutable, err = fetchTestBinary(logger, testBinary, options.TestBinarySha256)
+	} else {
+		testExecutable, err = exec.LookPath("y" + testBinary)
+	}
 	if err != nil {
 		return
 	}
@@ -47,14 +57,62 @@ func runTests(logger *zap.Logger, testPackage string, testBinary string) (err er
 		err = errors.New("test binary not found")
 		return
 	}
+	// Nothing is run that was not vouched for
+	if err = verifyTestBinary(logger, testExecutable, options.TestBinarySha256, options.TestBinarySignature); err != nil {
+		return
+	}
+	testEnv, err := buildTestEnv(options.TestEnv, options.TestInheritEnv)
+	if err != nil {
+		return
+	}
+	if options.TestWorkdir != "" {
+		if info, statErr := os.Stat(options.TestWorkdir); statErr != nil || !info.IsDir() {
+			return errors.New("the test working directory " + options.TestWorkdir + " does not exist")
+		}
+	}
+	// The output is kept, as evidence of the validation
+	testLog, err := createTestLog(testPackage)
+	if err != nil {
+		return
+	}
+	defer testLog.Close()
+	lastTestLog = testLog.Name()
+	tail := &tailWriter{}
+	output := io.MultiWriter(os.Stdout, testLog, tail)
 	// exec command
 	cmd := &exec.Cmd{
 		Path:   testExecutable,
 		Args:   []string{testExecutable, "-test.v", "-test.run", testPackage},
-		Stdout: os.Stdout,
-		Stderr: os.Stdout,
+		Env:    append(testEnv, env...),
+		Dir:    options.TestWorkdir,
+		Stdout: output,
+		Stderr: output,
 	}
+	// Only the command is logged. The environment may carry secrets
 	logger.Info("Command: " + cmd.String())
-	err = cmd.Run()
+	logger.Info("Test log: " + testLog.Name())
+	if err = cmd.Run(); err != nil {
+		return errors.New("the tests failed: " + err.Error() + ". Log: " + testLog.Name() + "\n" + tail.tail())
+	}
+	return
+}
+
+// buildTestEnv makes the base environment of the tests: the environment of Rooster, or PATH & HOME only, and the explicit variables
+func buildTestEnv(variables []string, inherit bool) (env []string, err error) {
+	if inherit {
+		env = os.Environ()
+	} else {
+		for _, name := range []string{"PATH", "HOME"} {
+			if value, found := os.LookupEnv(name); found {
+				env = append(env, name+"="+value)
+			}
+		}
+	}
+	for _, variable := range variables {
+		if name, _, found := strings.Cut(variable, "="); !found || name == "" {
+			return nil, errors.New("invalid test environment variable \"" + variable + "\". Expected format: KEY=VALUE")
+		}
+		env = append(env, variable)
+	}
 	return
 }
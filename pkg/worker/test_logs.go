@@ -0,0 +1,86 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"rooster/pkg/config"
+)
+
+const (
+	// Directory of the test logs, under the backup directory
+	testLogsDirectory = "test-logs"
+	// Lines of the test output quoted in the errors & the failure reports
+	testTailLines = 20
+	// Bytes of output kept to extract the tail from
+	testTailBytes = 16 * 1024
+)
+
+// Log of the last test run, quoted in the failure report
+var lastTestLog string
+
+// tailWriter keeps the end of what is written to it
+type tailWriter struct {
+	content []byte
+}
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.content = append(w.content, p...)
+	if len(w.content) > testTailBytes {
+		w.content = w.content[len(w.content)-testTailBytes:]
+	}
+	return len(p), nil
+}
+
+// tail returns the last lines written
+func (w *tailWriter) tail() string {
+	return lastLines(string(w.content), testTailLines)
+}
+
+func lastLines(text string, count int) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if len(lines) > count {
+		lines = lines[len(lines)-count:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// createTestLog creates the log file of a test run, next to the backups
+func createTestLog(testPackage string) (*os.File, error) {
+	directory := filepath.Join(config.Env.BackupDirectory, testLogsDirectory)
+	if err := os.MkdirAll(directory, os.ModePerm); err != nil {
+		return nil, err
+	}
+	name := time.Now().UTC().Format("20060102T150405Z") + "_" + strings.NewReplacer("/", "_", " ", "_", "*", "_").Replace(testPackage) + ".log"
+	return os.Create(filepath.Join(directory, name))
+}
+
+// lastTestLogTail returns the path & the last lines of the log of the last test run. Empty when no test was run
+func lastTestLogTail() (path string, tail string) {
+	if lastTestLog == "" {
+		return
+	}
+	content, err := os.ReadFile(lastTestLog)
+	if err != nil {
+		return lastTestLog, ""
+	}
+	return lastTestLog, lastLines(string(content), testTailLines)
+}
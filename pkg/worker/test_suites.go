@@ -0,0 +1,169 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"errors"
+	"strings"
+
+	"rooster/pkg/config"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// A failed blocking suite fails the batch. A failed informational suite is only reported
+	blockingSuite      = "blocking"
+	informationalSuite = "informational"
+	// When the suite runs: after the canary batch, after every batch, or after the last batch
+	canaryStage = "canary"
+	batchStage  = "batch"
+	finalStage  = "final"
+)
+
+// testSuite is a set of tests of the test binary, selected by their package name
+type testSuite struct {
+	name        string
+	testPackage string
+	blocking    bool
+	stage       string
+}
+
+// runsAfter tells whether the suite runs after the given batch
+func (s testSuite) runsAfter(batch int, last bool) bool {
+	switch s.stage {
+	case canaryStage:
+		return batch == 0
+	case finalStage:
+		return last
+	}
+	return true
+}
+
+// parseTestSuites reads the test suites, in the order they run. Format: name=package[,policy[,stage]].
+// Without suites, the test package makes a blocking suite run after the canary batch
+func parseTestSuites(options config.RoosterOptions) (suites []testSuite, err error) {
+	if len(options.TestSuites) == 0 {
+		if options.TestPackage == "" && options.TestBinary == "" {
+			return nil, nil
+		}
+		return []testSuite{{name: "tests", testPackage: options.TestPackage, blocking: true, stage: canaryStage}}, nil
+	}
+	if options.TestPackage != "" {
+		return nil, errors.New("--test-package and --test-suite are mutually exclusive. Declare the package as a suite")
+	}
+	names := map[string]bool{}
+	for _, spec := range options.TestSuites {
+		name, definition, found := strings.Cut(spec, "=")
+		fields := strings.Split(definition, ",")
+		if !found || name == "" || fields[0] == "" || len(fields) > 3 {
+			return nil, errors.New("invalid test suite " + spec + ". Format: name=package[,policy[,stage]]")
+		}
+		if names[name] {
+			return nil, errors.New("test suite " + name + " is declared twice")
+		}
+		names[name] = true
+		suite := testSuite{name: name, testPackage: fields[0], blocking: true, stage: canaryStage}
+		if len(fields) > 1 {
+			switch fields[1] {
+			case blockingSuite:
+			case informationalSuite:
+				suite.blocking = false
+			default:
+				return nil, errors.New("invalid policy " + fields[1] + " of test suite " + name + ". Expected: " + blockingSuite + " or " + informationalSuite)
+			}
+		}
+		if len(fields) > 2 {
+			switch fields[2] {
+			case canaryStage, batchStage, finalStage:
+				suite.stage = fields[2]
+			default:
+				return nil, errors.New("invalid stage " + fields[2] + " of test suite " + name + ". Expected: " + canaryStage + ", " + batchStage + " or " + finalStage)
+			}
+		}
+		suites = append(suites, suite)
+	}
+	return
+}
+
+// PlanTestSuites returns the test suites due after the batch, in the order they run, as parsed from the options.
+// batch: 0 for the canary batch. last: the batch is the last one. No cluster is needed
+func PlanTestSuites(options config.RoosterOptions, batch int, last bool) (blocking []string, informational []string, err error) {
+	suites, err := parseTestSuites(options)
+	if err != nil {
+		return
+	}
+	for _, suite := range suites {
+		if !suite.runsAfter(batch, last) {
+			continue
+		}
+		if suite.blocking {
+			blocking = append(blocking, suite.name)
+		} else {
+			informational = append(informational, suite.name)
+		}
+	}
+	return
+}
+
+// testBatch runs the suites due after the batch, in order. The first failed blocking suite stops the run.
+// testsRun is false when no suite was due
+func (c Clients) testBatch(logger *zap.Logger, options config.RoosterOptions, suites []testSuite, batch int, nodes []core_v1.Node, last bool, events *eventRecorder) (testsRun bool, err error) {
+	due := []testSuite{}
+	for _, suite := range suites {
+		if suite.runsAfter(batch, last) {
+			due = append(due, suite)
+		}
+	}
+	if len(due) == 0 {
+		if batch == 0 {
+			logger.Info("Skipping test phase. Only basic resource checks will be performed.")
+		}
+		return false, nil
+	}
+	// Credentials are passed through the environment
+	testEnv, err := c.resolveSecrets(options.TestSecrets)
+	if err != nil {
+		return false, err
+	}
+	// The tests target the nodes just patched
+	target := testTarget(batch, nodes, options)
+	testEnv = append(testEnv, testTargetEnv(target)...)
+	if options.TestTargetConfigMap != "" {
+		if err = c.publishTestTarget(logger, options.TestTargetConfigMap, target, options.Namespace); err != nil {
+			return false, err
+		}
+	}
+	for _, suite := range due {
+		logger.Info("Running test suite " + suite.name)
+		suiteOptions := options
+		suiteOptions.TestPackage = suite.testPackage
+		suiteErr := runTests(logger, suiteOptions, testEnv)
+		passed := suiteErr == nil
+		events.record(rolloutEvent{Type: testsFinishedEvent, Batch: &batch, Passed: &passed, Message: suite.name})
+		if suiteErr == nil {
+			continue
+		}
+		if !suite.blocking {
+			logger.Warn("Informational test suite " + suite.name + " failed: " + suiteErr.Error())
+			continue
+		}
+		return true, errors.New("test suite " + suite.name + " failed: " + suiteErr.Error())
+	}
+	return true, nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"rooster/pkg/config"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testTarget describes what the tests are run against: the nodes of the batch just patched, and the rollout
+func testTarget(batch int, nodes []core_v1.Node, options config.RoosterOptions) map[string]string {
+	nodeNames := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		nodeNames = append(nodeNames, node.Name)
+	}
+	_, canaryLabelValue, _ := strings.Cut(options.CanaryLabel, "=")
+	return map[string]string{
+		"CANARY_BATCH":     strconv.Itoa(batch),
+		"CANARY_NODES":     strings.Join(nodeNames, ","),
+		"CANARY_NAMESPACE": options.Namespace,
+		"CANARY_PROJECT":   options.Project,
+		"CANARY_LABEL":     options.CanaryLabel,
+		// The value of the canary label usually is the version rolled out
+		"CANARY_VERSION": canaryLabelValue,
+	}
+}
+
+// testTargetEnv passes the test target to the test binary, as environment variables
+func testTargetEnv(target map[string]string) (env []string) {
+	for name, value := range target {
+		env = append(env, name+"="+value)
+	}
+	sort.Strings(env)
+	return
+}
+
+// publishTestTarget writes the test target to a ConfigMap, for the tests running in the cluster, e.g. as Jobs
+func (c Clients) publishTestTarget(logger *zap.Logger, name string, target map[string]string, namespace string) error {
+	if namespace == "" {
+		namespace = config.Env.ProjectNamespace
+	}
+	ctx := context.TODO()
+	configMaps := c.K8sClient.GetClient().CoreV1().ConfigMaps(namespace)
+	cm := &core_v1.ConfigMap{ObjectMeta: meta_v1.ObjectMeta{Name: name, Namespace: namespace}, Data: target}
+	_, err := configMaps.Update(ctx, cm, meta_v1.UpdateOptions{FieldManager: config.Env.FieldManager})
+	if k8s_errors.IsNotFound(err) {
+		_, err = configMaps.Create(ctx, cm, meta_v1.CreateOptions{FieldManager: config.Env.FieldManager})
+	}
+	if err != nil {
+		return err
+	}
+	logger.Info("Test target written to ConfigMap " + namespace + "/" + name)
+	return nil
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"rooster/pkg/config"
+
+	"go.uber.org/zap"
+)
+
+// Backups of the versions rolled out, under the backup directory: versions/<canary label key>/<version>/.
+// manifests holds the manifests the version was rolled out from, overlays included. resources holds its live resources,
+// one file per resource, stripped of the fields populated by the API server
+const (
+	versionBackupsDirectory   = "versions"
+	versionManifestsDirectory = "manifests"
+	versionResourcesDirectory = "resources"
+)
+
+// versionBackupDirectory returns the backup of the version of the canary label. The slashes of the key are replaced
+func versionBackupDirectory(backupDirectory string, canaryLabel string) string {
+	key, version, _ := strings.Cut(canaryLabel, "=")
+	return filepath.Join(backupDirectory, versionBackupsDirectory, strings.ReplaceAll(key, "/", "_"), version)
+}
+
+// VersionManifests returns the manifests the version of the canary label was rolled out from, as backed up
+func VersionManifests(backupDirectory string, canaryLabel string) (string, error) {
+	manifestPath := filepath.Join(versionBackupDirectory(backupDirectory, canaryLabel), versionManifestsDirectory)
+	if !checkDirectoryExistence(manifestPath) {
+		return "", errors.New("no backup of " + canaryLabel + " is found at " + manifestPath)
+	}
+	return manifestPath, nil
+}
+
+// ResolveBackupDirectory returns the backup directory a resource is restored from. backup is either a directory, or a version:
+// key=version, or the version alone when a single canary label key has a backup of it. No cluster is needed
+func ResolveBackupDirectory(backupDirectory string, backup string) (string, error) {
+	if backup == "" || checkDirectoryExistence(backup) {
+		return backup, nil
+	}
+	if strings.Contains(backup, "=") {
+		resources := filepath.Join(versionBackupDirectory(backupDirectory, backup), versionResourcesDirectory)
+		if !checkDirectoryExistence(resources) {
+			return "", errors.New("no backup of " + backup + " is found at " + resources)
+		}
+		return resources, nil
+	}
+	matches, err := filepath.Glob(filepath.Join(backupDirectory, versionBackupsDirectory, "*", backup, versionResourcesDirectory))
+	if err != nil {
+		return "", err
+	}
+	switch len(matches) {
+	case 0:
+		return "", errors.New(backup + " is neither a directory nor a version backed up in " + filepath.Join(backupDirectory, versionBackupsDirectory))
+	case 1:
+		return matches[0], nil
+	}
+	return "", errors.New("several canary labels have a backup of version " + backup + ". Indicate the canary label: key=" + backup)
+}
+
+// recordVersionBackup backs the version up, once rolled out: the manifests it was rolled out from, and its live resources.
+// A failed backup does not fail the rollout
+func recordVersionBackup(logger *zap.Logger, options config.RoosterOptions, sourceManifests string, targetResources map[string]string) {
+	if config.Env.BackupDirectory == "" || options.NoBackup {
+		return
+	}
+	directory := versionBackupDirectory(config.Env.BackupDirectory, options.CanaryLabel)
+	// A version promoted from another cluster is rolled out from its backup already
+	if manifests := filepath.Join(directory, versionManifestsDirectory); filepath.Clean(sourceManifests) != manifests {
+		if err := os.RemoveAll(manifests); err != nil {
+			logger.Warn("Could not back up the manifests of " + options.CanaryLabel + ": " + err.Error())
+			return
+		}
+		if err := copyDirectory(sourceManifests, manifests); err != nil {
+			logger.Warn("Could not back up the manifests of " + options.CanaryLabel + ": " + err.Error())
+			return
+		}
+	}
+	resources := filepath.Join(directory, versionResourcesDirectory)
+	if err := os.RemoveAll(resources); err != nil {
+		logger.Warn("Could not back up the resources of " + options.CanaryLabel + ": " + err.Error())
+		return
+	}
+	if completed := backupResourcesTo(logger, resources, targetResources, options.RedactSecrets, true); !completed {
+		logger.Warn("Could not back up the resources of " + options.CanaryLabel)
+		return
+	}
+	files, err := listManifestFiles(resources)
+	if err != nil {
+		logger.Warn(err.Error())
+		return
+	}
+	for _, file := range files {
+		if err = sanitizeBackupFileInPlace(file); err != nil {
+			logger.Warn("Could not back up the resources of " + options.CanaryLabel + ": " + err.Error())
+			return
+		}
+	}
+	logger.Info(options.CanaryLabel + " was backed up in " + directory)
+}
+
+// sanitizeBackupFileInPlace strips the fields populated by the API server from the backup file
+func sanitizeBackupFileInPlace(backupFile string) error {
+	sanitizedFile, _, err := sanitizeBackupFile(backupFile)
+	if sanitizedFile != "" {
+		defer os.Remove(sanitizedFile)
+	}
+	if err != nil {
+		return err
+	}
+	return copyFile(sanitizedFile, backupFile)
+}
+
+// copyDirectory copies the files of the source directory, and of its sub-directories, to the destination
+func copyDirectory(source string, destination string) error {
+	return filepath.WalkDir(source, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(destination, relativePath)
+		if entry.IsDir() {
+			return os.MkdirAll(target, os.ModePerm)
+		}
+		return copyFile(path, target)
+	})
+}
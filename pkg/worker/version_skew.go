@@ -0,0 +1,124 @@
+/*
+Copyright 2023 The Rooster Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"rooster/pkg/config"
+	"rooster/pkg/utils"
+
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Version of the target nodes without the canary label key: the one running before Rooster took over
+const unlabeledVersion = "(unlabeled)"
+
+// CheckVersionSkew reports the target nodes breaking the version skew policy. With an interval, the policy is checked
+// until the process is stopped
+func CheckVersionSkew(kubernetesClient *utils.K8sClient, logger *zap.Logger, options config.RoosterOptions, interval time.Duration) bool {
+	clients := Clients{}
+	clients.K8sClient = *kubernetesClient
+	for {
+		customOptions := meta_v1.ListOptions{}
+		customOptions.LabelSelector = options.TargetLabel
+		targetNodes := clients.getTargetNodes(logger, options.TargetLabel, customOptions)
+		violations := findSkewViolations(logger, options, targetNodes.Items, false)
+		for _, violation := range violations {
+			logger.Error("Version skew policy violated: " + violation)
+		}
+		if len(violations) == 0 {
+			logger.Info("The version skew policy is met")
+		}
+		if interval == 0 {
+			return len(violations) == 0
+		}
+		logger.Info("Next check in " + interval.String())
+		time.Sleep(interval)
+	}
+}
+
+// nodeVersions counts the target nodes running each version, as told by the canary label key
+func nodeVersions(nodes []core_v1.Node, canaryLabelKey string) map[string]int {
+	versions := map[string]int{}
+	for _, node := range nodes {
+		version, found := node.Labels[canaryLabelKey]
+		if !found {
+			version = unlabeledVersion
+		}
+		versions[version]++
+	}
+	return versions
+}
+
+// FindSkewViolations checks the versions of the target nodes against the version skew policy of the options. preflight: the
+// version of the canary label is about to be rolled out. No cluster is needed
+func FindSkewViolations(logger *zap.Logger, options config.RoosterOptions, nodes []core_v1.Node, preflight bool) []string {
+	return findSkewViolations(logger, options, nodes, preflight)
+}
+
+// findSkewViolations checks the versions of the target nodes against the policy. Before a rollout, the version
+// about to be rolled out counts as running already
+func findSkewViolations(logger *zap.Logger, options config.RoosterOptions, nodes []core_v1.Node, preflight bool) (violations []string) {
+	canaryLabelKey, version, _ := strings.Cut(options.CanaryLabel, "=")
+	versions := nodeVersions(nodes, canaryLabelKey)
+	if options.MaxVersions > 0 {
+		if _, found := versions[version]; preflight && !found {
+			versions[version] = 0
+		}
+		if len(versions) > options.MaxVersions {
+			running := []string{}
+			for name, count := range versions {
+				running = append(running, name+" ("+strconv.Itoa(count)+" nodes)")
+			}
+			sort.Strings(running)
+			violations = append(violations, strconv.Itoa(len(versions))+" versions run on the target nodes, over the maximum of "+strconv.Itoa(options.MaxVersions)+": "+strings.Join(running, ", "))
+		}
+	}
+	// A partial rollout may only cover that much of the fleet for so long
+	if preflight || options.MaxPartialCoverage <= 0 || options.MaxPartialDuration <= 0 || len(nodes) == 0 {
+		return
+	}
+	coverage := versions[version] * 100 / len(nodes)
+	if coverage <= options.MaxPartialCoverage || versions[version] == len(nodes) {
+		return
+	}
+	// The oldest transition of the version tells since when the rollout is in progress
+	var since time.Time
+	for _, node := range nodes {
+		if node.Labels[canaryLabelKey] != version || node.Annotations[rolloutVersionAnnotation] != version {
+			continue
+		}
+		transition, err := time.Parse(time.RFC3339, node.Annotations[rolloutLastTransitionAnnotation])
+		if err == nil && (since.IsZero() || transition.Before(since)) {
+			since = transition
+		}
+	}
+	if since.IsZero() {
+		logger.Warn("Version " + version + " covers " + strconv.Itoa(coverage) + "% of the target nodes, but the nodes carry no rollout annotation. Roll out with --annotate-nodes to enforce the maximum partial coverage duration")
+		return
+	}
+	if elapsed := time.Since(since); elapsed > options.MaxPartialDuration {
+		violations = append(violations, "version "+version+" covers "+strconv.Itoa(coverage)+"% of the target nodes, over the maximum of "+strconv.Itoa(options.MaxPartialCoverage)+"%, since "+elapsed.Round(time.Minute).String()+". Complete or revert the rollout within "+options.MaxPartialDuration.String())
+	}
+	return
+}